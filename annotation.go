@@ -0,0 +1,248 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hovering anywhere in a type annotation spells out what the typing generics in it mean, `Optional[str]` is
+// `Union[str, None]` and `List[int]` is a list of int. only the line under the cursor is looked at, which covers
+// one line signatures and the usual one parameter per line layout
+
+var annotatedNameRe = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*)\s*:`)
+
+// the annotation around byte offset pos on a def line, a parameter line or an annotated assignment, with its span
+func annotationAt(lineText string, pos int) (annotation string, start, end int) {
+	trimmed := strings.TrimLeft(lineText, " \t")
+	isDef := strings.HasPrefix(trimmed, "def ") || strings.HasPrefix(trimmed, "async def ")
+	annotatedName := false
+	if m := annotatedNameRe.FindStringSubmatch(lineText); m != nil && !pythonKeywords[m[1]] && !isDef {
+		annotatedName = true
+	}
+
+	depth := 0
+	start = -1
+	annDepth := 0
+	finish := func(i int) (string, int, int, bool) {
+		s, e := start, i
+		start = -1
+		for s < e && (lineText[s] == ' ' || lineText[s] == '\t') { s++ }
+		for e > s && (lineText[e-1] == ' ' || lineText[e-1] == '\t') { e-- }
+		if s < e && pos >= s && pos <= e {
+			return lineText[s:e], s, e, true
+		}
+		return "", 0, 0, false
+	}
+
+	i := 0
+	for ; i < len(lineText); i++ {
+		c := lineText[i]
+		if c == '#' {
+			break
+		}
+		if c == '"' || c == '\'' { // forward references are quoted, nothing inside a string ends anything
+			if j := strings.IndexByte(lineText[i+1:], c); j >= 0 {
+				i += j + 1
+				continue
+			}
+			break
+		}
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if start >= 0 && depth == annDepth {
+				if a, s, e, ok := finish(i); ok {
+					return a, s, e
+				}
+			}
+			depth--
+		case ',', '=':
+			if start >= 0 && depth == annDepth {
+				if a, s, e, ok := finish(i); ok {
+					return a, s, e
+				}
+			}
+		case ':':
+			if start >= 0 && depth == annDepth {
+				if a, s, e, ok := finish(i); ok {
+					return a, s, e
+				}
+			}else if start < 0 && ((isDef && depth == 1) || (annotatedName && depth == 0)) {
+				start, annDepth = i+1, depth
+				annotatedName = false // only the first colon, the rest of the line is the value
+			}
+		case '-':
+			if start < 0 && i+1 < len(lineText) && lineText[i+1] == '>' {
+				start, annDepth = i+2, depth
+				i++
+			}
+		}
+	}
+	if start >= 0 {
+		if a, s, e, ok := finish(i); ok {
+			return a, s, e
+		}
+	}
+	return "", 0, 0
+}
+
+func annotationHover(lineText string, start, end int) *Hover {
+	annotation, s, e := annotationAt(lineText, start)
+	if annotation == "" || end > e || start < s {
+		return nil
+	}
+	expanded := expandTypeAnnotation(annotation)
+	if expanded == annotation {
+		return nil // a plain class, its definition says more
+	}
+	return markdownHover(codeBlock(annotation) + "\n\n" + expanded)
+}
+
+// what a typing annotation means in words, generics are expanded from the inside out and anything not
+// recognised is left as written
+func expandTypeAnnotation(annotation string) string {
+	annotation = strings.TrimSpace(annotation)
+	if len(annotation) >= 2 && (annotation[0] == '"' || annotation[0] == '\'') && annotation[len(annotation)-1] == annotation[0] {
+		return expandTypeAnnotation(annotation[1 : len(annotation)-1])
+	}
+
+	if parts := splitAnnotation(annotation, '|'); len(parts) > 1 {
+		for i := range parts {
+			parts[i] = expandTypeAnnotation(parts[i])
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	open := strings.IndexByte(annotation, '[')
+	if open <= 0 || !strings.HasSuffix(annotation, "]") {
+		if typingName(annotation) == "Any" {
+			return "any type"
+		}
+		return annotation
+	}
+	name := typingName(annotation[:open])
+	raw := splitAnnotation(annotation[open+1:len(annotation)-1], ',')
+	args := make([]string, len(raw))
+	for i := range raw {
+		args[i] = expandTypeAnnotation(raw[i])
+	}
+
+	switch {
+	case name == "Optional" && len(args) == 1:
+		return "Union[" + args[0] + ", None]"
+	case name == "Union":
+		return "Union[" + strings.Join(args, ", ") + "]"
+	case (name == "List" || name == "list") && len(args) == 1:
+		return "list of " + args[0]
+	case (name == "Set" || name == "set") && len(args) == 1:
+		return "set of " + args[0]
+	case (name == "FrozenSet" || name == "frozenset") && len(args) == 1:
+		return "frozenset of " + args[0]
+	case (name == "Deque" || name == "deque") && len(args) == 1:
+		return "deque of " + args[0]
+	case (name == "Dict" || name == "dict") && len(args) == 2:
+		return "dict mapping " + args[0] + " to " + args[1]
+	case (name == "DefaultDict" || name == "defaultdict") && len(args) == 2:
+		return "defaultdict mapping " + args[0] + " to " + args[1]
+	case name == "Mapping" && len(args) == 2:
+		return "read-only mapping of " + args[0] + " to " + args[1]
+	case name == "Sequence" && len(args) == 1:
+		return "read-only sequence of " + args[0]
+	case name == "Iterable" && len(args) == 1:
+		return "iterable of " + args[0]
+	case name == "Iterator" && len(args) == 1:
+		return "iterator over " + args[0]
+	case name == "Awaitable" && len(args) == 1:
+		return "awaitable resolving to " + args[0]
+	case name == "Coroutine" && len(args) == 3:
+		return "coroutine returning " + args[2]
+	case name == "Generator" && len(args) == 3:
+		generator := "generator yielding " + args[0]
+		if args[1] != "None" {
+			generator += ", sent " + args[1]
+		}
+		if args[2] != "None" {
+			generator += ", returning " + args[2]
+		}
+		return generator
+	case name == "Tuple" || name == "tuple":
+		if len(args) == 2 && args[1] == "..." {
+			return "tuple of " + args[0] + " of any length"
+		}
+		if len(args) == 1 && args[0] == "()" {
+			return "empty tuple"
+		}
+		return "tuple of (" + strings.Join(args, ", ") + ")"
+	case name == "Callable" && len(raw) == 2:
+		takes := "any arguments"
+		if params := strings.TrimSpace(raw[0]); params != "..." && strings.HasPrefix(params, "[") && strings.HasSuffix(params, "]") {
+			list := splitAnnotation(params[1:len(params)-1], ',')
+			for i := range list {
+				list[i] = expandTypeAnnotation(list[i])
+			}
+			takes = "(" + strings.Join(list, ", ") + ")"
+			if len(list) == 0 {
+				takes = "no arguments"
+			}
+		}
+		return "function taking " + takes + " returning " + args[1]
+	case (name == "Type" || name == "type") && len(args) == 1:
+		return "the class " + args[0] + " or a subclass of it, not an instance"
+	case name == "Literal":
+		return "one of the values " + strings.Join(raw, ", ")
+	case name == "ClassVar" && len(args) == 1:
+		return "class variable of type " + args[0]
+	case name == "Final" && len(args) == 1:
+		return args[0] + ", never reassigned"
+	case name == "Annotated" && len(args) >= 1:
+		return args[0]
+	}
+	for i := range args {
+		if args[i] != raw[i] {
+			return annotation[:open] + "[" + strings.Join(args, ", ") + "]"
+		}
+	}
+	return annotation
+}
+
+// typing.List and t.List are List
+func typingName(name string) string {
+	name = strings.TrimSpace(name)
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		return name[dot+1:]
+	}
+	return name
+}
+
+// s split on sep where it isn't inside brackets or quotes, empty parts dropped
+func splitAnnotation(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(' || c == '{':
+			depth++
+		case c == ']' || c == ')' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			if part := strings.TrimSpace(s[last:i]); part != "" {
+				parts = append(parts, part)
+			}
+			last = i + 1
+		}
+	}
+	if part := strings.TrimSpace(s[last:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
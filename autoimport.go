@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// completion of names the other open documents define at module level, with the `from module import name` that
+// makes them usable attached as an additional edit
+
+// the dotted module an open document is, going by its path under the workspace (just the file name without one)
+func moduleNameFor(uri string) string {
+	p := uriToPath(uri)
+	if p == "" {
+		return ""
+	}
+	if root := getWorkspaceRoot(); root != "" {
+		if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+	}else{
+		p = filepath.Base(p)
+	}
+	module := strings.TrimSuffix(filepath.ToSlash(p), ".py")
+	module = strings.TrimSuffix(strings.TrimSuffix(module, "__init__"), "/")
+	if module == "" || strings.Contains(module, ":") {
+		return ""
+	}
+	return strings.ReplaceAll(module, "/", ".")
+}
+
+// where a new import line goes: after the existing top level imports, or failing those after the module header
+func importInsertLine(content string) int {
+	lines := splitLines(content)
+	insert := moduleHeaderEnd(content).Line
+	for _, ll := range logicalLines(lines, tokenize(content)) {
+		if ll.line < insert { continue } // the docstring
+		first := ll.tokens[0]
+		if ll.indent != 0 || !isKeyword(first, "import") && !isKeyword(first, "from") {
+			return insert
+		}
+		insert = ll.endLine + 1
+	}
+	return insert
+}
+
+// whether content already has `from module import name`, aliased or not
+func importsSymbol(content string, module string, name string) bool {
+	for _, m := range fromImportLineRe.FindAllStringSubmatch(content, -1) {
+		if m[1] != module && !strings.HasSuffix(module, strings.TrimLeft(m[1], ".")) { continue }
+		for _, item := range strings.Split(strings.Trim(strings.TrimSpace(m[2]), "()"), ",") {
+			if fields := strings.Fields(item); len(fields) > 0 && fields[0] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// public module level defs, classes and assignments of the other python documents that aren't visible at the
+// cursor yet. the first document defining a name wins
+func autoImportCompletions(uri string, content string, root *scope, cc completionContext, files map[string]OpenFile) []CompletionItem {
+	visible := root.scopeAt(cc.line, cc.offset)
+	lines := splitLines(content)
+	at, prefix := Position{importInsertLine(content), 0}, ""
+	if at.Line >= len(lines) { // the imports run to the end of a file without a final newline
+		at, prefix = Position{len(lines) - 1, lineCharacter(lines[len(lines)-1], len(lines[len(lines)-1]))}, "\n"
+	}
+	items := make([]CompletionItem, 0)
+	offered := make(map[string]bool)
+
+	for _, u := range pythonURIs(files) {
+		if u == uri { continue }
+		module := moduleNameFor(u)
+		if module == "" { continue }
+		other := analyzeScopes(files[u].content)
+		for _, name := range other.order {
+			if offered[name] || strings.HasPrefix(name, "_") { continue }
+			kind := 0
+			switch other.bindings[name][0].kind {
+			case bindDef:
+				kind = 3
+			case bindClass:
+				kind = 7
+			case bindAssign:
+				kind = 6
+			}
+			if kind == 0 { continue }
+			if _, inScope := visible.lookup(name); inScope || importsSymbol(content, module, name) { continue }
+
+			offered[name] = true
+			edit := TextEdit{Range{at, at}, prefix + "from " + module + " import " + name + "\n"}
+			items = append(items, CompletionItem{
+				Label: name, Kind: kind, InsertText: name, InsertTextFmt: 1,
+				LabelDetails: &CompletionItemLabelDetails{Description: module},
+				AdditionalTextEdits: []TextEdit{edit},
+			})
+		}
+	}
+	return items
+}
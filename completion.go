@@ -0,0 +1,1157 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// how many of the most frequent words are offered when nothing matches what's been typed
+const fallbackLimit = 25
+
+type completionContext struct {
+	tocomplete string   // the partial identifier under the cursor
+	leadup     []string // identifiers in the dotted chain before it, `os.path.jo` gives ["os", "path"]
+	line       int
+	lineText   string
+	offset     int // byte offset of the cursor in lineText
+}
+
+func getCompletionContext(content string, line, character int) completionContext {
+	// a position past the end shows up while edits are in flight, treat it as the end of the last line
+	lines := splitLines(content)
+	if line >= len(lines) {
+		line = len(lines) - 1
+		character = lineCharacter(lines[line], len(lines[line]))
+	}
+	if line < 0 {
+		line, character = 0, 0
+	}
+	offset := lineOffset(lines[line], character)
+	character = utf8.RuneCountInString(lines[line][:offset]) // the walk below counts runes
+	
+	curline := 0
+	line_pos := 0
+	curword := ""
+	tocomplete := ""
+	
+	leadup := make([]string, 0)
+	atcursor := leadup
+	
+	// docstrings and other triple quoted strings span lines, nothing inside them is code to complete against
+	inTripleString := false
+	var tripleQuote, quoteChar rune
+	quoteRun := 0
+	
+	for _, c := range content {
+		line_pos ++
+		
+		if c == '"' || c == '\'' {
+			if c == quoteChar {
+				quoteRun ++
+			}else{
+				quoteChar, quoteRun = c, 1
+			}
+			if quoteRun == 3 {
+				if !inTripleString {
+					inTripleString, tripleQuote = true, c
+				}else if c == tripleQuote {
+					inTripleString = false
+				}
+				quoteRun = 0
+			}
+		}else{
+			quoteRun = 0
+		}
+		
+		if c == '\n' {
+			if curline == line && (line_pos == character) {
+				tocomplete = curword
+				atcursor = leadup
+			}
+			
+			curline ++
+			line_pos = 0
+			if curline > line {
+				break
+			}
+		}else if curline == line {
+			if inTripleString {
+				leadup = make([]string, 0)
+				curword = ""
+			}else if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+				curword += string(c)
+			}else if (c == '.') {
+				leadup = append(leadup, curword)
+				curword = "";
+			}else{
+				leadup = make([]string, 0);
+				curword = ""
+			}
+			
+			if (line_pos == character) {
+				tocomplete = curword;
+				atcursor = leadup
+			}
+		}
+	}
+	
+	if (line_pos+1 == character && curline == line) {
+		tocomplete = curword
+		atcursor = leadup
+	}
+	
+	return completionContext{tocomplete, atcursor, line, lines[line], offset}
+}
+
+var comprehensionForRe = regexp.MustCompile(`\bfor\s+([\w\s,()]+?)\s+in\b`)
+
+// loop variables of the comprehension the cursor sits in, `[x.y for x in items]` gives ["x"].
+// only the current line is looked at, which covers the vast majority of comprehensions
+func comprehensionVariables(lineText string, offset int) []string {
+	start := -1
+	depth := 0
+	for i := offset - 1; i >= 0; i-- {
+		switch lineText[i] {
+		case ')', ']', '}':
+			depth++
+		case '(', '[', '{':
+			if depth == 0 {
+				start = i
+			}else{
+				depth--
+			}
+		}
+		if start >= 0 { break }
+	}
+	if start < 0 || lineText[start] == '(' && !strings.Contains(lineText[start:], " for ") {
+		return nil
+	}
+	
+	end := len(lineText)
+	depth = 0
+	for i := start + 1; i < len(lineText); i++ {
+		c := lineText[i]
+		if c == '(' || c == '[' || c == '{' {
+			depth++
+		}else if c == ')' || c == ']' || c == '}' {
+			if depth == 0 {
+				end = i
+				break
+			}
+			depth--
+		}
+	}
+	
+	names := make([]string, 0)
+	for _, m := range comprehensionForRe.FindAllStringSubmatch(lineText[start+1:end], -1) {
+		for _, name := range strings.FieldsFunc(m[1], func(c rune) bool { return !isWordChar(c) }) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// LSP's InsertTextMode
+const (
+	insertTextModeAsIs              = 1
+	insertTextModeAdjustIndentation = 2
+)
+
+// multi-line inserts are written as if the cursor line had no indentation. a client that can adjust them is told
+// to, for the rest the cursor line's indentation is put in front of every line after the first
+func indentMultiline(items []CompletionItem, lineText string) {
+	indent := lineText[:indentOf(lineText)]
+	for i := range items {
+		if !strings.Contains(items[i].InsertText, "\n") { continue }
+		if clientAdjustIndentation {
+			items[i].InsertTextMode = insertTextModeAdjustIndentation
+		}else{
+			lines := strings.Split(items[i].InsertText, "\n")
+			for j := 1; j < len(lines); j++ {
+				if lines[j] != "" { // no trailing whitespace on the blank ones
+					lines[j] = indent + lines[j]
+				}
+			}
+			items[i].InsertText, items[i].InsertTextMode = strings.Join(lines, "\n"), insertTextModeAsIs
+		}
+	}
+}
+
+// the context for a document too large to walk: the line under the cursor is found by counting newlines and only
+// the identifier right before the cursor is looked at, there's no leadup
+func lineCompletionContext(content string, line, character int) completionContext {
+	start, current := 0, 0
+	for current < line {
+		next := strings.IndexByte(content[start:], '\n')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+		current++
+	}
+	end := strings.IndexByte(content[start:], '\n')
+	if end < 0 {
+		end = len(content) - start
+	}
+	lineText := strings.TrimSuffix(content[start:start+end], "\r")
+	offset := lineOffset(lineText, character)
+	begin := offset
+	for begin > 0 && isIdentifierByte(lineText[begin-1]) {
+		begin--
+	}
+	return completionContext{tocomplete: lineText[begin:offset], line: current, lineText: lineText, offset: offset}
+}
+
+// names bound by a plain `import` (aliases included) that nothing in the document is accessed on yet, `import json`
+// with no `json.` anywhere. the import line itself is all the use they have so far
+func unusedModuleImports(file OpenFile) map[string]bool {
+	unused := make(map[string]bool)
+	for _, m := range importLineRe.FindAllStringSubmatch(file.content, -1) {
+		for _, item := range strings.Split(m[1], ",") {
+			fields := strings.Fields(item)
+			name := ""
+			if len(fields) == 3 && fields[1] == "as" {
+				name = fields[2]
+			}else if len(fields) == 1 {
+				name = strings.Split(fields[0], ".")[0]
+			}
+			if name == "" { continue }
+			if file.receiverAttributes.of(name).len() == 0 {
+				unused[name] = true
+			}
+		}
+	}
+	return unused
+}
+
+// SortText is built from three keys compared in order: a bucket digit (what kind of candidate it is, lower is
+// better), how well it matches what's been typed, then how often it's used
+const (
+	bucketPinned   = 0 // context specific candidates, comprehension variables and the like
+	bucketDefined  = 1 // with nothing typed yet: defs, classes and module level assignments of this document
+	bucketLocal    = 2 // with nothing typed yet: parameters and locals of the enclosing function
+	bucketDocument = 3 // with nothing typed yet: any other word of the document
+	bucketBuiltin  = 4 // with nothing typed yet: builtins and wordlist terms
+	bucketDefault  = 5
+	bucketBottom   = 9
+)
+
+const maxMatchScore = 99999
+
+func rankSortText(bucket int, score int, freq int64) string {
+	if score < 0 {
+		score = 0
+	}
+	if score > maxMatchScore {
+		score = maxMatchScore
+	}
+	if freq > 999999 {
+		freq = 999999
+	}
+	if freq < 0 {
+		freq = 0
+	}
+	return strconv.Itoa(bucket) + padStart(strconv.Itoa(maxMatchScore-score), "0", 5) + padStart(strconv.FormatInt(999999-freq, 10), "0", 6)
+}
+
+type completionSet struct {
+	tocomplete string
+	items      []CompletionItem
+	seen       map[string]bool
+	hidden     map[string]bool // names that aren't visible from the cursor at all
+	demoted    map[string]bool // rank as if never used, below every other candidate matching as well
+	details    bool            // fill in a detail for the items that come without one, completion.showDetail
+}
+
+func newCompletionSet(tocomplete string) *completionSet {
+	return &completionSet{tocomplete, make([]CompletionItem, 0), make(map[string]bool), make(map[string]bool), make(map[string]bool), false}
+}
+
+// the first item offered for a label wins, so sources go in from most to least specific
+func (s *completionSet) add(item CompletionItem, bucket int, freq int64) {
+	if s.seen[item.Label] || s.hidden[item.Label] || item.Label == s.tocomplete {
+		return
+	}
+	score, ok := fuzzyScore(s.tocomplete, item.Label)
+	if !ok {
+		return
+	}
+	s.seen[item.Label] = true
+	if s.demoted[item.Label] {
+		freq = 0
+	}
+	if s.details && item.Detail == "" && item.InsertTextFmt == 2 {
+		item.Detail = "snippet"
+	}
+	score += recencyBoost(item.Label)
+	item.SortText = rankSortText(bucket, score+1000, freq) // offset so the unmatched-length penalty doesn't bottom out at zero
+	s.items = append(s.items, item)
+}
+
+func (s *completionSet) addWords(words map[string]int64, bucket func(string) int) {
+	for key, value := range words {
+		s.add(CompletionItem{ Label: key, Kind: 3, InsertText: key, InsertTextFmt: 1 }, bucket(key), value)
+	}
+}
+
+func (s *completionSet) addWordCounts(words wordCounts, bucket func(string) int) {
+	words.each(func(key string, value int64) {
+		item := CompletionItem{ Label: key, Kind: 3, InsertText: key, InsertTextFmt: 1 }
+		if s.details {
+			item.Detail = usesDetail(value)
+		}
+		s.add(item, bucket(key), value)
+	})
+}
+
+// how often a word of the document appears in it, as the detail
+func usesDetail(count int64) string {
+	if count == 1 {
+		return "1 use"
+	}
+	return strconv.FormatInt(count, 10) + " uses"
+}
+
+// "keyword" or "builtin" as the detail, empty for what's neither
+func builtinDetail(name string) string {
+	if pythonKeywords[name] {
+		return "keyword"
+	}
+	if isBuiltinName(name) {
+		return "builtin"
+	}
+	return ""
+}
+
+// keywords that open a block, with what goes after them. the ones with no header get their colon even without
+// snippet support
+var blockKeywords = map[string]struct{ plain, snippet string }{
+	"if":      {"if", "if ${1:condition}:$0"},
+	"elif":    {"elif", "elif ${1:condition}:$0"},
+	"else":    {"else:", "else:$0"},
+	"for":     {"for", "for ${1:item} in ${2:iterable}:$0"},
+	"while":   {"while", "while ${1:condition}:$0"},
+	"try":     {"try:", "try:$0"},
+	"except":  {"except", "except ${1:Exception}:$0"},
+	"finally": {"finally:", "finally:$0"},
+	"with":    {"with", "with ${1:expression}:$0"},
+	"def":     {"def", "def ${1:name}($2):$0"},
+	"class":   {"class", "class ${1:Name}:$0"},
+}
+
+// the extraBuiltins, ahead of the document's words and the standard builtins so their signature and doc are the
+// ones shown even when the document uses the name too or it's a standard builtin as well
+func (s *completionSet) addExtraBuiltins(bucket func(string) int) {
+	for name, info := range getExtraBuiltins() {
+		if _, keyword := blockKeywords[name]; keyword { continue }
+		s.add(info.completionItem(), bucket(name), builtinFrequency)
+	}
+}
+
+// builtins whose keyword arguments are easy to forget, completed as a call with them in place
+var builtinCalls = map[string]struct{ signature, snippet string }{
+	"sorted": {"(iterable, /, *, key=None, reverse=False) -> list", "sorted(${1:iterable}, key=${2:None})$0"},
+}
+
+// builtins and keywords, block keywords complete with their colon when they start the statement. mid
+// expression (`a if b else c`, comprehensions) they're left as the bare word
+func (s *completionSet) addBuiltins(cc completionContext, bucket func(string) int) {
+	statementStart := strings.TrimSpace(cc.lineText[:cc.offset-len(cc.tocomplete)]) == ""
+	for key, value := range defaultCompletions {
+		item := CompletionItem{ Label: key, Kind: 3, InsertText: key, InsertTextFmt: 1 }
+		if s.details {
+			item.Detail = builtinDetail(key)
+		}
+		if block, ok := blockKeywords[key]; ok && statementStart {
+			item.Kind = 14
+			if clientSnippetSupport {
+				item.InsertText, item.InsertTextFmt = block.snippet, 2
+			}else{
+				item.InsertText = block.plain
+			}
+		}else if call, ok := builtinCalls[key]; ok {
+			item.Detail = key + call.signature
+			if clientSnippetSupport && !strings.HasPrefix(cc.lineText[cc.offset:], "(") {
+				item.InsertText, item.InsertTextFmt = call.snippet, 2
+			}
+		}
+		s.add(item, bucket(key), value)
+	}
+}
+
+// a call template next to each function already in the menu, `compute_totals(${1:rows}, ${2:strict=False})$0`.
+// it ranks with the plain name and filters on it, the plain item stays for when only the name is wanted
+// awaiting puts `await ` in front of the calls of async defs, for a cursor in an async def that doesn't already
+// follow an await
+func (s *completionSet) addCallSnippets(functions map[string]*scope, awaiting bool) {
+	for _, item := range s.items {
+		fn, ok := functions[item.Label]
+		if !ok || item.Kind != 3 { continue }
+
+		placeholders := make([]string, 0, len(fn.params))
+		shown := make([]string, 0, len(fn.params))
+		for _, p := range fn.params {
+			if p.star != "" || p.name == "self" || p.name == "cls" { continue }
+			hint := p.name
+			if p.value != "" {
+				hint += "=" + p.value
+			}
+			placeholders = append(placeholders, "${" + strconv.Itoa(len(placeholders)+1) + ":" + escapeSnippet(hint) + "}")
+			shown = append(shown, hint)
+		}
+		label := item.Label + "(" + strings.Join(shown, ", ") + ")"
+		insert := item.Label + "(" + strings.Join(placeholders, ", ") + ")$0"
+		detail := "def " + fn.name + fn.signature()
+		if fn.isAsync {
+			detail = "async " + detail
+			if awaiting {
+				label, insert = "await "+label, "await "+insert
+			}
+		}
+		s.items = append(s.items, CompletionItem{
+			Label: label, Kind: 3, FilterText: item.Label,
+			InsertText: insert, InsertTextFmt: 2,
+			SortText: item.SortText, Detail: detail,
+		})
+	}
+}
+
+// `$`, `}` and `\` are snippet syntax
+func escapeSnippet(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace(text)
+}
+
+// functions (not methods, those need a receiver) of the open documents by name, the current one's first
+func callableFunctions(uri string, root *scope, files map[string]OpenFile) map[string]*scope {
+	functions := make(map[string]*scope)
+	var walk func(s *scope)
+	walk = func(s *scope) {
+		for _, c := range s.children {
+			if c.kind == scopeFunction && s.kind != scopeClass && functions[c.name] == nil {
+				functions[c.name] = c
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	for _, u := range pythonURIs(files) {
+		if u != uri {
+			walk(analyzeScopes(files[u].content))
+		}
+	}
+	return functions
+}
+
+func constantBucket(bucket int) func(string) int {
+	return func(string) int { return bucket }
+}
+
+// with an empty prefix the menu is everything, so what the document itself defines goes first, then what the
+// enclosing function binds, then the rest of the document's words
+func documentWordBucket(root *scope, cc completionContext) func(string) int {
+	defined := definedNames(root)
+	local := make(map[string]bool)
+	if fn := root.scopeAt(cc.line, cc.offset).enclosingFunction(); fn != nil {
+		for _, name := range fn.order {
+			local[name] = true
+		}
+	}
+
+	return func(word string) int {
+		if defined[word] {
+			return bucketDefined
+		}
+		if local[word] {
+			return bucketLocal
+		}
+		return bucketDocument
+	}
+}
+
+var bindingDetail = map[bindingKind]string{bindParam: "parameter", bindLoop: "loop variable", bindWith: "with target", bindExcept: "exception"}
+
+// the parameters of the function around the cursor, self and cls included, and the variables bound by the for,
+// with and except blocks the cursor is inside of. a parameter used once is still far likelier here than a word
+// the rest of the file uses a lot
+func enclosingBindings(root *scope, lines []string, cc completionContext) []binding {
+	cur := root.scopeAt(cc.line, cc.offset)
+	for cur.kind == scopeComprehension && cur.parent != nil {
+		cur = cur.parent
+	}
+	var found []binding
+	if fn := cur.enclosingFunction(); fn != nil {
+		for _, name := range fn.order {
+			for _, b := range fn.bindings[name] {
+				if b.kind == bindParam {
+					found = append(found, b)
+					break
+				}
+			}
+		}
+	}
+	if cur.kind == scopeClass {
+		return found
+	}
+	for _, name := range cur.order {
+		for _, b := range cur.bindings[name] {
+			if (b.kind == bindLoop || b.kind == bindWith || b.kind == bindExcept) && blockEncloses(lines, b.line, cc.line) {
+				found = append(found, b)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// whether line is in the indented block opened by the header on line header
+func blockEncloses(lines []string, header, line int) bool {
+	if header >= line || line >= len(lines) {
+		return false
+	}
+	indent := indentOf(lines[header])
+	for i := header + 1; i < line; i++ {
+		if !isBlankLine(lines[i]) && indentOf(lines[i]) <= indent {
+			return false
+		}
+	}
+	return indentOf(lines[line]) > indent
+}
+
+// names only ever bound as comprehension variables, minus those of the comprehensions around the cursor.
+// `[x for x in items]` shouldn't offer x anywhere but inside the brackets
+func comprehensionOnlyNames(root *scope, line, offset int) map[string]bool {
+	inComprehension := make(map[string]bool)
+	elsewhere := make(map[string]bool)
+	var walk func(s *scope)
+	walk = func(s *scope) {
+		for name := range s.bindings {
+			if s.kind == scopeComprehension {
+				inComprehension[name] = true
+			}else{
+				elsewhere[name] = true
+			}
+		}
+		for _, c := range s.children {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	names := make(map[string]bool)
+	for name := range inComprehension {
+		if !elsewhere[name] {
+			names[name] = true
+		}
+	}
+	for cur := root.scopeAt(line, offset); cur != nil && cur.kind == scopeComprehension; cur = cur.parent {
+		for name := range cur.bindings {
+			delete(names, name)
+		}
+	}
+	return names
+}
+
+// hex literals, hashes and base64 blobs get indexed like any other word, they're kept but never ranked above a real name
+func isNoisyWord(word string, opts Options) bool {
+	if opts.NoisyWordLength > 0 && len(word) > opts.NoisyWordLength {
+		return true
+	}
+	if len(word) < 8 {
+		return false
+	}
+	letters, digits := 0, 0
+	for _, c := range word {
+		if unicode.IsLetter(c) {
+			letters++
+		}else if unicode.IsDigit(c) {
+			digits++
+		}
+	}
+	return letters+digits > 0 && float64(letters) < opts.NoisyWordLetterRatio*float64(letters+digits)
+}
+
+func demoteNoisy(bucket func(string) int, opts Options) func(string) int {
+	return func(word string) int {
+		if isNoisyWord(word, opts) {
+			return bucketBottom
+		}
+		return bucket(word)
+	}
+}
+
+var decoratorLineRe = regexp.MustCompile(`^\s*(@?)\w*$`)
+
+// typing a property's name (or `@` and its name) directly in the class body offers the setter and deleter
+// that don't exist yet as ready made definitions
+func propertyAccessorCompletions(lines []string, content string, cc completionContext) []CompletionItem {
+	m := decoratorLineRe.FindStringSubmatch(cc.lineText[:cc.offset])
+	if m == nil {
+		return nil
+	}
+	cls, ok := enclosingClass(lines, cc.line)
+	if !ok {
+		return nil
+	}
+	body := classBodyLines(lines, cls)
+	if len(body) == 0 || indentOf(lines[body[0]]) != indentOf(cc.lineText) {
+		return nil
+	}
+
+	existing := make(map[string]bool)
+	for _, i := range body {
+		if d := decoratorRe.FindStringSubmatch(lines[i]); d != nil {
+			existing[d[1]] = true
+		}
+	}
+
+	items := make([]CompletionItem, 0)
+	for _, name := range findPropertyNames(content, cls.name) {
+		accessors := []struct{ decorator, signature, body string }{
+			{name + ".setter", "def " + name + "(self, value):", "${1:self._" + name + " = value}"},
+			{name + ".deleter", "def " + name + "(self):", "${1:del self._" + name + "}"},
+		}
+		for _, acc := range accessors {
+			if existing[acc.decorator] { continue }
+			insert := "@" + acc.decorator + "\n" + acc.signature + "\n    " + acc.body + "$0"
+			if m[1] == "@" { // already typed, it stays in front of the replaced word
+				insert = insert[1:]
+			}
+			items = append(items, CompletionItem{ Label: "@" + acc.decorator, Kind: 2, InsertText: insert, InsertTextFmt: 2, Detail: acc.signature })
+		}
+	}
+	return items
+}
+
+var dunderLineRe = regexp.MustCompile(`^\s*(def\s+)?__\w*$`)
+
+// the special methods people write by hand, parameters after the first become placeholders
+var dunderMethods = []struct{ name, params, returns string }{
+	{"__init__", "self", "None"},
+	{"__repr__", "self", "str"},
+	{"__str__", "self", "str"},
+	{"__eq__", "self, other", "bool"},
+	{"__ne__", "self, other", "bool"},
+	{"__lt__", "self, other", "bool"},
+	{"__le__", "self, other", "bool"},
+	{"__gt__", "self, other", "bool"},
+	{"__ge__", "self, other", "bool"},
+	{"__hash__", "self", "int"},
+	{"__bool__", "self", "bool"},
+	{"__len__", "self", "int"},
+	{"__iter__", "self", "Iterator"},
+	{"__next__", "self", ""},
+	{"__contains__", "self, item", "bool"},
+	{"__getitem__", "self, key", ""},
+	{"__setitem__", "self, key, value", "None"},
+	{"__delitem__", "self, key", "None"},
+	{"__call__", "self, *args, **kwargs", ""},
+	{"__enter__", "self", ""},
+	{"__exit__", "self, exc_type, exc_value, traceback", "bool | None"},
+	{"__getattr__", "self, name", ""},
+	{"__setattr__", "self, name, value", "None"},
+	{"__add__", "self, other", ""},
+	{"__sub__", "self, other", ""},
+	{"__mul__", "self, other", ""},
+	{"__new__", "cls, *args, **kwargs", ""},
+	{"__init_subclass__", "cls, **kwargs", "None"},
+	{"__post_init__", "self", "None"},
+}
+
+// `__` directly in a class body offers the special methods it doesn't define yet as whole defs, `__` at the
+// top of a module offers __all__
+func dunderCompletions(lines []string, cc completionContext) []CompletionItem {
+	m := dunderLineRe.FindStringSubmatch(cc.lineText[:cc.offset])
+	if m == nil {
+		return nil
+	}
+	items := make([]CompletionItem, 0)
+
+	cls, ok := enclosingClass(lines, cc.line)
+	if !ok {
+		if indentOf(cc.lineText) > 0 || m[1] != "" {
+			return nil
+		}
+		for i, line := range lines {
+			if i != cc.line && strings.HasPrefix(line, "__all__") {
+				return nil
+			}
+		}
+		insert := "__all__ = [$0]"
+		if !clientSnippetSupport {
+			insert = "__all__"
+		}
+		return append(items, CompletionItem{ Label: "__all__", Kind: 6, InsertText: insert, InsertTextFmt: 2, Detail: "__all__: list[str]", Documentation: "The names `from module import *` takes." })
+	}
+	body := classBodyLines(lines, cls)
+	if len(body) == 0 || indentOf(lines[body[0]]) != indentOf(cc.lineText) {
+		return nil
+	}
+
+	existing := make(map[string]bool)
+	for _, i := range body {
+		if d := defHeaderRe.FindStringSubmatch(lines[i]); d != nil {
+			existing[d[2]] = true
+		}
+	}
+	for _, d := range dunderMethods {
+		if existing[d.name] { continue }
+		signature := "def " + d.name + "(" + d.params + ")"
+		if d.returns != "" {
+			signature += " -> " + d.returns
+		}
+
+		params := strings.Split(d.params, ", ")
+		for i := 1; i < len(params); i++ {
+			params[i] = "${" + strconv.Itoa(i) + ":" + escapeSnippet(params[i]) + "}"
+		}
+		if len(params) == 1 && d.name == "__init__" {
+			params = append(params, "$1")
+		}
+		insert := "def " + d.name + "(" + strings.Join(params, ", ") + "):\n    ${" + strconv.Itoa(len(params)) + ":pass}$0"
+		if m[1] != "" { // the def is already typed
+			insert = strings.TrimPrefix(insert, "def ")
+		}
+		item := CompletionItem{ Label: d.name, Kind: 2, InsertText: insert, InsertTextFmt: 2, Detail: signature }
+		if !clientSnippetSupport {
+			item.InsertText, item.InsertTextFmt = d.name, 1
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+var awaitBeforeRe = regexp.MustCompile(`\bawait\s*$`)
+
+var overrideDefRe = regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)\s*\(([^)]*)$`)
+
+// while typing the parameter list of a method, the parameters the same method takes in a base class, as written
+// there. textual: the bases are found by name in this document and then the other open ones, and only a parameter
+// list that's still on the def line counts
+func overrideParamCompletions(file OpenFile, lines []string, cc completionContext, files map[string]OpenFile) []CompletionItem {
+	m := overrideDefRe.FindStringSubmatch(cc.lineText[:cc.offset-len(cc.tocomplete)])
+	if m == nil {
+		return nil
+	}
+	cls, ok := enclosingClass(lines, cc.line)
+	if !ok {
+		return nil
+	}
+	owner, fn := baseMethod(file.uri, files, cls.bases, m[1], map[string]bool{cls.name: true})
+	if fn == nil {
+		return nil
+	}
+
+	typed := make(map[string]bool)
+	for _, part := range strings.Split(m[2], ",") {
+		name := strings.TrimLeft(strings.TrimSpace(part), "*")
+		if i := strings.IndexAny(name, ":= "); i >= 0 {
+			name = name[:i]
+		}
+		typed[name] = true
+	}
+	items := make([]CompletionItem, 0)
+	for _, p := range fn.params {
+		if p.name == "self" || p.name == "cls" || typed[p.name] { continue }
+		text := p.star + p.name
+		if p.annotation != "" {
+			text += ": " + p.annotation
+		}
+		if p.value != "" && p.annotation != "" {
+			text += " = " + p.value
+		}else if p.value != "" {
+			text += "=" + p.value
+		}
+		items = append(items, CompletionItem{ Label: p.name, FilterText: p.name, Kind: 6, InsertText: text, InsertTextFmt: 1, Detail: text, LabelDetails: &CompletionItemLabelDetails{Description: owner + "." + m[1]} })
+	}
+	return items
+}
+
+// the def of method in the first of bases (or their bases) that has one, with the class it's in
+func baseMethod(uri string, files map[string]OpenFile, bases []string, method string, visited map[string]bool) (string, *scope) {
+	uris := []string{uri}
+	for _, u := range pythonURIs(files) {
+		if u != uri {
+			uris = append(uris, u)
+		}
+	}
+	for _, base := range bases {
+		base = base[strings.LastIndexByte(base, '.')+1:] // `models.Model` is looked for as Model
+		if visited[base] { continue }
+		visited[base] = true
+		for _, u := range uris {
+			f, ok := files[u]
+			if !ok { continue }
+			for _, c := range analyzeScopes(f.content).children {
+				if c.kind != scopeClass || c.name != base { continue }
+				for _, fn := range c.children {
+					if fn.kind == scopeFunction && fn.name == method {
+						return base, fn
+					}
+				}
+				if info, ok := findClass(splitLines(f.content), base); ok {
+					if owner, fn := baseMethod(u, files, info.bases, method, visited); fn != nil {
+						return owner, fn
+					}
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+var docstringOpenRe = regexp.MustCompile(`^\s*[rRuU]?("""|''')$`)
+
+// `"""` as the first thing in a def's body completes to a docstring with the parameters filled in
+func docstringCompletion(content string, cc completionContext) (CompletionItem, bool) {
+	m := docstringOpenRe.FindStringSubmatch(cc.lineText[:cc.offset])
+	if m == nil {
+		return CompletionItem{}, false
+	}
+	fn := analyzeScopes(content).scopeAt(cc.line, cc.offset)
+	if fn.kind != scopeFunction {
+		return CompletionItem{}, false
+	}
+	
+	// nothing between the header and here, the header itself may span lines
+	lines := splitLines(content)
+	header := cc.line - 1
+	for header > fn.line && isBlankLine(lines[header]) {
+		header--
+	}
+	if header < fn.line || !strings.HasSuffix(strings.TrimSpace(lines[header]), ":") {
+		return CompletionItem{}, false
+	}
+	for i := fn.line; i < header; i++ {
+		if strings.HasSuffix(strings.TrimSpace(lines[i]), ":") {
+			return CompletionItem{}, false
+		}
+	}
+	
+	body := []string{"${1:Summary.}", ""}
+	for _, p := range fn.params {
+		if p.name == "self" || p.name == "cls" { continue }
+		body = append(body, ":param "+p.name+": ${"+strconv.Itoa(len(body))+"}")
+	}
+	if fn.returns != "None" && fn.name != "__init__" {
+		body = append(body, ":return: ${"+strconv.Itoa(len(body))+"}")
+	}
+	if len(body) == 2 {
+		return CompletionItem{}, false // a one line docstring needs no template
+	}
+	quote := m[1]
+	if !strings.HasPrefix(cc.lineText[cc.offset:], quote) { // the editor may have closed it already
+		body = append(body, quote)
+	}
+	return CompletionItem{ Label: quote + " docstring", Kind: 15, InsertText: strings.Join(body, "\n") + "$0", InsertTextFmt: 2, Detail: "def " + fn.name + fn.signature() }, true
+}
+
+var importPathRe = regexp.MustCompile(`^\s*(?:import\s+(?:[\w.]+(?:\s+as\s+\w+)?\s*,\s*)*|from\s+)[\w.]*$`)
+var fromImportNamesRe = regexp.MustCompile(`^\s*from\s+([\w.]+)\s+import\s+\(?\s*(?:\w+(?:\s+as\s+\w+)?\s*,\s*)*\w*$`)
+
+// module names while typing an import, and what the module exports after `from x import`
+func importCompletions(cc completionContext) []CompletionItem {
+	before := cc.lineText[:cc.offset]
+	items := make([]CompletionItem, 0)
+
+	if m := fromImportNamesRe.FindStringSubmatch(before); m != nil {
+		if m[1] == "__future__" {
+			return append(items, futureImports...)
+		}
+		for _, e := range getPackageExports(m[1]) {
+			items = append(items, stubItem(e))
+		}
+		for _, e := range stubMembers(m[1]) {
+			items = append(items, stubItem(e))
+		}
+		return items
+	}
+
+	if !importPathRe.MatchString(before) {
+		return nil
+	}
+	parent := strings.Join(cc.leadup, ".")
+	for _, name := range sitePackageChildren(parent) {
+		item := CompletionItem{ Label: name, Kind: 9, InsertText: name, InsertTextFmt: 1 }
+		if pkg, ok := getSitePackage(strings.TrimPrefix(parent+"."+name, ".")); ok && pkg.dist != "" {
+			item.LabelDetails = &CompletionItemLabelDetails{Description: pkg.dist}
+		}
+		items = append(items, item)
+	}
+	for _, name := range stubChildren(parent) {
+		items = append(items, CompletionItem{ Label: name, Kind: 9, InsertText: name, InsertTextFmt: 1 })
+	}
+	return items
+}
+
+var subscriptKeyRe = regexp.MustCompile(`(\w+)\s*\[\s*["'](\w*)$`)
+
+// `movie["ti` where movie is declared as a TypedDict completes the declared keys
+func typedDictKeyCompletions(content string, cc completionContext) []CompletionItem {
+	m := subscriptKeyRe.FindStringSubmatch(cc.lineText[:cc.offset])
+	if m == nil {
+		return nil
+	}
+	typeName := baseName(declaredType(content, m[1]))
+	keys := findTypedDictKeys(content, typeName)
+	if len(keys) == 0 {
+		return nil
+	}
+	
+	lines := splitLines(content)
+	cls, _ := findClass(lines, typeName)
+	types := make(map[string]string)
+	for _, f := range classFields(lines, cls) {
+		types[f.name] = f.annotation
+	}
+	
+	items := make([]CompletionItem, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, CompletionItem{ Label: key, Kind: 10, InsertText: key, InsertTextFmt: 1, Detail: types[key] })
+	}
+	return items
+}
+
+var columnCallRe = regexp.MustCompile(`(?:^|\W)(?:\w+\.)?(?:Column|mapped_column)$`)
+
+// the type arguments inside `Column(` or `mapped_column(` of a file using sqlalchemy
+func columnTypeCompletions(content string, cc completionContext) []CompletionItem {
+	if len(cc.leadup) > 0 {
+		return nil
+	}
+	open := -1
+	for i := cc.offset - len(cc.tocomplete) - 1; i >= 0 && open < 0; i-- {
+		switch cc.lineText[i] {
+		case ')', ']', '}':
+			if i = matchingOpen(cc.lineText, i); i < 0 {
+				return nil
+			}
+		case '(':
+			open = i
+		case '[', '{':
+			return nil
+		}
+	}
+	if open < 0 || !columnCallRe.MatchString(strings.TrimRight(cc.lineText[:open], " ")) {
+		return nil
+	}
+	usesSqlalchemy := false
+	for _, origin := range fileImports(content) {
+		usesSqlalchemy = usesSqlalchemy || origin == "sqlalchemy" || strings.HasPrefix(origin, "sqlalchemy.")
+	}
+	if !usesSqlalchemy {
+		return nil
+	}
+	return sqlalchemyColumnTypes
+}
+
+func buildCompletions(file OpenFile, cc completionContext, opts Options) (items []CompletionItem, incomplete bool) {
+	set := newCompletionSet(cc.tocomplete)
+	set.details = opts.Completion.ShowDetail
+	if file.tooLarge {
+		set.addExtraBuiltins(constantBucket(bucketDefault))
+		set.addWords(getExtraWords(), constantBucket(bucketDefault))
+		set.addBuiltins(cc, constantBucket(bucketDefault))
+		return set.items, false
+	}
+	if opts.MemberCompletion == "flat" { // `obj.na` is just `na` as far as completion goes
+		cc.leadup = nil
+	}
+	
+	// inside the quotes of a TypedDict subscript the keys are the only sensible answers
+	if keys := typedDictKeyCompletions(file.content, cc); len(keys) > 0 {
+		for _, item := range keys {
+			set.add(item, bucketPinned, 0)
+		}
+		return set.items, false
+	}
+	
+	if opts.Completion.Docstrings && clientSnippetSupport {
+		if template, ok := docstringCompletion(file.content, cc); ok {
+			set.add(template, bucketPinned, 0)
+			return set.items, false
+		}
+	}
+	
+	if opts.Completion.OverrideParams {
+		for _, item := range overrideParamCompletions(file, splitLines(file.content), cc, snapshotFiles()) {
+			set.add(item, bucketPinned, 0)
+		}
+	}
+	
+	if types := columnTypeCompletions(file.content, cc); len(types) > 0 {
+		for _, item := range types {
+			set.add(item, bucketPinned, 0)
+		}
+	}
+	
+	if modules := importCompletions(cc); len(modules) > 0 {
+		for _, item := range modules {
+			set.add(item, bucketPinned, 0)
+		}
+		return set.items, false
+	}
+	
+	lines := splitLines(file.content)
+	if len(cc.leadup) > 0 {
+		if members := memberCompletions(lines, file, cc); len(members) > 0 {
+			for _, item := range members {
+				if item.InsertTextFmt == 2 && !clientSnippetSupport {
+					item.InsertText, item.InsertTextFmt = item.Label, 1
+				}
+				set.add(item, bucketPinned, 0)
+			}
+			// a module's members the table or stubs don't know about but the code uses anyway
+			if importedName(file.content, cc.leadup[0]) != "" {
+				set.addWords(receiverAttributes(snapshotFiles(), strings.Join(cc.leadup, ".")), constantBucket(bucketDocument))
+			}
+			return set.items, false
+		}
+		// no idea what the receiver is: what this same receiver was followed by elsewhere, or failing that names
+		// used after any dot are still a far better guess than any word
+		files := snapshotFiles()
+		set.addWords(receiverAttributes(files, strings.Join(cc.leadup, ".")), constantBucket(bucketPinned))
+		if base := aliasOf(file.content, cc.leadup[0]); base != "" {
+			set.addWords(receiverAttributes(files, strings.Join(append([]string{base}, cc.leadup[1:]...), ".")), constantBucket(bucketPinned))
+		}
+		if len(set.items) > 0 {
+			return set.items, false
+		}
+		set.addWords(observedAttributes(files), constantBucket(bucketDefault))
+		if len(set.items) > 0 {
+			return set.items, false
+		}
+	}
+	
+	root := analyzeScopes(file.content)
+	set.hidden = comprehensionOnlyNames(root, cc.line, cc.offset)
+	if opts.Completion.DemoteUnusedImports {
+		set.demoted = unusedModuleImports(file)
+	}
+	
+	// these may only show up once in the whole file but right here they're the most likely thing being typed
+	for _, name := range comprehensionVariables(cc.lineText, cc.offset) {
+		set.add(CompletionItem{ Label: name, Kind: 6, InsertText: name, InsertTextFmt: 1, Detail: "comprehension variable" }, bucketPinned, 0)
+	}
+	
+	for _, b := range enclosingBindings(root, lines, cc) {
+		set.add(CompletionItem{ Label: b.name, Kind: 6, InsertText: b.name, InsertTextFmt: 1, Detail: bindingDetail[b.kind] }, bucketPinned, file.words.count(b.name))
+	}
+	
+	for _, item := range propertyAccessorCompletions(lines, file.content, cc) {
+		set.add(item, bucketPinned, 0)
+	}
+	for _, item := range dunderCompletions(lines, cc) {
+		set.add(item, bucketPinned, 0)
+	}
+	
+	if cls, ok := enclosingClass(lines, cc.line); ok && isEnumClass(cls) {
+		for _, item := range enumCompletions(lines, cls) {
+			bucket := bucketPinned
+			if strings.HasPrefix(item.Label, "_") { // the machinery is there for every enum, the members are the point
+				bucket = bucketDefault
+			}
+			set.add(item, bucket, 0)
+		}
+	}
+	
+	// ahead of the words, a name used here but defined elsewhere is exactly the one that needs importing
+	if opts.Completion.AutoImport && len(cc.leadup) == 0 && cc.tocomplete != "" {
+		for _, item := range autoImportCompletions(file.uri, file.content, root, cc, snapshotFiles()) {
+			set.add(item, bucketDefault, 0)
+		}
+	}
+	
+	if cc.tocomplete == "" {
+		set.addExtraBuiltins(constantBucket(bucketBuiltin))
+		set.addWordCounts(file.words, demoteNoisy(documentWordBucket(root, cc), opts))
+		set.addWords(getExtraWords(), constantBucket(bucketBuiltin))
+		set.addBuiltins(cc, constantBucket(bucketBuiltin))
+	}else{
+		set.addExtraBuiltins(constantBucket(bucketDefault))
+		set.addWordCounts(file.words, demoteNoisy(constantBucket(bucketDefault), opts))
+		set.addWords(getExtraWords(), constantBucket(bucketDefault))
+		set.addBuiltins(cc, constantBucket(bucketDefault))
+	}
+	
+	// not for `f|(` where the call is already there
+	if opts.Completion.CallSnippets && clientSnippetSupport && len(cc.leadup) == 0 && !strings.HasPrefix(cc.lineText[cc.offset:], "(") {
+		awaiting := false
+		if fn := root.scopeAt(cc.line, cc.offset).enclosingFunction(); fn != nil && fn.isAsync {
+			awaiting = !awaitBeforeRe.MatchString(cc.lineText[:cc.offset-len(cc.tocomplete)])
+		}
+		set.addCallSnippets(callableFunctions(file.uri, root, snapshotFiles()), awaiting)
+	}
+	
+	if len(set.items) == 0 && cc.tocomplete != "" && opts.FallbackOnEmpty {
+		// a brand new identifier, keep the menu alive and have the client ask again as typing continues
+		return fallbackCompletions(file, cc, opts), true
+	}
+	
+	return set.items, false
+}
+
+func fallbackCompletions(file OpenFile, cc completionContext, opts Options) []CompletionItem {
+	type candidate struct {
+		word   string
+		freq   int64
+		detail string
+	}
+	candidates := make([]candidate, 0, file.words.len()+len(defaultCompletions))
+	seen := make(map[string]bool)
+	consider := func(key string, value int64, detail string) {
+		if key == cc.tocomplete || seen[key] { return }
+		seen[key] = true
+		if !opts.Completion.ShowDetail {
+			detail = ""
+		}
+		candidates = append(candidates, candidate{key, value, detail})
+	}
+	file.words.each(func(key string, value int64) { consider(key, value, usesDetail(value)) })
+	for key, value := range getExtraWords() {
+		consider(key, value, "")
+	}
+	for key, value := range defaultCompletions {
+		consider(key, value, builtinDetail(key))
+	}
+	
+	sort.Slice(candidates, func(i, j int) bool {
+		if noisyI, noisyJ := isNoisyWord(candidates[i].word, opts), isNoisyWord(candidates[j].word, opts); noisyI != noisyJ {
+			return noisyJ
+		}
+		if candidates[i].freq != candidates[j].freq {
+			return candidates[i].freq > candidates[j].freq
+		}
+		return candidates[i].word < candidates[j].word
+	})
+	if len(candidates) > fallbackLimit {
+		candidates = candidates[:fallbackLimit]
+	}
+	
+	items := make([]CompletionItem, 0, len(candidates))
+	for _, c := range candidates {
+		bucket := bucketDefault
+		if isNoisyWord(c.word, opts) {
+			bucket = bucketBottom
+		}
+		items = append(items, CompletionItem{ Label: c.word, Kind: 3, InsertText: c.word, InsertTextFmt: 1, SortText: rankSortText(bucket, 0, c.freq), Detail: c.detail })
+	}
+	return items
+}
+
+// the class's own members plus what the Enum machinery gives every member
+func enumCompletions(lines []string, cls classInfo) []CompletionItem {
+	items := make([]CompletionItem, 0)
+	for _, m := range enumMembers(lines, cls) {
+		items = append(items, CompletionItem{ Label: m.name, Kind: 13, InsertText: m.name, InsertTextFmt: 1, Detail: cls.name + "." + m.name + " = " + m.value })
+	}
+	items = append(items,
+		CompletionItem{ Label: "__members__", Kind: 10, InsertText: "__members__", InsertTextFmt: 1, Detail: "mappingproxy[str, " + cls.name + "]" },
+		CompletionItem{ Label: "_value_", Kind: 5, InsertText: "_value_", InsertTextFmt: 1, Detail: "enum member value" },
+		CompletionItem{ Label: "_name_", Kind: 5, InsertText: "_name_", InsertTextFmt: 1, Detail: "enum member name" },
+	)
+	return items
+}
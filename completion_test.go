@@ -0,0 +1,547 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a position past the end comes in while edits are in flight, it's read as the end of the document
+func TestCompletionPastTheEnd(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///short.py"
+	c.open(uri, "total = 1\nto")
+
+	for _, pos := range []Position{{2, 0}, {7, 3}, {1, 99}} {
+		var list CompletionList
+		err := c.callErr("textDocument/completion", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": pos}, &list)
+		if err != nil {
+			t.Fatalf("completion at %v: %v", pos, err)
+		}
+		if list.Items == nil {
+			t.Errorf("completion at %v: no items array", pos)
+		}
+		if _, ok := findItem(list.Items, "total"); !ok {
+			t.Errorf("completion at %v: total missing from %v", pos, labels(list.Items))
+		}
+	}
+}
+
+func TestCompletionContextClamps(t *testing.T) {
+	content := "first\nsecond = fi"
+	for _, pos := range []Position{{5, 0}, {1, 50}, {-3, 0}} {
+		cc := getCompletionContext(content, pos.Line, pos.Character)
+		if cc.line < 0 || cc.line > 1 || cc.offset < 0 || cc.offset > len(cc.lineText) {
+			t.Errorf("getCompletionContext at %v = line %d offset %d of %q", pos, cc.line, cc.offset, cc.lineText)
+		}
+	}
+	if cc := getCompletionContext(content, 9, 0); cc.tocomplete != "fi" {
+		t.Errorf("past the end completes %q, want the end of the last line's fi", cc.tocomplete)
+	}
+}
+
+// a brand new identifier matches nothing, the most frequent words keep the menu open and the list is marked
+// incomplete so the client asks again as typing goes on
+func TestCompletionFallbackOnEmpty(t *testing.T) {
+	uri := "file:///fallback.py"
+	text := strings.Repeat("alpha += 1\n", 12) + "qqzx" // more uses than a builtin has
+
+	c := newTestServer(t, nil, nil)
+	c.open(uri, text)
+	list := c.completion(uri, 12, 4)
+	if !list.IsIncomplete || len(list.Items) == 0 || len(list.Items) > fallbackLimit {
+		t.Fatalf("fallback: incomplete %v with %d items, want incomplete and 1 to %d items", list.IsIncomplete, len(list.Items), fallbackLimit)
+	}
+	if _, ok := findItem(list.Items, "alpha"); !ok {
+		t.Errorf("alpha missing from the fallback %v", labels(list.Items))
+	}
+	if _, ok := findItem(list.Items, "qqzx"); ok {
+		t.Error("the fallback offers what's being typed")
+	}
+
+	c = newTestServer(t, map[string]any{"fallbackOnEmpty": false}, nil)
+	c.open(uri, text)
+	if list := c.completion(uri, 12, 4); list.IsIncomplete || len(list.Items) != 0 {
+		t.Errorf("fallbackOnEmpty off: incomplete %v with %v, want an empty complete list", list.IsIncomplete, labels(list.Items))
+	}
+}
+
+// opens testdata/completion/<name> with its `|` taken out and completes where it was
+func completeFixture(t *testing.T, c *testClient, name string) CompletionList {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "completion", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	at := strings.Index(text, "|")
+	if at < 0 {
+		t.Fatalf("%s has no | for the cursor", name)
+	}
+	before := text[:at]
+	line := strings.Count(before, "\n")
+	character := at - strings.LastIndex(before, "\n") - 1
+	uri := "file:///" + name
+	c.open(uri, before+text[at+1:])
+	return c.completion(uri, line, character)
+}
+
+// with nothing typed: the function's parameters, what the document defines, the function's locals, other words
+// of the document, builtins. frequency only orders within each of those
+func TestEmptyPrefixOrder(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	list := completeFixture(t, c, "empty_prefix.py")
+	order := []string{"url", "fetch", "response", "changelog", "len"}
+	for i := 0; i+1 < len(order); i++ {
+		assertRanksAbove(t, list, order[i], order[i+1])
+	}
+	for _, defined := range []string{"Session", "RETRIES"} {
+		assertRanksAbove(t, list, defined, "response")
+	}
+	assertRanksAbove(t, list, "attempt", "changelog")
+}
+
+// hashes and blobs are kept but go to the bottom, below builtins
+func TestLongHexLiteralRanksLast(t *testing.T) {
+	hex := "a3f9b2c4d5e6f708192837465564738291a3f9b2c4d5e6f708"
+	text := "digest = '" + hex + "'\nother = '" + hex + "'\nassert digest == '" + hex + "'\n"
+	c := newTestServer(t, nil, nil)
+	uri := "file:///hashes.py"
+	c.open(uri, text+"\n")
+	items := sortedItems(c.completion(uri, 3, 0))
+	if len(items) == 0 || items[len(items)-1].Label != hex {
+		t.Errorf("the hex literal isn't last: %v", labels(items[max(0, len(items)-3):]))
+	}
+	if _, ok := findItem(items, "digest"); !ok {
+		t.Error("digest missing")
+	}
+	assertRanksAbove(t, c.completion(uri, 3, 0), "len", hex)
+
+	// both heuristics are settings, off they leave it where its three uses put it
+	c = newTestServer(t, map[string]any{"noisyWordLength": 0, "noisyWordLetterRatio": 0}, nil)
+	c.open(uri, text+"\n")
+	assertRanksAbove(t, c.completion(uri, 3, 0), hex, "len")
+}
+
+func TestIsNoisyWord(t *testing.T) {
+	opts := defaultOptions()
+	for _, word := range []string{"a3f9b2c4d5e6f70819", "0123456789abcdef", strings.Repeat("abcdefghij", 5)} {
+		if !isNoisyWord(word, opts) {
+			t.Errorf("%q isn't noisy", word)
+		}
+	}
+	for _, word := range []string{"x1", "sha256", "base64", "utf8", "http2_client", "response_handler", "v2"} {
+		if isNoisyWord(word, opts) {
+			t.Errorf("%q is noisy", word)
+		}
+	}
+}
+
+// route and other are each written twice, route once as a decorator
+func TestDecoratedNameRanksAbovePlain(t *testing.T) {
+	text := "def route(f):\n    return f\n\ndef other(f):\n    return f\n\n@route\ndef index():\n    pass\n\nhandler = other(index)\n"
+	words := getWords(&text)
+	if words["route"] != 2+decoratorBoost || words["other"] != 2 {
+		t.Errorf("route counted %d and other %d, want %d and 2", words["route"], words["other"], 2+decoratorBoost)
+	}
+
+	c := newTestServer(t, nil, nil)
+	uri := "file:///routes.py"
+	c.open(uri, text+"r")
+	assertRanksAbove(t, c.completion(uri, 11, 1), "route", "other")
+	c.change(uri, 2, text) // nothing typed
+	assertRanksAbove(t, c.completion(uri, 11, 0), "route", "other")
+}
+
+// a picked completion floats up, whether the pick comes as a notification or as a request. the request gets an
+// answer
+func TestCompletionChosen(t *testing.T) {
+	text := "fetch_all = load()\nfetch_rows = load()\nfetch_all(fetch_rows)\nfe"
+	uri := "file:///chosen.py"
+	for _, asRequest := range []bool{false, true} {
+		c := newTestServer(t, nil, nil)
+		c.open(uri, text)
+		low := "fetch_rows"
+		if items := sortedItems(c.completion(uri, 3, 2)); len(items) > 0 && items[0].Label == low {
+			low = "fetch_all"
+		}
+
+		params := map[string]any{"label": low}
+		if asRequest {
+			c.call("pypls/completionChosen", params, nil)
+		}else{
+			c.notify("pypls/completionChosen", params)
+		}
+		other := map[string]string{"fetch_rows": "fetch_all", "fetch_all": "fetch_rows"}[low]
+		assertRanksAbove(t, c.completion(uri, 3, 2), low, other)
+	}
+}
+
+var snippetCapabilities = map[string]any{"textDocument": map[string]any{"completion": map[string]any{"completionItem": map[string]any{"snippetSupport": true}}}}
+
+func TestBlockKeywordCompletion(t *testing.T) {
+	text := "if ready:\n    pass\nel\nvalue = a if b el\ntr\n"
+	tests := []struct {
+		line, character int
+		label           string
+		plain, snippet  string
+	}{
+		{2, 2, "else", "else:", "else:$0"},
+		{2, 2, "elif", "elif", "elif ${1:condition}:$0"},
+		{4, 2, "try", "try:", "try:$0"},
+		{3, 17, "else", "else", "else"}, // mid expression, the bare word
+	}
+	for _, snippets := range []bool{false, true} {
+		var capabilities any
+		if snippets {
+			capabilities = snippetCapabilities
+		}
+		c := newTestServer(t, nil, capabilities)
+		uri := "file:///blocks.py"
+		c.open(uri, text)
+		for _, tt := range tests {
+			item, ok := findItem(c.completion(uri, tt.line, tt.character).Items, tt.label)
+			want, format := tt.plain, 1
+			if snippets {
+				want = tt.snippet
+				if want != tt.label {
+					format = 2
+				}
+			}
+			if !ok || item.InsertText != want || item.InsertTextFmt != format {
+				t.Errorf("snippets %v, %s at %d:%d: %q format %d, want %q format %d", snippets, tt.label, tt.line, tt.character, item.InsertText, item.InsertTextFmt, want, format)
+			}
+		}
+	}
+}
+
+// maxSize is used far more, the screaming prefix still puts MAX_SIZE first
+func TestScreamingPrefixPrefersScreamingNames(t *testing.T) {
+	text := "MAX_SIZE = 10\nmaxSize = 5\n" + strings.Repeat("print(maxSize)\n", 8)
+	c := newTestServer(t, nil, nil)
+	uri := "file:///styles.py"
+	for _, prefix := range []string{"MAX_", "MAX"} {
+		c.open(uri, text+prefix+"\n")
+		list := c.completion(uri, 10, len(prefix))
+		if _, ok := findItem(list.Items, "MAX_SIZE"); !ok {
+			t.Fatalf("%s: MAX_SIZE missing from %v", prefix, labels(list.Items))
+		}
+		if _, ok := findItem(list.Items, "maxSize"); ok || prefix == "MAX" {
+			assertRanksAbove(t, list, "MAX_SIZE", "maxSize")
+		}
+	}
+	// without a style in the prefix frequency decides
+	c.open(uri, text+"max\n")
+	assertRanksAbove(t, c.completion(uri, 10, 3), "maxSize", "MAX_SIZE")
+}
+
+// with the capability the typed prefix goes once in itemDefaults.editRange, without it every item has the range
+func TestSharedEditRange(t *testing.T) {
+	text := "value = 1\nx = val\n"
+	want := Range{Position{1, 4}, Position{1, 7}}
+	uri := "file:///ranges.py"
+
+	capabilities := map[string]any{"textDocument": map[string]any{"completion": map[string]any{"completionList": map[string]any{"itemDefaults": []string{"editRange"}}}}}
+	c := newTestServer(t, nil, capabilities)
+	c.open(uri, text)
+	list := c.completion(uri, 1, 7)
+	if list.ItemDefaults == nil || list.ItemDefaults.EditRange != want {
+		t.Errorf("itemDefaults = %+v, want editRange %v", list.ItemDefaults, want)
+	}
+	if len(list.Items) == 0 {
+		t.Fatal("no items")
+	}
+	for _, item := range list.Items {
+		if item.TextEdit != nil {
+			t.Errorf("%s has its own textEdit with the shared range sent", item.Label)
+		}
+	}
+
+	c = newTestServer(t, nil, nil)
+	c.open(uri, text)
+	list = c.completion(uri, 1, 7)
+	if list.ItemDefaults != nil {
+		t.Errorf("itemDefaults sent to a client without the capability: %+v", list.ItemDefaults)
+	}
+	for _, item := range list.Items {
+		if item.TextEdit == nil || item.TextEdit.Range != want || item.TextEdit.NewText != item.InsertText {
+			t.Errorf("%s: textEdit = %+v, want %v replaced with %q", item.Label, item.TextEdit, want, item.InsertText)
+		}
+	}
+}
+
+// special methods only directly in a class body and only those it doesn't define yet, __all__ only at the top
+// of a module
+func TestDunderCompletion(t *testing.T) {
+	uri := "file:///dunder.py"
+	isDef := func(items []CompletionItem, name string) bool {
+		item, ok := findItem(items, name)
+		return ok && strings.HasPrefix(item.Detail, "def ")
+	}
+
+	c := newTestServer(t, nil, snippetCapabilities)
+	c.open(uri, "class Point:\n    def __init__(self, x):\n        self.x = x\n\n    __\n")
+	items := c.completion(uri, 4, 6).Items
+	repr, _ := findItem(items, "__repr__")
+	if repr.InsertTextFmt != 2 || !strings.HasPrefix(repr.InsertText, "def __repr__(self):\n") || !strings.HasSuffix(repr.InsertText, "${1:pass}$0") || repr.Detail != "def __repr__(self) -> str" {
+		t.Errorf("__repr__ = %+v", repr)
+	}
+	if eq, _ := findItem(items, "__eq__"); !strings.HasPrefix(eq.InsertText, "def __eq__(self, ${1:other}):") {
+		t.Errorf("__eq__ inserts %q", eq.InsertText)
+	}
+	if isDef(items, "__init__") {
+		t.Error("__init__ offered in a class that defines it")
+	}
+	if _, ok := findItem(items, "__all__"); ok {
+		t.Error("__all__ offered in a class body")
+	}
+
+	c.open(uri, "import os\n\n__\n")
+	items = c.completion(uri, 2, 2).Items
+	if all, ok := findItem(items, "__all__"); !ok || all.InsertText != "__all__ = [$0]" {
+		t.Errorf("__all__ at module level = %+v, %v", all, ok)
+	}
+	if isDef(items, "__repr__") {
+		t.Error("__repr__ offered at module level")
+	}
+
+	c.open(uri, "def f():\n    __\n")
+	items = c.completion(uri, 1, 6).Items
+	if isDef(items, "__repr__") {
+		t.Error("__repr__ offered inside a function")
+	}
+	if _, ok := findItem(items, "__all__"); ok {
+		t.Error("__all__ offered inside a function")
+	}
+}
+
+// stream is used once, settings 30 times at module level. inside read the parameter, self and the names the
+// enclosing blocks bind come first anyway
+func TestParametersRankAboveFrequentNames(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	list := completeFixture(t, c, "params_first.py")
+	for _, name := range []string{"stream", "self"} {
+		assertRanksAbove(t, list, name, "settings")
+	}
+	c.open("file:///params_first_bare.py", "settings = 1\n"+strings.Repeat("print(settings)\n", 29)+"\ndef read(stream, entries):\n    for entry in entries:\n        \n")
+	list = c.completion("file:///params_first_bare.py", 33, 8)
+	for _, name := range []string{"stream", "entries", "entry"} {
+		assertRanksAbove(t, list, name, "settings")
+	}
+}
+
+func TestDocstringTemplate(t *testing.T) {
+	text := "def send(host, port):\n    \"\"\"\n    return True\n"
+	uri := "file:///docstring.py"
+	template := func(items []CompletionItem) (CompletionItem, bool) {
+		return findItem(items, `""" docstring`)
+	}
+
+	c := newTestServer(t, nil, snippetCapabilities)
+	c.open(uri, text)
+	item, ok := template(c.completion(uri, 1, 7).Items)
+	if !ok {
+		t.Fatal("no docstring template")
+	}
+	lines := strings.Split(item.InsertText, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	want := []string{"${1:Summary.}", "", ":param host: ${2}", ":param port: ${3}", ":return: ${4}", `"""$0`}
+	if !reflect.DeepEqual(lines, want) || item.InsertTextFmt != 2 {
+		t.Errorf("template = %q, want %q", lines, want)
+	}
+	if item.Detail != "def send(host, port)" {
+		t.Errorf("detail = %q", item.Detail)
+	}
+
+	// the option off, or a client without snippets, gets none
+	c = newTestServer(t, map[string]any{"completion": map[string]any{"docstrings": false}}, snippetCapabilities)
+	c.open(uri, text)
+	if _, ok := template(c.completion(uri, 1, 7).Items); ok {
+		t.Error("template offered with the option off")
+	}
+	c = newTestServer(t, nil, nil)
+	c.open(uri, text)
+	if _, ok := template(c.completion(uri, 1, 7).Items); ok {
+		t.Error("template offered without snippet support")
+	}
+}
+
+// await goes in front of an async def's call only where await is allowed: not in a sync def nested in the
+// async one, and not twice
+func TestAwaitCallSnippets(t *testing.T) {
+	text := "async def fetch(url):\n    return url\n\nasync def main():\n    fet\n    def helper():\n        fet\n    x = await fet\n\ndef sync():\n    fet\n"
+	c := newTestServer(t, nil, snippetCapabilities)
+	uri := "file:///awaiting.py"
+	c.open(uri, text)
+	tests := []struct {
+		line, character int
+		label, insert   string
+	}{
+		{4, 7, "await fetch(url)", "await fetch(${1:url})$0"},
+		{6, 11, "fetch(url)", "fetch(${1:url})$0"},
+		{7, 17, "fetch(url)", "fetch(${1:url})$0"},
+		{10, 7, "fetch(url)", "fetch(${1:url})$0"},
+	}
+	for _, tt := range tests {
+		items := c.completion(uri, tt.line, tt.character).Items
+		var snippets []string
+		for _, item := range items {
+			if item.FilterText == "fetch" {
+				snippets = append(snippets, item.Label)
+				if item.Label != tt.label || item.InsertText != tt.insert || item.Detail != "async def fetch(url)" {
+					t.Errorf("line %d: %q inserts %q, want %q inserting %q", tt.line, item.Label, item.InsertText, tt.label, tt.insert)
+				}
+			}
+		}
+		if len(snippets) != 1 {
+			t.Errorf("line %d: call snippets %v, want just %q", tt.line, snippets, tt.label)
+		}
+	}
+}
+
+// the base class's parameters that the override doesn't have yet, inserted with their annotation and default
+func TestOverrideParamCompletion(t *testing.T) {
+	text := "class Base:\n    def handle(self, request, timeout: float = 5.0, *args, retries=3):\n        pass\n\nclass Derived(Base):\n    def handle(self, request, \n\nclass Plain:\n    def handle(self, \n"
+	uri := "file:///override.py"
+	overrides := func(items []CompletionItem) map[string]string {
+		found := make(map[string]string)
+		for _, item := range items {
+			if item.LabelDetails != nil && item.LabelDetails.Description == "Base.handle" {
+				found[item.Label] = item.InsertText
+			}
+		}
+		return found
+	}
+
+	c := newTestServer(t, nil, nil)
+	c.open(uri, text)
+	got := overrides(c.completion(uri, 5, 30).Items)
+	want := map[string]string{"timeout": "timeout: float = 5.0", "args": "*args", "retries": "retries=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("override params = %v, want %v", got, want)
+	}
+	if got := overrides(c.completion(uri, 8, 22).Items); len(got) != 0 {
+		t.Errorf("a class without bases got %v", got)
+	}
+
+	c = newTestServer(t, map[string]any{"completion": map[string]any{"overrideParams": false}}, nil)
+	c.open(uri, text)
+	if got := overrides(c.completion(uri, 5, 30).Items); len(got) != 0 {
+		t.Errorf("offered with the option off: %v", got)
+	}
+}
+
+// one def snippet at the top level and in a class body: a client that adjusts indentation gets it as written with
+// adjustIndentation, the rest get the cursor line's indentation put in front of its later lines
+func TestIndentMultiline(t *testing.T) {
+	snippet := "def ${1:name}(self):\n    \"\"\"${2}\n\n    \"\"\"\n    ${3:pass}$0"
+	tests := []struct {
+		lineText string
+		adjust   bool
+		want     string
+		mode     int
+	}{
+		{"de", false, snippet, insertTextModeAsIs},
+		{"    de", false, "def ${1:name}(self):\n        \"\"\"${2}\n\n        \"\"\"\n        ${3:pass}$0", insertTextModeAsIs},
+		{"de", true, snippet, insertTextModeAdjustIndentation},
+		{"    de", true, snippet, insertTextModeAdjustIndentation},
+	}
+	defer func() { clientAdjustIndentation = false }()
+	for _, tt := range tests {
+		clientAdjustIndentation = tt.adjust
+		items := []CompletionItem{{Label: "def", InsertText: snippet, InsertTextFmt: 2}, {Label: "name", InsertText: "name"}}
+		indentMultiline(items, tt.lineText)
+		if items[0].InsertText != tt.want || items[0].InsertTextMode != tt.mode {
+			t.Errorf("%q adjust %v: %q mode %d, want %q mode %d", tt.lineText, tt.adjust, items[0].InsertText, items[0].InsertTextMode, tt.want, tt.mode)
+		}
+		if items[1].InsertText != "name" || items[1].InsertTextMode != 0 {
+			t.Errorf("a one line insert was touched: %+v", items[1])
+		}
+	}
+}
+
+// the same through completion, the __repr__ template in a class body under both capabilities
+func TestDunderTemplateIndentation(t *testing.T) {
+	text := "class Point:\n    __\n"
+	uri := "file:///indented.py"
+	completionItem := func(adjust bool) map[string]any {
+		item := map[string]any{"snippetSupport": true}
+		if adjust {
+			item["insertTextModeSupport"] = map[string]any{"valueSet": []int{1, 2}}
+		}
+		return map[string]any{"textDocument": map[string]any{"completion": map[string]any{"completionItem": item}}}
+	}
+	for _, adjust := range []bool{false, true} {
+		c := newTestServer(t, nil, completionItem(adjust))
+		c.open(uri, text)
+		item, _ := findItem(c.completion(uri, 1, 6).Items, "__repr__")
+		want, mode := "def __repr__(self):\n        ${1:pass}$0", insertTextModeAsIs
+		if adjust {
+			want, mode = "def __repr__(self):\n    ${1:pass}$0", insertTextModeAdjustIndentation
+		}
+		if item.InsertText != want || item.InsertTextMode != mode {
+			t.Errorf("adjust %v: %q mode %d, want %q mode %d", adjust, item.InsertText, item.InsertTextMode, want, mode)
+		}
+	}
+}
+
+// json is written more often, but only yaml has anything accessed on it
+func TestUnusedImportRanksBelowUsed(t *testing.T) {
+	text := "import json\nimport yaml\n\nconfig = yaml.safe_load(source)\nsave(json, json, json)\n\n"
+	uri := "file:///imports.py"
+
+	c := newTestServer(t, nil, nil)
+	c.open(uri, text)
+	assertRanksAbove(t, c.completion(uri, 6, 0), "yaml", "json")
+
+	c = newTestServer(t, map[string]any{"completion": map[string]any{"demoteUnusedImports": false}}, nil)
+	c.open(uri, text)
+	assertRanksAbove(t, c.completion(uri, 6, 0), "json", "yaml")
+}
+
+// the document's words get their count, builtins and keywords say which they are, with showDetail off none do
+func TestCompletionDetails(t *testing.T) {
+	text := "total = 0\ntotal += 1\ndef tally(x):\n    pass\nt\n"
+	uri := "file:///details.py"
+	want := map[string]string{"total": "2 uses", "tally": "1 use", "tuple": "builtin", "True": "keyword", "try": "keyword", "tally(x)": "def tally(x)"}
+
+	c := newTestServer(t, nil, snippetCapabilities)
+	c.open(uri, text)
+	items := c.completion(uri, 4, 1).Items
+	for label, detail := range want {
+		if item, ok := findItem(items, label); !ok || item.Detail != detail {
+			t.Errorf("%s: detail %q, want %q", label, item.Detail, detail)
+		}
+	}
+
+	c = newTestServer(t, map[string]any{"completion": map[string]any{"showDetail": false}}, snippetCapabilities)
+	c.open(uri, text)
+	items = c.completion(uri, 4, 1).Items
+	for _, label := range []string{"total", "tally", "tuple", "True", "try"} {
+		if item, ok := findItem(items, label); !ok || item.Detail != "" {
+			t.Errorf("%s with showDetail off: detail %q", label, item.Detail)
+		}
+	}
+	if item, _ := findItem(items, "tally(x)"); item.Detail != "def tally(x)" {
+		t.Errorf("a signature is more than a detail, it stays: %q", item.Detail)
+	}
+}
+
+// a snippet that comes without a detail is marked as one
+func TestSnippetDetail(t *testing.T) {
+	set := newCompletionSet("")
+	set.details = true
+	set.add(CompletionItem{Label: "main", InsertText: "if __name__ == \"__main__\":\n    $0", InsertTextFmt: 2}, bucketPinned, 0)
+	set.add(CompletionItem{Label: "plain", InsertText: "plain", InsertTextFmt: 1}, bucketPinned, 0)
+	set.add(CompletionItem{Label: "described", InsertText: "described($0)", InsertTextFmt: 2, Detail: "def described()"}, bucketPinned, 0)
+	want := []string{"snippet", "", "def described()"}
+	for i, item := range set.items {
+		if item.Detail != want[i] {
+			t.Errorf("%s: detail %q, want %q", item.Label, item.Detail, want[i])
+		}
+	}
+}
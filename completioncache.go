@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// editors tend to send the same completion request more than once (retriggering on the same keystroke, a second
+// client pane on the same buffer). the last few answers are kept for a moment and a request identical to one still
+// being worked on waits for that one instead of building the list again
+
+const completionCacheTTL = 2 * time.Second
+
+// bumped by anything a completion list depends on: any document, the settings, the recently picked items.
+// it is part of the cache key so a bump makes every stored answer unreachable
+var completionRevision atomic.Uint64
+
+func invalidateCompletions() {
+	completionRevision.Add(1)
+}
+
+type completionKey struct {
+	uri              string
+	revision         uint64
+	line             int
+	character        int
+	triggerKind      int
+	triggerCharacter string
+}
+
+type completionCall struct {
+	done    chan struct{}
+	resp    CompletionList
+	expires time.Time
+}
+
+type completionCache struct {
+	mu     sync.Mutex
+	calls  map[completionKey]*completionCall
+	hits   int64
+	misses int64
+}
+
+var completions = &completionCache{calls: make(map[completionKey]*completionCall)}
+
+// the stored answer for key, or build's if there is none. the returned list is shared and must not be modified
+func (c *completionCache) get(ctx context.Context, key completionKey, build func() CompletionList) (CompletionList, bool) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok && (!isDone(call.done) || time.Now().Before(call.expires)) {
+		c.hits++
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.resp, true
+		case <-ctx.Done():
+			return CompletionList{}, false
+		}
+	}
+	call := &completionCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.misses++
+	c.mu.Unlock()
+
+	call.resp = build()
+
+	c.mu.Lock()
+	now := time.Now()
+	call.expires = now.Add(completionCacheTTL)
+	close(call.done)
+	for k, other := range c.calls {
+		if isDone(other.done) && now.After(other.expires) {
+			delete(c.calls, k)
+		}
+	}
+	c.mu.Unlock()
+	return call.resp, true
+}
+
+func (c *completionCache) counters() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
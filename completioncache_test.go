@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestCompletionCacheSecondRequestDoesNotRebuild(t *testing.T) {
+	cache := &completionCache{calls: make(map[completionKey]*completionCall)}
+	builds := 0
+	build := func() CompletionList {
+		builds++
+		return CompletionList{Items: []CompletionItem{{Label: "total"}}}
+	}
+	key := completionKey{uri: "file:///a.py", line: 3, character: 4}
+
+	first, ok := cache.get(context.Background(), key, build)
+	if !ok || len(first.Items) != 1 {
+		t.Fatalf("first get = %v, %v", first, ok)
+	}
+	second, ok := cache.get(context.Background(), key, build)
+	if !ok || len(second.Items) != 1 || second.Items[0].Label != "total" {
+		t.Fatalf("second get = %v, %v", second, ok)
+	}
+	if builds != 1 {
+		t.Errorf("built %d times, want 1", builds)
+	}
+	if hits, misses := cache.counters(); hits != 1 || misses != 1 {
+		t.Errorf("hits, misses = %d, %d, want 1, 1", hits, misses)
+	}
+
+	moved := key
+	moved.character++
+	cache.get(context.Background(), moved, build)
+	newer := key
+	newer.revision++
+	cache.get(context.Background(), newer, build)
+	if builds != 3 {
+		t.Errorf("built %d times after a different position and a new revision, want 3", builds)
+	}
+}
+
+func TestCompletionCacheWaitsForIdenticalRequest(t *testing.T) {
+	cache := &completionCache{calls: make(map[completionKey]*completionCall)}
+	key := completionKey{uri: "file:///a.py"}
+	started, release := make(chan struct{}), make(chan struct{})
+	builds := 0
+	go cache.get(context.Background(), key, func() CompletionList {
+		builds++
+		close(started)
+		<-release
+		return CompletionList{Items: []CompletionItem{{Label: "slow"}}}
+	})
+	<-started
+
+	waited := make(chan CompletionList)
+	go func() {
+		resp, _ := cache.get(context.Background(), key, func() CompletionList {
+			t.Error("an identical request in flight was built again")
+			return CompletionList{}
+		})
+		waited <- resp
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if resp := <-waited; len(resp.Items) != 1 || resp.Items[0].Label != "slow" {
+		t.Errorf("waiter got %v, want the first request's list", resp)
+	}
+	if builds != 1 {
+		t.Errorf("built %d times, want 1", builds)
+	}
+}
+
+func TestCompletionCacheWaiterGivesUpWhenCancelled(t *testing.T) {
+	cache := &completionCache{calls: make(map[completionKey]*completionCall)}
+	key := completionKey{uri: "file:///a.py"}
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go cache.get(context.Background(), key, func() CompletionList {
+		close(started)
+		<-release
+		return CompletionList{}
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := cache.get(ctx, key, func() CompletionList { return CompletionList{} }); ok {
+		t.Error("a cancelled waiter reported a list")
+	}
+}
+
+// a request cancelled while it waits on an identical one still gets its answer, RequestCancelled
+func TestCancelledCompletionWaiterIsAnswered(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///waiter.py"
+	c.open(uri, "value = 1\nva\n")
+	c.call("pypls/ping", nil, nil) // the open is applied
+
+	key := completionKey{uri, completionRevision.Load(), 1, 2, 0, ""}
+	stuck := &completionCall{done: make(chan struct{})}
+	completions.mu.Lock()
+	completions.calls[key] = stuck
+	completions.mu.Unlock()
+	defer close(stuck.done)
+
+	replied := make(chan error, 1)
+	go func() {
+		var list CompletionList
+		params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{1, 2}}
+		replied <- c.conn.Call(context.Background(), "textDocument/completion", params, &list, jsonrpc2.PickID(jsonrpc2.ID{Num: 999}))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.notify("$/cancelRequest", map[string]any{"id": 999})
+
+	select {
+	case err := <-replied:
+		rpcErr, ok := err.(*jsonrpc2.Error)
+		if !ok || rpcErr.Code != codeRequestCancelled {
+			t.Errorf("reply error = %v, want RequestCancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to the cancelled request")
+	}
+}
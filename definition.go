@@ -0,0 +1,228 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type definitionSite struct {
+	line  int
+	start int
+	end   int
+}
+
+// every def/class of name in content, or the first assignment to it (or failing that any other binding) if there are none.
+// more than one def is legitimate (overloads, platform specific definitions) so they're all returned
+func findDefinitions(content string, name string) []definitionSite {
+	if name == "" {
+		return nil
+	}
+
+	quoted := regexp.QuoteMeta(name)
+	defRe := regexp.MustCompile(`^\s*(?:async\s+)?(?:def|class)\s+(` + quoted + `)\b`)
+	assignRe := regexp.MustCompile(`^\s*(` + quoted + `)\s*(?::[^=]*)?=[^=]`)
+
+	sites := make([]definitionSite, 0)
+	var assignment *definitionSite
+
+	for i, line := range splitLines(content) {
+		if m := defRe.FindStringSubmatchIndex(line); m != nil {
+			sites = append(sites, definitionSite{i, m[2], m[3]})
+		}else if assignment == nil {
+			if m := assignRe.FindStringSubmatchIndex(line); m != nil {
+				assignment = &definitionSite{i, m[2], m[3]}
+			}
+		}
+	}
+
+	if len(sites) == 0 && assignment != nil {
+		sites = append(sites, *assignment)
+	}
+	if len(sites) == 0 { // unpacking, walrus, loop targets and the like
+		if b, ok := firstBinding(analyzeScopes(content), name); ok {
+			sites = append(sites, definitionSite{b.line, b.start, b.end})
+		}
+	}
+	return sites
+}
+
+// every def, class and module level assignment of name in the given files, in a stable order (by uri, then by line)
+func findDefinitionsInFiles(files map[string]OpenFile, name string) []Location {
+	uris := make([]string, 0, len(files))
+	for u := range files {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+
+	locations := make([]Location, 0)
+	for _, u := range uris {
+		if !languageFor(files[u].languageId).pythonStrings { continue }
+		for _, sym := range documentSymbols(u, files[u]) {
+			if sym.Name != name || sym.Kind == symbolField { continue }
+			locations = append(locations, sym.Location)
+		}
+	}
+	return locations
+}
+
+// the other open files split into the ones sharing a directory with uri (probably the same package) and the rest
+func definitionSearchGroups(uri string, files map[string]OpenFile) []map[string]OpenFile {
+	samePackage := make(map[string]OpenFile)
+	rest := make(map[string]OpenFile)
+	dir := path.Dir(uri)
+
+	for u, f := range files {
+		if u == uri { continue }
+		if path.Dir(u) == dir {
+			samePackage[u] = f
+		}else{
+			rest[u] = f
+		}
+	}
+	return []map[string]OpenFile{samePackage, rest}
+}
+
+// definitions in the file itself, or failing that every candidate in the other open files and the files
+// pypls.lintWorkspace went through, the same package first. nil when there are none so the client can fall back
+// to its own search
+func definitionLocations(uri string, name string, files map[string]OpenFile) []Location {
+	var locations []Location
+
+	if file, ok := files[uri]; ok {
+		lines := splitLines(file.content)
+		for _, site := range findDefinitions(file.content, name) {
+			locations = append(locations, Location{uri, rangeOnLine(lines, site.line, site.start, site.end)})
+		}
+		if len(locations) > 0 {
+			return locations
+		}
+	}
+
+	for _, group := range definitionSearchGroups(uri, files) {
+		locations = append(locations, findDefinitionsInFiles(group, name)...)
+	}
+	locations = append(locations, indexedDefinitions(name, files)...)
+	sort.SliceStable(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if aSame, bSame := path.Dir(a.URI) == path.Dir(uri), path.Dir(b.URI) == path.Dir(uri); aSame != bSame {
+			return aSame
+		}
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		return a.Range.Start.Line < b.Range.Start.Line
+	})
+	return locations
+}
+
+// findDefinitionsInFiles for the workspace files pypls.lintWorkspace last went through that aren't open, from the
+// symbols kept with their results. open documents are searched as they are now instead
+func indexedDefinitions(name string, open map[string]OpenFile) []Location {
+	lintCacheMu.Lock()
+	defer lintCacheMu.Unlock()
+	locations := make([]Location, 0)
+	for p, result := range lintCache {
+		if _, isOpen := open[pathToURI(p)]; isOpen { continue }
+		for _, sym := range result.symbols {
+			if sym.Name != name || sym.Kind == symbolField { continue }
+			locations = append(locations, sym.Location)
+		}
+	}
+	return locations
+}
+
+// classes called name, in the file itself if it has one, or else in the other open files with the same package first
+func classLocations(uri string, name string, files map[string]OpenFile) []Location {
+	var locations []Location
+	for _, group := range append([]map[string]OpenFile{{uri: files[uri]}}, definitionSearchGroups(uri, files)...) {
+		for _, loc := range findDefinitionsInFiles(group, name) {
+			lines := splitLines(group[loc.URI].content)
+			if _, ok := parseClassHeader(lines, loc.Range.Start.Line); ok {
+				locations = append(locations, loc)
+			}
+		}
+		if len(locations) > 0 {
+			break
+		}
+	}
+	return locations
+}
+
+// the class of the variable under the cursor: its annotation or inferred type, or failing that whatever it's
+// assigned a call of (`x = Foo()` with Foo imported from elsewhere). builtins have nowhere to go, nil then
+func typeDefinitionLocations(uri string, name string, files map[string]OpenFile) []Location {
+	file, ok := files[uri]
+	if !ok {
+		return nil
+	}
+
+	types := make([]string, 0)
+	if t := variableType(file.content, name); t != "" {
+		types = strings.Split(t, " | ")
+	}else{
+		for _, line := range splitLines(file.content) {
+			m := simpleAssignRe.FindStringSubmatch(line)
+			if m == nil || m[2] != name { continue }
+			if call := constructorCallRe.FindStringSubmatch(strings.TrimSpace(m[4])); call != nil {
+				types = append(types, baseName(call[1]))
+				break
+			}
+		}
+	}
+	if len(types) == 0 {
+		types = append(types, name) // the cursor is on a class name (an annotation, a base) or the heuristics gave up
+	}
+
+	var locations []Location
+	for _, t := range types {
+		if i := strings.Index(t, "["); i >= 0 { // list[Foo] is a list
+			t = t[:i]
+		}
+		if _, builtin := knownTypeAttrs[t]; builtin || defaultCompletions[t] != 0 { continue }
+		locations = append(locations, classLocations(uri, baseName(t), files)...)
+	}
+	return locations
+}
+
+// same named methods in the classes that list the enclosing class of the cursor as a base, in any open file
+func implementationLocations(uri string, line int, name string, files map[string]OpenFile) []Location {
+	file, ok := files[uri]
+	if !ok {
+		return nil
+	}
+	cls, ok := enclosingClass(splitLines(file.content), line)
+	if !ok {
+		return nil
+	}
+
+	uris := make([]string, 0, len(files))
+	for u := range files {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+
+	var locations []Location
+	for _, u := range uris {
+		if !languageFor(files[u].languageId).pythonStrings { continue }
+		lines := splitLines(files[u].content)
+		subclasses := make(map[string]bool)
+		for i := range lines {
+			sub, ok := parseClassHeader(lines, i)
+			if !ok { continue }
+			for _, b := range sub.bases {
+				if baseName(b) == cls.name {
+					subclasses[sub.name] = true
+				}
+			}
+		}
+		if len(subclasses) == 0 { continue }
+		for _, sym := range documentSymbols(u, files[u]) {
+			if sym.Kind == symbolMethod && sym.Name == name && subclasses[sym.ContainerName] {
+				locations = append(locations, sym.Location)
+			}
+		}
+	}
+	return locations
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func (c *testClient) definition(uri string, line, character int) []Location {
+	c.t.Helper()
+	var locations []Location
+	c.call("textDocument/definition", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{line, character}}, &locations)
+	return locations
+}
+
+func locationURIs(locations []Location) []string {
+	uris := make([]string, len(locations))
+	for i, loc := range locations {
+		uris[i] = loc.URI
+	}
+	return uris
+}
+
+// every open document defining the name comes back, same package first and then by uri whatever order they
+// were opened in
+func TestDefinitionInOtherOpenFiles(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	c.open("file:///other/a.py", "def fetch():\n    pass\n")
+	c.open("file:///pkg/b.py", "x = 1\n\ndef fetch(url):\n    pass\n")
+	c.open("file:///pkg/a.py", "def fetch():\n    pass\n")
+	c.open("file:///pkg/main.py", "fetch()\n")
+
+	got := c.definition("file:///pkg/main.py", 0, 2)
+	want := []string{"file:///pkg/a.py", "file:///pkg/b.py", "file:///other/a.py"}
+	if !reflect.DeepEqual(locationURIs(got), want) {
+		t.Fatalf("definitions in %v, want %v", locationURIs(got), want)
+	}
+	if got[1].Range.Start != (Position{2, 4}) {
+		t.Errorf("pkg/b.py's fetch at %v, want 2:4", got[1].Range.Start)
+	}
+	if got := c.definition("file:///pkg/main.py", 0, 6); got != nil {
+		t.Errorf("definition of a name defined nowhere = %v, want null", got)
+	}
+}
+
+// files pypls.lintWorkspace went through are searched too, unless they're open
+func TestDefinitionInWorkspaceFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "two.py"), "def fetch():\n    pass\n")
+	writeFile(t, filepath.Join(dir, "lib", "one.py"), "import os\n\n\ndef fetch(path):\n    return os.stat(path)\n")
+	c := newTestServer(t, map[string]any{"diagnostics": map[string]any{"workspace": true}}, nil)
+	setWorkspaceRoot(pathToURI(dir), "")
+	lintWorkspaceCommand(c)
+
+	main := pathToURI(filepath.Join(dir, "main.py"))
+	c.open(main, "fetch()\n")
+	one, two := pathToURI(filepath.Join(dir, "lib", "one.py")), pathToURI(filepath.Join(dir, "lib", "two.py"))
+	got := c.definition(main, 0, 1)
+	if want := []string{one, two}; !reflect.DeepEqual(locationURIs(got), want) {
+		t.Fatalf("definitions in %v, want %v", locationURIs(got), want)
+	}
+	if got[0].Range.Start != (Position{3, 4}) {
+		t.Errorf("lib/one.py's fetch at %v, want 3:4", got[0].Range.Start)
+	}
+
+	c.open(two, "\n\ndef fetch():\n    pass\n") // the open text wins over what was linted
+	got = c.definition(main, 0, 1)
+	if len(got) != 2 || got[1].URI != two || got[1].Range.Start.Line != 2 {
+		t.Errorf("with lib/two.py open: %v, want its fetch on line 2", got)
+	}
+}
+
+// two defs of a name (overloads, platform branches) are both definitions, in file order and the files by uri
+func TestFindDefinitionsInFiles(t *testing.T) {
+	files := map[string]OpenFile{
+		"file:///b.py": pythonFile("file:///b.py", "if WINDOWS:\n    def home():\n        pass\nelse:\n    def home():\n        pass\n"),
+		"file:///a.py": pythonFile("file:///a.py", "home = '/root'\n"),
+	}
+	got := findDefinitionsInFiles(files, "home")
+	want := []Location{
+		{"file:///a.py", Range{Position{0, 0}, Position{0, 4}}},
+		{"file:///b.py", Range{Position{1, 8}, Position{1, 12}}},
+		{"file:///b.py", Range{Position{4, 8}, Position{4, 12}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findDefinitionsInFiles = %v, want %v", got, want)
+	}
+}
+
+// a definition in the current file is the answer, the other files aren't looked at
+func TestDefinitionInCurrentFileFirst(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	c.open("file:///pkg/other.py", "def fetch():\n    pass\n")
+	c.open("file:///pkg/main.py", "def fetch():\n    pass\n\nfetch()\n")
+	got := c.definition("file:///pkg/main.py", 3, 0)
+	if len(got) != 1 || got[0].URI != "file:///pkg/main.py" || got[0].Range.Start != (Position{0, 4}) {
+		t.Errorf("definition = %v, want main.py's own fetch", got)
+	}
+}
+
+// where there's no type to go to, typeDefinition answers what definition does rather than nothing
+func TestTypeDefinitionFallsBackToDefinition(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///fallback.py"
+	c.open(uri, "def helper():\n    return 1\n\ncount = helper()\nresult = count + helper()\n")
+	for _, at := range []Position{{4, 10}, {4, 19}, {0, 5}} {
+		var typeLocations []Location
+		c.call("textDocument/typeDefinition", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": at}, &typeLocations)
+		locations := c.definition(uri, at.Line, at.Character)
+		if len(locations) == 0 {
+			t.Fatalf("no definition at %v", at)
+		}
+		if !reflect.DeepEqual(typeLocations, locations) {
+			t.Errorf("at %v typeDefinition = %v, definition = %v", at, typeLocations, locations)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// cheap checks run on open and once typing pauses after a change, published as textDocument/publishDiagnostics.
+// each has a toggle under the diagnostics setting
+
+// LSP DiagnosticSeverity values
+const (
+	severityError       = 1
+	severityWarning     = 2
+	severityInformation = 3
+	severityHint        = 4
+)
+
+type DiagnosticRelatedInformation struct {
+	Location Location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+type Diagnostic struct {
+	Range              Range                          `json:"range"`
+	Severity           int                            `json:"severity"`
+	Code               string                         `json:"code,omitempty"`
+	Source             string                         `json:"source"`
+	Message            string                         `json:"message"`
+	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+func diagnose(file OpenFile, opts Options) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	if !languageFor(file.languageId).pythonStrings || file.tooLarge {
+		return diagnostics
+	}
+	lines := splitLines(file.content)
+	tree := documentSymbolTree(file)
+
+	if opts.Diagnostics.DuplicateDefinitions {
+		var walk func(symbols []DocumentSymbol)
+		walk = func(symbols []DocumentSymbol) {
+			diagnostics = append(diagnostics, duplicateDefinitions(file.uri, lines, symbols)...)
+			for _, sym := range symbols {
+				if sym.Kind == symbolClass {
+					walk(sym.Children)
+				}
+			}
+		}
+		walk(tree)
+	}
+	if opts.Diagnostics.ShadowedBuiltins {
+		diagnostics = append(diagnostics, shadowedBuiltins(tree)...)
+	}
+	if opts.Diagnostics.Brackets {
+		diagnostics = append(diagnostics, bracketDiagnostics(file, lines)...)
+	}
+	if opts.Diagnostics.UnawaitedCalls {
+		diagnostics = append(diagnostics, unawaitedCalls(file, lines)...)
+	}
+	if opts.Diagnostics.UndefinedNames {
+		diagnostics = append(diagnostics, undefinedNames(file, lines)...)
+	}
+	if opts.Diagnostics.Todos {
+		diagnostics = append(diagnostics, todoDiagnostics(file.todos)...)
+	}
+	return diagnostics
+}
+
+// `fetch()` on its own or `x = fetch()` inside an async def, where fetch is an async def of this document, only
+// makes a coroutine and never runs it. calls passed on to something else (`gather(fetch())`, `create_task`) are
+// left alone, that's how coroutines get scheduled
+func unawaitedCalls(file OpenFile, lines []string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	root := analyzeScopes(file.content)
+	async := make(map[string]bool)
+	for name, fn := range callableFunctions(file.uri, root, nil) {
+		async[name] = fn.isAsync
+	}
+
+	for _, ll := range logicalLines(lines, tokenize(file.content)) {
+		call := 0
+		if assign := indexTopLevel(ll.tokens, func(t token) bool { return isOp(t, "=") }); assign >= 0 {
+			call = assign + 1
+		}
+		if call+1 >= len(ll.tokens) { continue }
+		name := ll.tokens[call]
+		if name.kind != tokenIdentifier || !async[name.text] || !isOp(ll.tokens[call+1], "(") { continue }
+		if fn := root.scopeAt(name.line, name.start).enclosingFunction(); fn == nil || !fn.isAsync { continue }
+		diagnostics = append(diagnostics, Diagnostic{
+			Range: rangeOnLine(lines, name.line, name.start, name.end), Severity: severityInformation, Code: "pypls.unawaited-call", Source: "pypls",
+			Message: name.text + " is an async def, without await this call only creates the coroutine and never runs it",
+		})
+	}
+	return diagnostics
+}
+
+// unclosed brackets and triple quoted strings are reported where they open, python itself only complains
+// somewhere further down. one more error at the end of the file points back at all of them
+func bracketDiagnostics(file OpenFile, lines []string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	unclosed, mismatched, openString := bracketErrors(file.content, languageFor(file.languageId))
+	at := func(tok token) Range { return rangeOnLine(lines, tok.line, tok.start, tok.end) }
+
+	for _, pair := range mismatched {
+		closer, opener := pair[0], pair[1]
+		d := Diagnostic{Range: at(closer), Severity: severityError, Code: "pypls.mismatched-bracket", Source: "pypls"}
+		if opener.text == "" {
+			d.Message = "'" + closer.text + "' has nothing to close"
+		}else{
+			d.Message = fmt.Sprintf("'%s' doesn't match the '%s' opened on line %d", closer.text, opener.text, opener.line+1)
+			d.RelatedInformation = []DiagnosticRelatedInformation{{Location{file.uri, at(opener)}, "'" + opener.text + "' opened here"}}
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	openers := append([]token{}, unclosed...)
+	if openString != nil {
+		openers = append(openers, *openString)
+	}
+	if len(openers) == 0 {
+		return diagnostics
+	}
+	related := make([]DiagnosticRelatedInformation, 0, len(openers))
+	for _, opener := range openers {
+		code := "pypls.unclosed-bracket"
+		if opener.kind == tokenString {
+			code = "pypls.unterminated-string"
+		}
+		message := "'" + opener.text + "' opened here is never closed"
+		diagnostics = append(diagnostics, Diagnostic{Range: at(opener), Severity: severityError, Code: code, Source: "pypls", Message: message})
+		related = append(related, DiagnosticRelatedInformation{Location{file.uri, at(opener)}, message})
+	}
+
+	innermost := openers[len(openers)-1]
+	last := len(lines) - 1
+	eof := Position{last, lineCharacter(lines[last], len(lines[last]))}
+	diagnostics = append(diagnostics, Diagnostic{
+		Range: Range{eof, eof}, Severity: severityError, Code: "pypls.unexpected-eof", Source: "pypls",
+		Message: fmt.Sprintf("the file ends while '%s' from line %d is still open", innermost.text, innermost.line+1),
+		RelatedInformation: related,
+	})
+	return diagnostics
+}
+
+// a second `def name` directly in the same module or class body replaces the first. defs nested in an if/try
+// block are left alone (`if sys.platform == ...: def f` / `else: def f` is deliberate), and so are property
+// setters, overloads and the like
+func duplicateDefinitions(uri string, lines []string, symbols []DocumentSymbol) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	body := -1 // indentation of the body itself, the shallowest symbol in it
+	for _, sym := range symbols {
+		if body < 0 || sym.Range.Start.Character < body {
+			body = sym.Range.Start.Character
+		}
+	}
+
+	previous := make(map[string]DocumentSymbol)
+	for _, sym := range symbols {
+		if sym.Kind != symbolFunction && sym.Kind != symbolMethod || sym.Range.Start.Character != body { continue }
+		decorators := decoratorsAbove(lines, sym.Range.Start.Line)
+		first, seen := previous[sym.Name]
+		previous[sym.Name] = sym
+		if !seen || redefinitionIntended(sym.Name, decorators) || redefinitionIntended(sym.Name, decoratorsAbove(lines, first.Range.Start.Line)) { continue }
+		diagnostics = append(diagnostics, Diagnostic{
+			Range: sym.SelectionRange, Severity: severityWarning, Code: "pypls.duplicate-definition", Source: "pypls",
+			Message: sym.Name + " is already defined above, this definition replaces it",
+			RelatedInformation: []DiagnosticRelatedInformation{{Location{uri, first.SelectionRange}, "first definition of " + sym.Name}},
+		})
+	}
+	return diagnostics
+}
+
+// the decorator names (without the @ and any arguments) on the lines right above a def
+func decoratorsAbove(lines []string, line int) []string {
+	decorators := make([]string, 0)
+	for i := line - 1; i >= 0; i-- {
+		text := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(text, "@") { break }
+		name := strings.TrimSpace(strings.TrimPrefix(text, "@"))
+		if paren := strings.Index(name, "("); paren >= 0 {
+			name = name[:paren]
+		}
+		decorators = append(decorators, name)
+	}
+	return decorators
+}
+
+// `@x.setter` and friends hang a new function on the old one, `@overload` stacks are meant to repeat
+func redefinitionIntended(name string, decorators []string) bool {
+	for _, d := range decorators {
+		if strings.HasPrefix(d, name+".") || d == "overload" || strings.HasSuffix(d, ".overload") {
+			return true
+		}
+	}
+	return false
+}
+
+// builtins that a module level assignment, def or class hides for the rest of the module
+func shadowedBuiltins(tree []DocumentSymbol) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	for _, sym := range tree {
+		if !isBuiltinName(sym.Name) { continue }
+		diagnostics = append(diagnostics, Diagnostic{
+			Range: sym.SelectionRange, Severity: severityInformation, Code: "pypls.shadow-builtin", Source: "pypls",
+			Message: sym.Name + " shadows the builtin of the same name",
+		})
+	}
+	return diagnostics
+}
+
+// defaultCompletions has the keywords too, and sort which is only ever a method
+func isBuiltinName(name string) bool {
+	return defaultCompletions[name] != 0 && !pythonKeywords[name] && name != "sort"
+}
+
+// what was last sent for each document, as JSON. an edit that leaves the diagnostics as they were sends nothing,
+// some editors redraw (and flicker) on every publish
+var publishedDiagnostics = make(map[string]string)
+var publishedDiagnosticsMu sync.Mutex
+
+func publishDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, file OpenFile) {
+	sendDiagnostics(ctx, conn, file.uri, diagnose(file, getOptions()))
+}
+
+// skipped when it's what the client already has for uri
+func sendDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, uri string, diagnostics []Diagnostic) {
+	params := PublishDiagnosticsParams{uri, diagnostics}
+	encoded, err := json.Marshal(params.Diagnostics)
+	if err != nil {
+		return
+	}
+	// held over the send too so two publishes for one document can't land in the other order from what's recorded
+	publishedDiagnosticsMu.Lock()
+	defer publishedDiagnosticsMu.Unlock()
+	if last, ok := publishedDiagnostics[uri]; ok && last == string(encoded) {
+		return
+	}
+	publishedDiagnostics[uri] = string(encoded)
+	conn.Notify(ctx, "textDocument/publishDiagnostics", params)
+}
+
+// the next publish for uri goes out even if it's the same as the last, for a document opened again
+func forgetPublishedDiagnostics(uri string) {
+	publishedDiagnosticsMu.Lock()
+	delete(publishedDiagnostics, uri)
+	publishedDiagnosticsMu.Unlock()
+}
+
+// how long a change waits for the next one before the checks run, an unclosed `(` is normal while typing and
+// shouldn't flash an error on every keystroke
+const diagnosticsDelay = 400 * time.Millisecond
+
+var diagnosticsTimers = make(map[string]*time.Timer)
+var diagnosticsTimersMu sync.Mutex
+
+// publishes for whatever the document holds once it's been quiet for diagnosticsDelay
+func scheduleDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, uri string) {
+	diagnosticsTimersMu.Lock()
+	defer diagnosticsTimersMu.Unlock()
+	if timer, ok := diagnosticsTimers[uri]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(diagnosticsDelay, func() {
+		diagnosticsTimersMu.Lock()
+		if diagnosticsTimers[uri] == timer {
+			delete(diagnosticsTimers, uri)
+		}
+		diagnosticsTimersMu.Unlock()
+		if file, ok := getFile(uri); ok && ctx.Err() == nil {
+			publishDiagnostics(ctx, conn, file)
+		}
+	})
+	diagnosticsTimers[uri] = timer
+}
+
+// for a document that was closed, nothing is published for it afterwards
+func cancelScheduledDiagnostics(uri string) {
+	diagnosticsTimersMu.Lock()
+	defer diagnosticsTimersMu.Unlock()
+	if timer, ok := diagnosticsTimers[uri]; ok {
+		timer.Stop()
+		delete(diagnosticsTimers, uri)
+	}
+}
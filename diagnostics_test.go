@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// a sync def nested in an async one can't await, a call there isn't flagged
+func TestUnawaitedCalls(t *testing.T) {
+	text := "async def fetch():\n    pass\n\nasync def main():\n    fetch()\n    x = fetch()\n    await fetch()\n    def helper():\n        fetch()\n\ndef sync():\n    fetch()\n"
+	diagnostics := unawaitedCalls(OpenFile{uri: "file:///a.py", content: text}, splitLines(text))
+	var lines []int
+	for _, d := range diagnostics {
+		lines = append(lines, d.Range.Start.Line)
+	}
+	if len(lines) != 2 || lines[0] != 4 || lines[1] != 5 {
+		t.Errorf("flagged lines %v, want [4 5]", lines)
+	}
+}
+
+// the publishes after each edit: a changed set goes out, an edit that leaves it as it was sends nothing
+func TestUnchangedDiagnosticsAreNotResent(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///churn.py"
+	published := func() *PublishDiagnosticsParams {
+		n := c.waitFor("textDocument/publishDiagnostics", 2*diagnosticsDelay+time.Second)
+		if n == nil {
+			return nil
+		}
+		var params PublishDiagnosticsParams
+		decodeNotification(t, n, &params)
+		return &params
+	}
+
+	c.open(uri, "def load():\n    pass\n\ndef load():\n    pass\n")
+	first := published()
+	if first == nil || len(first.Diagnostics) == 0 {
+		t.Fatalf("no diagnostics for a duplicate definition: %+v", first)
+	}
+
+	c.change(uri, 2, "def load():\n    pass\n\ndef load():\n    pass\n# a comment\n")
+	if again := published(); again != nil {
+		t.Errorf("republished the same diagnostics: %+v", again)
+	}
+
+	c.change(uri, 3, "def load():\n    pass\n\ndef save():\n    pass\n")
+	if fixed := published(); fixed == nil || len(fixed.Diagnostics) != 0 {
+		t.Errorf("after the fix: %+v, want an empty publish", fixed)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// every failed request is answered through replyError. handlers return one of the errors below (wrapped with
+// fmt.Errorf for detail) or a *jsonrpc2.Error they built themselves, replyError picks the code the client gets
+// and how loudly it's logged. notifications have nobody to answer, their errors are only logged
+
+// LSP's codes, jsonrpc2 only has the JSON-RPC ones
+const (
+	codeServerNotInitialized = -32002
+	codeRequestCancelled     = -32800
+	codeContentModified      = -32801
+	codeRequestFailed        = -32803
+)
+
+// pypls's own, counting down from the bottom of the range JSON-RPC leaves to servers (-32000 to -32099)
+const (
+	codeDocumentNotOpen = -32099
+)
+
+var (
+	ErrDocumentNotOpen = errors.New("document not open")
+	ErrInvalidPosition = errors.New("invalid position")
+	ErrNotInitialized  = errors.New("server not initialized")
+	ErrCancelled       = errors.New("request cancelled")
+)
+
+func documentNotOpen(uri string) error {
+	return fmt.Errorf("%w: %s", ErrDocumentNotOpen, uri)
+}
+
+// pos has to be on one of the document's lines, or just past the last one. a character past the end of its line
+// is fine, editors send those and they are read as the end of the line
+func checkPosition(file OpenFile, pos Position) error {
+	if pos.Line < 0 || pos.Character < 0 || pos.Line > len(splitLines(file.content)) {
+		return fmt.Errorf("%w: line %d, character %d", ErrInvalidPosition, pos.Line, pos.Character)
+	}
+	return nil
+}
+
+// the JSON-RPC error for err, anything not recognised is an internal error
+func rpcError(err error) *jsonrpc2.Error {
+	var rpcErr *jsonrpc2.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	code := int64(jsonrpc2.CodeInternalError)
+	switch {
+	case errors.Is(err, ErrDocumentNotOpen):
+		code = codeDocumentNotOpen
+	case errors.Is(err, ErrInvalidPosition):
+		code = jsonrpc2.CodeInvalidParams
+	case errors.Is(err, ErrNotInitialized):
+		code = codeServerNotInitialized
+	case errors.Is(err, ErrCancelled):
+		code = codeRequestCancelled
+	}
+	return &jsonrpc2.Error{Code: code, Message: err.Error()}
+}
+
+// a cancelled or outdated request is routine and a bad request is the client's to fix, both only show up when
+// tracing. an internal error is always worth a warning, and so is a notification that failed since nothing else
+// will ever say so
+func replyError(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, err error) {
+	rpcErr := rpcError(err)
+	message := req.Method + ": " + rpcErr.Message
+	if req.Notif {
+		warn(ctx, conn, message)
+		return
+	}
+	if rpcErr.Code == jsonrpc2.CodeInternalError {
+		warn(ctx, conn, message)
+	}else{
+		log(ctx, conn, message)
+	}
+	conn.ReplyWithError(ctx, req.ID, rpcErr)
+}
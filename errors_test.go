@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestRPCErrorCodes(t *testing.T) {
+	own := &jsonrpc2.Error{Code: codeContentModified, Message: "document changed"}
+	tests := []struct {
+		name string
+		err  error
+		code int64
+	}{
+		{"document not open", documentNotOpen("file:///gone.py"), codeDocumentNotOpen},
+		{"invalid position", fmt.Errorf("%w: line -1", ErrInvalidPosition), jsonrpc2.CodeInvalidParams},
+		{"not initialized", ErrNotInitialized, codeServerNotInitialized},
+		{"cancelled", ErrCancelled, codeRequestCancelled},
+		{"wrapped jsonrpc2 error", fmt.Errorf("hover: %w", own), codeContentModified},
+		{"anything else", errors.New("index out of range"), jsonrpc2.CodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rpcError(tt.err)
+			if got.Code != tt.code {
+				t.Errorf("rpcError(%v).Code = %d, want %d", tt.err, got.Code, tt.code)
+			}
+			if got.Message == "" {
+				t.Error("empty message")
+			}
+		})
+	}
+	if got := rpcError(fmt.Errorf("hover: %w", own)); got != own {
+		t.Errorf("a *jsonrpc2.Error comes back as %v, want the same error", got)
+	}
+}
+
+func TestCheckPosition(t *testing.T) {
+	file := OpenFile{content: "a = 1\nb = 2\n"}
+	for _, pos := range []Position{{0, 0}, {1, 40}, {2, 0}} {
+		if err := checkPosition(file, pos); err != nil {
+			t.Errorf("checkPosition(%v) = %v", pos, err)
+		}
+	}
+	for _, pos := range []Position{{-1, 0}, {0, -1}, {9, 0}} {
+		if err := checkPosition(file, pos); !errors.Is(err, ErrInvalidPosition) {
+			t.Errorf("checkPosition(%v) = %v, want ErrInvalidPosition", pos, err)
+		}
+	}
+}
+
+func TestErrorsOnTheWire(t *testing.T) {
+	c := newTestConnection(t)
+	err := c.callErr("textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": "file:///a.py"}, "position": Position{0, 0}}, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != codeServerNotInitialized {
+		t.Errorf("before initialize: %v, want ServerNotInitialized", err)
+	}
+
+	c = newTestServer(t, nil, nil)
+	err = c.callErr("textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": "file:///missing.py"}, "position": Position{0, 0}}, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != codeDocumentNotOpen {
+		t.Errorf("hover on a document that isn't open: %v, want DocumentNotOpen", err)
+	}
+	err = c.callErr("pypls/noSuchRequest", nil, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != jsonrpc2.CodeMethodNotFound {
+		t.Errorf("unknown request: %v, want MethodNotFound", err)
+	}
+}
+
+// notifications the server doesn't handle are dropped without a word, the client sends plenty of them
+func TestUnknownNotificationsAreIgnored(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	for len(c.notifications) > 0 {
+		<-c.notifications
+	}
+	c.notify("workspace/didChangeWatchedFiles", map[string]any{"changes": []any{}})
+	c.notify("$/progress", map[string]any{"token": 1, "value": map[string]any{}})
+	c.call("pypls/ping", nil, nil)
+	if n := c.waitFor("window/logMessage", 100*time.Millisecond); n != nil {
+		t.Errorf("got a log message for an unknown notification: %s", *n.Params)
+	}
+}
+
+func TestDidCloseForgetsTheDocument(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///closing.py"
+	c.open(uri, "x = 1\n")
+	c.call("pypls/ping", nil, nil)
+	if _, ok := getFile(uri); !ok {
+		t.Fatal("not open after didOpen")
+	}
+	c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	c.call("pypls/ping", nil, nil)
+	if _, ok := getFile(uri); ok {
+		t.Error("still open after didClose")
+	}
+	err := c.callErr("textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{0, 0}}, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != codeDocumentNotOpen {
+		t.Errorf("hover after close: %v, want DocumentNotOpen", err)
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	raw := func(s string) *json.RawMessage {
+		m := json.RawMessage(s)
+		return &m
+	}
+	tests := []struct {
+		name    string
+		params  *json.RawMessage
+		code    int64
+		mention string
+	}{
+		{"missing params", nil, jsonrpc2.CodeInvalidParams, "missing params"},
+		{"malformed json", raw(`{"position": {"line": 1,`), jsonrpc2.CodeParseError, "completion"},
+		{"wrong type", raw(`{"textDocument": {"uri": "file:///a.py"}, "position": {"line": "1", "character": 0}}`), jsonrpc2.CodeInvalidParams, "position.line"},
+		{"array for object", raw(`{"textDocument": [], "position": {"line": 0, "character": 0}}`), jsonrpc2.CodeInvalidParams, "textDocument"},
+	}
+	type completionParams struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Position Position `json:"position"`
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params completionParams
+			err := decodeParams(&jsonrpc2.Request{Method: "textDocument/completion", Params: tt.params}, &params, "completion")
+			if err == nil || err.Code != tt.code || !strings.Contains(err.Message, tt.mention) {
+				t.Errorf("decodeParams = %v, want code %d mentioning %q", err, tt.code, tt.mention)
+			}
+		})
+	}
+	var params completionParams
+	if err := decodeParams(&jsonrpc2.Request{Params: raw(`{"textDocument": {"uri": "file:///a.py"}, "position": {"line": 1, "character": 2}}`)}, &params, "completion"); err != nil {
+		t.Errorf("well formed params: %v", err)
+	}
+}
+
+// a field that's there in the JSON but not in the request is InvalidParams naming it
+func TestMissingFieldsOnTheWire(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	c.open("file:///a.py", "x = 1\n")
+	tests := []struct {
+		method  string
+		params  any
+		mention string
+	}{
+		{"textDocument/completion", map[string]any{"textDocument": map[string]any{"uri": "file:///a.py"}}, "position"},
+		{"textDocument/hover", map[string]any{"textDocument": map[string]any{}, "position": Position{0, 0}}, "textDocument.uri"},
+		{"textDocument/completion", map[string]any{"textDocument": map[string]any{"uri": 7}, "position": Position{0, 0}}, "textDocument.uri"},
+	}
+	for _, tt := range tests {
+		err := c.callErr(tt.method, tt.params, nil)
+		rpcErr, ok := err.(*jsonrpc2.Error)
+		if !ok || rpcErr.Code != jsonrpc2.CodeInvalidParams || !strings.Contains(rpcErr.Message, tt.mention) {
+			t.Errorf("%s %v: %v, want InvalidParams mentioning %s", tt.method, tt.params, err, tt.mention)
+		}
+	}
+}
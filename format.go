@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+)
+
+// textDocument/willSaveWaitUntil: trailing whitespace off every line and exactly one newline at the end. only the
+// lines that need it get an edit, and whitespace inside a multi-line string is content so it's left alone
+func saveEdits(file OpenFile, opts Options) []TextEdit {
+	edits := make([]TextEdit, 0)
+	lines := splitLines(file.content)
+	if file.content == "" {
+		return edits
+	}
+
+	inString := make(map[int]bool) // lines whose end is inside a string
+	for _, tok := range tokenizeLanguage(file.content, languageFor(file.languageId)) {
+		if tok.kind != tokenString { continue }
+		for l := tok.line; l < tok.endLine; l++ {
+			inString[l] = true
+		}
+	}
+
+	last := len(lines) - 1
+	if opts.InsertFinalNewline {
+		for last > 0 && strings.TrimSpace(lines[last]) == "" {
+			last--
+		}
+	}
+
+	trimmedEnd := func(i int) int {
+		if opts.TrimTrailingWhitespace && !inString[i] {
+			return len(strings.TrimRight(lines[i], " \t"))
+		}
+		return len(lines[i])
+	}
+
+	for i := 0; i <= last; i++ {
+		if i == last && opts.InsertFinalNewline { continue } // the final newline edit takes care of it
+		if end := trimmedEnd(i); end < len(lines[i]) {
+			edits = append(edits, TextEdit{rangeOnLine(lines, i, end, len(lines[i])), ""})
+		}
+	}
+
+	if opts.InsertFinalNewline {
+		newline := "\n"
+		if strings.Contains(file.content, "\r\n") {
+			newline = "\r\n"
+		}
+		end := trimmedEnd(last)
+		if last == 0 && lines[0] == "" {
+			return edits // nothing but blank lines
+		}
+		if end < len(lines[last]) || last != len(lines)-2 || lines[len(lines)-1] != "" {
+			edits = append(edits, TextEdit{Range{
+				Position{last, lineCharacter(lines[last], end)},
+				Position{len(lines) - 1, lineCharacter(lines[len(lines)-1], len(lines[len(lines)-1]))},
+			}, newline})
+		}
+	}
+	return edits
+}
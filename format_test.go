@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+// the edits applied back to front, the way the client would. positions are taken as bytes, the texts here are ascii
+func applyEdits(content string, edits []TextEdit) string {
+	lines := splitLines(content)
+	offset := func(p Position) int {
+		n := 0
+		for _, line := range lines[:p.Line] {
+			n += len(line) + 1
+		}
+		return n + p.Character
+	}
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		content = content[:offset(e.Range.Start)] + e.NewText + content[offset(e.Range.End):]
+	}
+	return content
+}
+
+func TestSaveEdits(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+		edits            int
+	}{
+		{"trailing spaces and no final newline", "x = 1   \ny = 2\t\nz = 3", "x = 1\ny = 2\nz = 3\n", 3},
+		{"already clean", "x = 1\ny = 2\n", "x = 1\ny = 2\n", 0},
+		{"extra blank lines at the end", "x = 1\n\n  \n\n", "x = 1\n", 1},
+		{"spaces on the last line", "x = 1  ", "x = 1\n", 1},
+		{"inside a multi-line string", "s = '''a  \nb  \n'''  \n", "s = '''a  \nb  \n'''\n", 1},
+		{"blank document", "\n\n", "\n\n", 0},
+	}
+	opts := defaultOptions()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := saveEdits(OpenFile{content: tt.text, languageId: "python"}, opts)
+			if got := applyEdits(tt.text, edits); got != tt.want {
+				t.Errorf("cleaned to %q, want %q", got, tt.want)
+			}
+			if len(edits) != tt.edits {
+				t.Errorf("%d edits, want %d: %v", len(edits), tt.edits, edits)
+			}
+		})
+	}
+}
+
+func TestSaveEditsOptions(t *testing.T) {
+	text := "x = 1  \ny = 2"
+	opts := defaultOptions()
+	opts.InsertFinalNewline = false
+	if got := applyEdits(text, saveEdits(OpenFile{content: text, languageId: "python"}, opts)); got != "x = 1\ny = 2" {
+		t.Errorf("trim only: %q", got)
+	}
+	opts = defaultOptions()
+	opts.TrimTrailingWhitespace = false
+	if got := applyEdits(text, saveEdits(OpenFile{content: text, languageId: "python"}, opts)); got != "x = 1  \ny = 2\n" {
+		t.Errorf("final newline only: %q", got)
+	}
+}
+
+func TestWillSaveWaitUntil(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///saved.py"
+	text := "def f():  \n    return 1 \n\n\n"
+	c.open(uri, text)
+	var edits []TextEdit
+	c.call("textDocument/willSaveWaitUntil", map[string]any{"textDocument": map[string]any{"uri": uri}, "reason": 1}, &edits)
+	if got := applyEdits(text, edits); got != "def f():\n    return 1\n" {
+		t.Errorf("saved as %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// every knob of the completion match score lives here so tuning one doesn't mean hunting through the matcher
+var matchWeights = struct {
+	exactCase   int // a query character matching with the same case
+	foldedCase  int // a query character matching only when case is ignored
+	boundary    int // the match lands on a word start: first character, after `_`, or a camelCase hump
+	consecutive int // the match directly follows the previous one
+	prefix      int // the whole query is a prefix of the candidate
+	unmatched   int // per candidate character left unmatched, so shorter candidates win ties
+	caseStyle   int // the candidate is written in the same case style as a query that clearly has one
+}{
+	exactCase:   10,
+	foldedCase:  6,
+	boundary:    8,
+	consecutive: 5,
+	prefix:      15,
+	unmatched:   1,
+	caseStyle:   12,
+}
+
+// subsequence match of query in candidate, ok is false when it doesn't match at all. an all lowercase query
+// ignores case entirely (smartcase), otherwise matching case counts for more than matching letters
+func fuzzyScore(query string, candidate string) (score int, ok bool) {
+	q := []rune(query)
+	c := []rune(candidate)
+	smartcase := query == strings.ToLower(query)
+
+	pos := 0
+	last := -2
+	for qi, qr := range q {
+		at := nextMatch(q[qi:], c, pos, last)
+		if at < 0 {
+			return 0, false
+		}
+
+		if c[at] == qr || smartcase {
+			score += matchWeights.exactCase
+		}else{
+			score += matchWeights.foldedCase
+		}
+		if isBoundary(c, at) {
+			score += matchWeights.boundary
+		}
+		if at == last+1 {
+			score += matchWeights.consecutive
+		}
+		last = at
+		pos = at + 1
+	}
+
+	if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(query)) {
+		score += matchWeights.prefix
+	}
+	score -= (len(c) - len(q)) * matchWeights.unmatched
+	if style := caseStyleOf(query); style != styleUnclear && style != styleLower && caseStyleOf(candidate) == style {
+		score += matchWeights.caseStyle
+	}
+	return score, true
+}
+
+type caseStyle int
+
+const (
+	styleUnclear   caseStyle = iota
+	styleLower               // plain lowercase, `count`
+	styleSnake               // `max_size`
+	styleScreaming           // `MAX_SIZE`
+	styleCamel               // `maxSize`
+	stylePascal              // `MaxSize`
+)
+
+// how a name is written. a one letter name or a lowercase one without underscores says too little to count as
+// a style when it's the query, `max` could be the start of anything
+func caseStyleOf(name string) caseStyle {
+	upper, lower, underscore := 0, 0, strings.Contains(strings.Trim(name, "_"), "_")
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			upper++
+		}else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	first, _ := utf8.DecodeRuneInString(strings.TrimLeft(name, "_"))
+	switch {
+	case upper+lower < 2:
+		return styleUnclear
+	case lower == 0:
+		return styleScreaming
+	case upper == 0 && underscore:
+		return styleSnake
+	case upper == 0:
+		return styleLower
+	case unicode.IsUpper(first) && !underscore:
+		return stylePascal
+	case unicode.IsLower(first) && !underscore:
+		return styleCamel
+	}
+	return styleUnclear
+}
+
+// where the first rune of q should match in c starting at pos. a directly following character is preferred,
+// then the first word boundary that still leaves the rest of the query matchable, then plain first occurrence
+func nextMatch(q []rune, c []rune, pos int, last int) int {
+	first := -1
+	for i := pos; i < len(c); i++ {
+		if unicode.ToLower(c[i]) != unicode.ToLower(q[0]) { continue }
+		if i == last+1 {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+		if isBoundary(c, i) && fuzzyMatch(string(q[1:]), string(c[i+1:])) {
+			return i
+		}
+	}
+	return first
+}
+
+func isBoundary(c []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := c[i-1]
+	return prev == '_' || unicode.IsLower(prev) && unicode.IsUpper(c[i]) || !unicode.IsLetter(prev) && unicode.IsLetter(c[i])
+}
+
+// case-insensitive subsequence match, the same loose matching most editors apply on their side
+func fuzzyMatch(query string, candidate string) bool {
+	candidate = strings.ToLower(candidate)
+	for _, q := range strings.ToLower(query) {
+		i := strings.IndexRune(candidate, q)
+		if i < 0 {
+			return false
+		}
+		candidate = candidate[i+utf8.RuneLen(q):]
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+// pairs of candidates for a query, the first has to score higher. a change to matchWeights that flips one of
+// these is a ranking regression unless the row is changed on purpose
+func TestFuzzyScoreOrder(t *testing.T) {
+	tests := []struct {
+		query, better, worse string
+	}{
+		{"get_u", "get_user", "getUser"},
+		{"getU", "getUser", "get_user"},
+		{"HTTPS", "HTTPS_PORT", "https_port"},
+		{"HTTPS", "HTTPS_PORT", "HttpsPort"},
+		{"https", "https_port", "HTTPS_PORT_NUMBER"},
+		{"gu", "get_user", "gauge"},
+		{"gu", "getUser", "fragile_url"},
+		{"cou", "count", "account"},
+		{"cou", "count", "counter"},
+		{"ret", "retry", "parse_tree"},
+		{"Resp", "Response", "response_parser"},
+		{"mx", "max_x", "mixin"},
+		{"MAX_", "MAX_SIZE", "maxSize"},
+		{"MAX", "MAX_SIZE", "maxSize"},
+		{"maxS", "maxSize", "MAX_SIZE"},
+	}
+	for _, tt := range tests {
+		better, ok := fuzzyScore(tt.query, tt.better)
+		if !ok {
+			t.Errorf("%q doesn't match %q", tt.query, tt.better)
+			continue
+		}
+		worse, ok := fuzzyScore(tt.query, tt.worse)
+		if !ok { continue } // not offered at all
+		if better <= worse {
+			t.Errorf("%q: %q scores %d, not above %q at %d", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
+
+func TestFuzzyScoreNoMatch(t *testing.T) {
+	for _, tt := range [][2]string{{"xyz", "count"}, {"cnuot", "count"}, {"counts", "count"}} {
+		if score, ok := fuzzyScore(tt[0], tt[1]); ok {
+			t.Errorf("fuzzyScore(%q, %q) = %d, want no match", tt[0], tt[1], score)
+		}
+	}
+}
+
+func TestCaseStyleOf(t *testing.T) {
+	tests := map[string]caseStyle{
+		"count": styleLower, "max_size": styleSnake, "MAX_SIZE": styleScreaming, "maxSize": styleCamel,
+		"MaxSize": stylePascal, "x": styleUnclear, "_private_name": styleSnake, "HTTPS": styleScreaming,
+	}
+	for name, want := range tests {
+		if got := caseStyleOf(name); got != want {
+			t.Errorf("caseStyleOf(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
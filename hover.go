@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+)
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+func markdownHover(value string) *Hover {
+	return &Hover{Contents: MarkupContent{"markdown", value}}
+}
+
+func codeBlock(code string) string {
+	return "```python\n" + code + "\n```"
+}
+
+// shows the line the word is defined on, that's the signature for defs and classes and the value for assignments.
+// assignments get the inferred type of the variable on top, the way other python servers show it
+func definitionHover(uri string, word string, files map[string]OpenFile) *Hover {
+	locations := definitionLocations(uri, word, files)
+	if len(locations) == 0 {
+		return nil
+	}
+
+	loc := locations[0]
+	file, ok := files[loc.URI]
+	if !ok {
+		return nil
+	}
+	lines := splitLines(file.content)
+	if loc.Range.Start.Line >= len(lines) {
+		return nil
+	}
+
+	source := strings.TrimSpace(lines[loc.Range.Start.Line])
+	if t := file.variableTypeMap[word]; t != "" && simpleAssignRe.MatchString(lines[loc.Range.Start.Line]) {
+		source = "(variable) " + word + ": " + t + "\n" + source
+	}
+	return markdownHover(codeBlock(source))
+}
+
+// `Color.RED` shows `Color.RED = 1` when Color is an Enum in the same file
+func enumMemberHover(content string, leadup []string, word string) *Hover {
+	if len(leadup) == 0 {
+		return nil
+	}
+	className := leadup[len(leadup)-1]
+	value, found := resolveEnumMember(content, className, word)
+	if !found {
+		return nil
+	}
+	return markdownHover(codeBlock(className + "." + word + " = " + value))
+}
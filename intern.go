@@ -0,0 +1,205 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the word and attribute indexes of every open document share one copy of each identifier. documents hold
+// small ids instead of strings and keep their counts in a sorted slice rather than a map, which is what most
+// of the memory went to with many documents open.
+//
+// ids aren't freed one by one, a document's counts carry the table they were built against instead. once the
+// current table has grown to twice what the open documents used when it was made, compactSymbols moves every
+// open document to a fresh one and the old table goes with the last snapshot still holding it
+
+type symbolID uint32
+
+type internTable struct {
+	mu    sync.RWMutex
+	ids   map[string]symbolID
+	names []string
+}
+
+func newInternTable() *internTable {
+	return &internTable{ids: make(map[string]symbolID)}
+}
+
+// the table new documents are indexed into
+var interned atomic.Pointer[internTable]
+
+// the size interned has to reach before the next compaction
+var compactAt atomic.Int64
+
+const minCompactSize = 1 << 14
+
+func init() {
+	interned.Store(newInternTable())
+	compactAt.Store(minCompactSize)
+}
+
+func (t *internTable) intern(name string) symbolID {
+	t.mu.RLock()
+	id, ok := t.ids[name]
+	t.mu.RUnlock()
+	if ok {
+		return id
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id, ok := t.ids[name]; ok {
+		return id
+	}
+	name = strings.Clone(name) // names are often slices of a whole document, which shouldn't stay alive with them
+	id = symbolID(len(t.names))
+	t.ids[name] = id
+	t.names = append(t.names, name)
+	return id
+}
+
+// the id of a name already interned, without adding it. a nil table (a document that wasn't indexed) has none
+func (t *internTable) lookup(name string) (symbolID, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	id, ok := t.ids[name]
+	return id, ok
+}
+
+// the names so far. entries are never changed once added so the returned slice can be read without the lock
+func (t *internTable) snapshot() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.names
+}
+
+func (t *internTable) size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.names)
+}
+
+type wordCount struct {
+	id    symbolID
+	count uint32
+}
+
+// how often each word occurs, sorted by id
+type wordCounts struct {
+	symbols *internTable
+	counts  []wordCount
+}
+
+func compactWords(symbols *internTable, words map[string]int64) wordCounts {
+	compact := make([]wordCount, 0, len(words))
+	for word, count := range words {
+		compact = append(compact, wordCount{symbols.intern(word), uint32(count)})
+	}
+	sort.Slice(compact, func(i, j int) bool { return compact[i].id < compact[j].id })
+	return wordCounts{symbols, compact}
+}
+
+func (w wordCounts) len() int {
+	return len(w.counts)
+}
+
+func (w wordCounts) count(word string) int64 {
+	id, ok := w.symbols.lookup(word)
+	if !ok {
+		return 0
+	}
+	i := sort.Search(len(w.counts), func(i int) bool { return w.counts[i].id >= id })
+	if i < len(w.counts) && w.counts[i].id == id {
+		return int64(w.counts[i].count)
+	}
+	return 0
+}
+
+func (w wordCounts) each(fn func(word string, count int64)) {
+	names := w.symbols.snapshot()
+	for _, c := range w.counts {
+		fn(names[c.id], int64(c.count))
+	}
+}
+
+func (w wordCounts) toMap() map[string]int64 {
+	words := make(map[string]int64, len(w.counts))
+	w.each(func(word string, count int64) { words[word] = count })
+	return words
+}
+
+// attribute counts per dotted receiver, the receivers interned in the same table as the attributes
+type receiverCounts struct {
+	symbols    *internTable
+	byReceiver map[symbolID][]wordCount
+}
+
+func compactReceivers(symbols *internTable, byReceiver map[string]map[string]int64) receiverCounts {
+	compact := make(map[symbolID][]wordCount, len(byReceiver))
+	for receiver, names := range byReceiver {
+		compact[symbols.intern(receiver)] = compactWords(symbols, names).counts
+	}
+	return receiverCounts{symbols, compact}
+}
+
+// the attributes seen on receiver
+func (r receiverCounts) of(receiver string) wordCounts {
+	id, ok := r.symbols.lookup(receiver)
+	if !ok {
+		return wordCounts{}
+	}
+	return wordCounts{r.symbols, r.byReceiver[id]}
+}
+
+func (r receiverCounts) entries() int {
+	n := 0
+	for _, names := range r.byReceiver {
+		n += len(names)
+	}
+	return n
+}
+
+// the same counts with their ids in another table
+func (w wordCounts) moveTo(symbols *internTable) wordCounts {
+	names := w.symbols.snapshot()
+	moved := make([]wordCount, len(w.counts))
+	for i, c := range w.counts {
+		moved[i] = wordCount{symbols.intern(names[c.id]), c.count}
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].id < moved[j].id })
+	return wordCounts{symbols, moved}
+}
+
+func (r receiverCounts) moveTo(symbols *internTable) receiverCounts {
+	names := r.symbols.snapshot()
+	moved := make(map[symbolID][]wordCount, len(r.byReceiver))
+	for id, counts := range r.byReceiver {
+		moved[symbols.intern(names[id])] = wordCounts{r.symbols, counts}.moveTo(symbols).counts
+	}
+	return receiverCounts{symbols, moved}
+}
+
+// a fresh table with only what the open documents use, once the current one is mostly names of documents that
+// have since changed or closed. called with filesMu held for writing
+func compactSymbols() {
+	if int64(interned.Load().size()) < compactAt.Load() {
+		return
+	}
+	fresh := newInternTable()
+	for uri, f := range files {
+		if f.tooLarge { continue }
+		f.words = f.words.moveTo(fresh)
+		f.attributes = f.attributes.moveTo(fresh)
+		f.receiverAttributes = f.receiverAttributes.moveTo(fresh)
+		files[uri] = f
+	}
+	interned.Store(fresh)
+	compactAt.Store(max(minCompactSize, 2*int64(fresh.size())))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// a module of lines, half its names shared with every other document and half its own
+func syntheticDocument(n, lines int) string {
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "    result_%d = self.client.fetch_%d(value_%d, timeout=%d)  # retry %d\n", i%200, i%50, n*lines+i, i%30, i%7)
+	}
+	return b.String()
+}
+
+func heapAlloc() int64 {
+	runtime.GC()
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return int64(mem.HeapAlloc)
+}
+
+type mapIndex struct {
+	words, attributes map[string]int64
+	byReceiver        map[string]map[string]int64
+}
+
+// the word and attribute indexes of N documents as string keyed maps and compacted over the intern table,
+// HeapAlloc measured before and after building each
+func TestCompactIndexMemory(t *testing.T) {
+	resetServerState()
+	const documents, lines = 50, 1500
+	contents := make([]string, documents)
+	for n := range contents {
+		contents[n] = syntheticDocument(n, lines)
+	}
+	lang := languageFor("python")
+
+	before := heapAlloc()
+	maps := make([]mapIndex, documents)
+	for n, content := range contents {
+		attributes, byReceiver, _ := getAttributes(content, lang)
+		maps[n] = mapIndex{getWords(&content), attributes, byReceiver}
+	}
+	mapBytes := heapAlloc() - before
+	runtime.KeepAlive(maps)
+	maps = nil
+
+	before = heapAlloc()
+	compact := make([]OpenFile, documents)
+	for n, content := range contents {
+		attributes, byReceiver, _ := getAttributes(content, lang)
+		symbols := interned.Load()
+		compact[n] = OpenFile{words: compactWords(symbols, getWords(&content)), attributes: compactWords(symbols, attributes), receiverAttributes: compactReceivers(symbols, byReceiver)}
+	}
+	compactBytes := heapAlloc() - before
+	runtime.KeepAlive(compact)
+
+	t.Logf("%d documents of %d lines: maps %d KB, compact %d KB, %d interned", documents, lines, mapBytes>>10, compactBytes>>10, interned.Load().size())
+	if compactBytes*3 > mapBytes {
+		t.Errorf("compact index is %d bytes against %d for maps, want at least a 3x reduction", compactBytes, mapBytes)
+	}
+}
+
+// documents edited over and over leave their old names behind until the table is compacted, what's still open
+// reads the same before and after and a snapshot taken before keeps working
+func TestInternTableIsCompacted(t *testing.T) {
+	resetServerState()
+	setFile(pythonFile("file:///kept.py", "kept_name = kept_name + 1\nclient.kept_call()\n"))
+	old, _ := getFile("file:///kept.py")
+
+	uri := "file:///edited.py"
+	for version := 1; version <= 100; version++ {
+		var b strings.Builder
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(&b, "process(value_%d)\n", version*200+i)
+		}
+		setFile(pythonFile(uri, b.String()))
+	}
+	if size := interned.Load().size(); size >= minCompactSize {
+		t.Errorf("intern table has %d names after 100 edits of 200 new names each, it isn't being compacted", size)
+	}
+
+	kept, _ := getFile("file:///kept.py")
+	if kept.words.symbols != interned.Load() {
+		t.Error("an open document was left on the old table")
+	}
+	for _, f := range []OpenFile{old, kept} {
+		if got := f.words.count("kept_name"); got != 2 {
+			t.Errorf("kept_name counted %d, want 2", got)
+		}
+		if got := f.receiverAttributes.of("client").count("kept_call"); got != 1 {
+			t.Errorf("client.kept_call counted %d, want 1", got)
+		}
+	}
+	edited, _ := getFile(uri)
+	if got := edited.words.count(fmt.Sprintf("value_%d", 100*200)); got != 1 {
+		t.Errorf("the last edit's own name counted %d, want 1", got)
+	}
+}
+
+func BenchmarkIndexDocument(b *testing.B) {
+	content := syntheticDocument(0, 1500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pythonFile("file:///bench.py", content)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// textDocument/linkedEditingRange, the in-file half of rename done live as the user types. only names the scope
+// analyzer can pin to a scope of this file qualify, attributes and imported names are left to rename since
+// changing them here alone would break the code elsewhere
+
+type LinkedEditingRanges struct {
+	Ranges      []Range `json:"ranges"`
+	WordPattern string  `json:"wordPattern,omitempty"`
+}
+
+// what the editor should still treat as the name while it's being typed over
+const identifierPattern = `[A-Za-z_][A-Za-z0-9_]*`
+
+func linkedEditingRanges(file OpenFile, pos Position) *LinkedEditingRanges {
+	word, start, _, inCode := wordAtPosition(file.content, pos.Line, pos.Character)
+	if !inCode || word == "" || pythonKeywords[word] {
+		return nil
+	}
+	tokens := tokenize(file.content)
+	at := -1
+	for i, tok := range tokens {
+		if tok.kind == tokenIdentifier && tok.line == pos.Line && tok.start == start && tok.text == word {
+			at = i
+			break
+		}
+	}
+	if at < 0 || afterDot(tokens, at) {
+		return nil
+	}
+
+	root := analyzeScopes(file.content)
+	target, ok := root.scopeAt(tokens[at].line, tokens[at].start).lookup(word)
+	if !ok || target.kind == scopeClass || target.bindings[word][0].kind == bindImport {
+		return nil // builtins and undefined names resolve nowhere
+	}
+
+	lines := splitLines(file.content)
+	ranges := make([]Range, 0)
+	for i, tok := range tokens {
+		if tok.kind != tokenIdentifier || tok.text != word || afterDot(tokens, i) { continue }
+		if s, ok := root.scopeAt(tok.line, tok.start).lookup(word); ok && s == target {
+			ranges = append(ranges, rangeOnLine(lines, tok.line, tok.start, tok.end))
+		}
+	}
+	return &LinkedEditingRanges{ranges, identifierPattern}
+}
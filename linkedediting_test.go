@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const linkedSource = "def total(items):\n    count = 0\n    for item in items:\n        count += item\n    return count\n\ncount = total([1])\nprint(count, obj.count, 'count')\n"
+
+func wordRange(line, start, end int) Range {
+	return Range{Position{line, start}, Position{line, end}}
+}
+
+// every occurrence of the name in its scope, from any one of them, and nothing of a same-named name elsewhere
+func TestLinkedEditingRangesCoverEveryOccurrence(t *testing.T) {
+	local := []Range{wordRange(1, 4, 9), wordRange(3, 8, 13), wordRange(4, 11, 16)}
+	module := []Range{wordRange(6, 0, 5), wordRange(7, 6, 11)}
+	tests := []struct {
+		at   Position
+		want []Range
+	}{
+		{Position{1, 4}, local}, {Position{3, 10}, local}, {Position{4, 16}, local},
+		{Position{6, 2}, module}, {Position{7, 6}, module},
+		{Position{0, 11}, []Range{wordRange(0, 10, 15), wordRange(2, 16, 21)}},
+	}
+	file := OpenFile{content: linkedSource}
+	for _, tt := range tests {
+		got := linkedEditingRanges(file, tt.at)
+		if got == nil || !reflect.DeepEqual(got.Ranges, tt.want) || got.WordPattern != identifierPattern {
+			t.Errorf("at %v: %+v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+// keywords, builtins, attributes and string contents have nothing to link
+func TestLinkedEditingRangesNone(t *testing.T) {
+	file := OpenFile{content: linkedSource}
+	for _, at := range []Position{{2, 5}, {7, 1}, {7, 19}, {7, 27}, {5, 0}} {
+		if got := linkedEditingRanges(file, at); got != nil {
+			t.Errorf("at %v: %+v, want null", at, got)
+		}
+	}
+}
+
+func TestLinkedEditingRangeRequest(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///linked.py"
+	c.open(uri, linkedSource)
+	var got *LinkedEditingRanges
+	c.call("textDocument/linkedEditingRange", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{7, 8}}, &got)
+	if got == nil || len(got.Ranges) != 2 {
+		t.Errorf("linkedEditingRange = %+v", got)
+	}
+	got = nil
+	c.call("textDocument/linkedEditingRange", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{7, 2}}, &got)
+	if got != nil {
+		t.Errorf("on print: %+v, want null", got)
+	}
+}
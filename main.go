@@ -6,27 +6,80 @@ import (
 	"errors"
 	"io"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"unicode"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
 
 type CompletionItem struct {
-	Label         string `json:"label"`
-	Kind          int    `json:"kind"`
-	InsertText    string `json:"insertText"`
-	InsertTextFmt int    `json:"insertTextFormat,omitempty"`
-	SortText      string `json:"sortText"`
+	Label         string                      `json:"label"`
+	FilterText    string                      `json:"filterText,omitempty"`
+	Kind          int                         `json:"kind"`
+	InsertText    string                      `json:"insertText"`
+	InsertTextFmt int                         `json:"insertTextFormat,omitempty"`
+	SortText      string                      `json:"sortText"`
+	Detail        string                      `json:"detail,omitempty"`
+	LabelDetails  *CompletionItemLabelDetails `json:"labelDetails,omitempty"`
+	Documentation string                      `json:"documentation,omitempty"`
+	InsertTextMode int                        `json:"insertTextMode,omitempty"`
+	TextEdit      *TextEdit                   `json:"textEdit,omitempty"` // left out when the list's itemDefaults.editRange covers it
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+}
+
+type CompletionItemLabelDetails struct {
+	Detail      string `json:"detail,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type CompletionList struct {
+	IsIncomplete bool                    `json:"isIncomplete"`
+	ItemDefaults *CompletionItemDefaults `json:"itemDefaults,omitempty"`
+	Items        []CompletionItem        `json:"items"`
+}
+
+type CompletionItemDefaults struct {
+	EditRange Range `json:"editRange"`
 }
 
 type OpenFile struct {
 	uri string
 	content string
-	words map[string]int64
+	words wordCounts
+	languageId string
+	attributes wordCounts // names seen right after a `.`, with how often
+	receiverAttributes receiverCounts // the same per dotted receiver they were seen on
+	variableTypeMap map[string]string // the inferred type of each simply assigned variable, see variableType
+	todos []Todo // TODO, FIXME, HACK and XXX comments
+	version int // the client's textDocument.version of this content
+	tooLarge bool // over maxDocumentBytes, nothing above is worked out and only builtins are completed
+}
+
+func newOpenFile(uri string, languageId string, version int, content string) OpenFile {
+	if limit := getOptions().MaxDocumentBytes; limit > 0 && len(content) > limit {
+		return OpenFile{ uri: uri, content: content, languageId: languageId, variableTypeMap: map[string]string{}, version: version, tooLarge: true }
+	}
+	indexed := content
+	if getOptions().SkipComments {
+		indexed = stripComments(content, languageFor(languageId))
+	}
+	words := getWords(&indexed)
+	removeStopwords(words, getOptions())
+	attributes, byReceiver, comments := getAttributes(content, languageFor(languageId))
+	symbols := interned.Load()
+	todos := todosFrom(uri, languageFor(languageId), splitLines(content), comments)
+	return OpenFile{ uri, content, compactWords(symbols, words), languageId, compactWords(symbols, attributes), compactReceivers(symbols, byReceiver), variableTypeMap(content), todos, version, false }
 }
 
 var files map[string]OpenFile
+var filesMu sync.RWMutex // requests run on their own goroutines so anything touching files goes through the helpers below
 var defaultCompletions map[string]int64
 
 type LogMessageParams struct {
@@ -34,16 +87,151 @@ type LogMessageParams struct {
 	Message string `json:"message"`
 }
 
+// the client's trace setting from initialize and $/setTrace. "off", the default, drops the informational log
+// messages, "verbose" also traces every incoming message with $/logTrace. warnings always go out
+const (
+	traceOff      = "off"
+	traceMessages = "messages"
+	traceVerbose  = "verbose"
+)
+
+var traceLevel atomic.Value // string
+
+func getTraceLevel() string {
+	if level, ok := traceLevel.Load().(string); ok {
+		return level
+	}
+	return traceOff
+}
+
+func setTraceLevel(ctx context.Context, conn *jsonrpc2.Conn, level string) {
+	switch level {
+	case traceOff, traceMessages, traceVerbose:
+		traceLevel.Store(level)
+	case "":
+	default:
+		warn(ctx, conn, "unknown trace value " + strconv.Quote(level) + ", expected off, messages or verbose")
+	}
+}
+
+type LogTraceParams struct {
+	Message string `json:"message"`
+	Verbose string `json:"verbose,omitempty"`
+}
+
+func traceIncoming(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	message := "received notification " + req.Method
+	if !req.Notif {
+		message = "received request " + req.Method + " (" + req.ID.String() + ")"
+	}
+	params := ""
+	if req.Params != nil {
+		params = string(*req.Params)
+	}
+	conn.Notify(ctx, "$/logTrace", LogTraceParams{message, params})
+}
+
 func log(ctx context.Context, conn *jsonrpc2.Conn, message string) {
+	if getTraceLevel() == traceOff {
+		return
+	}
 	conn.Notify(ctx, "window/logMessage", LogMessageParams{
 		Type:    4,
 		Message: message,
 	})
 }
 
-type handler struct{}
+func warn(ctx context.Context, conn *jsonrpc2.Conn, message string) {
+	conn.Notify(ctx, "window/logMessage", LogMessageParams{
+		Type:    2,
+		Message: message,
+	})
+}
+
+type handler struct {
+	requests    requestPool
+	initialized bool // only touched by initialize, which runs on the read loop
+	warnedTooLarge map[string]bool // documents the user was told are over maxDocumentBytes, only touched on the read loop
+}
+
+// shown once for each document that goes over the limit, and again if it drops under and goes over once more
+func (h *handler) warnIfTooLarge(ctx context.Context, conn *jsonrpc2.Conn, file OpenFile) {
+	if !file.tooLarge {
+		delete(h.warnedTooLarge, file.uri)
+		return
+	}
+	if h.warnedTooLarge[file.uri] {
+		return
+	}
+	if h.warnedTooLarge == nil {
+		h.warnedTooLarge = make(map[string]bool)
+	}
+	h.warnedTooLarge[file.uri] = true
+	conn.Notify(ctx, "window/showMessage", LogMessageParams{
+		Type:    2,
+		Message: file.uri + " is larger than maxDocumentBytes (" + strconv.Itoa(getOptions().MaxDocumentBytes) + " bytes), only builtins are completed in it",
+	})
+}
+
+var startTime = time.Now()
+
+// what the client said it can do, set while handling initialize and only read after
+var clientSnippetSupport bool
+var clientHierarchicalSymbols bool
+var clientEditRangeDefault bool // completionList.itemDefaults has editRange, one shared range instead of a textEdit per item
+var clientAdjustIndentation bool // insertTextMode adjustIndentation, the client indents a multi-line insert's later lines itself
+
+// OpenFile values are never modified once stored, so a copy is a consistent snapshot of the document
+func getFile(uri string) (OpenFile, bool) {
+	filesMu.RLock()
+	defer filesMu.RUnlock()
+	file, ok := files[uri]
+	return file, ok
+}
+
+func setFile(file OpenFile) {
+	filesMu.Lock()
+	files[file.uri] = file
+	compactSymbols()
+	filesMu.Unlock()
+	invalidateCompletions() // after the store, see the completion handler
+}
+
+func deleteFile(uri string) {
+	filesMu.Lock()
+	delete(files, uri)
+	filesMu.Unlock()
+	invalidateCompletions()
+}
+
+// stores file unless the stored one is already at the same or a later version, a change arriving out of order
+// must not roll the document back
+func setFileIfNewer(file OpenFile) bool {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	if current, ok := files[file.uri]; ok && file.version <= current.version {
+		return false
+	}
+	files[file.uri] = file
+	compactSymbols()
+	invalidateCompletions()
+	return true
+}
+
+// documents over maxDocumentBytes are left out, nothing that looks across the open documents should scan those
+func snapshotFiles() map[string]OpenFile {
+	filesMu.RLock()
+	defer filesMu.RUnlock()
+	snapshot := make(map[string]OpenFile, len(files))
+	for uri, file := range files {
+		if !file.tooLarge {
+			snapshot[uri] = file
+		}
+	}
+	return snapshot
+}
 
-func getURI(req *jsonrpc2.Request) (string, error) {
+func getURI(req *jsonrpc2.Request) (string, *jsonrpc2.Error) {
 	var payload struct {
 		TextDocument struct {
 			URI string `json:"uri"`
@@ -51,36 +239,122 @@ func getURI(req *jsonrpc2.Request) (string, error) {
 	}
 	
 	// unmarshal the raw params into it
-	if err := json.Unmarshal(*req.Params, &payload); err != nil {
-		return "", errors.New("Failed to unmarshal payload")
+	if err := decodeParams(req, &payload, "textDocument"); err != nil {
+		return "", err
+	}
+	if payload.TextDocument.URI == "" {
+		return "", missingField("textDocument", "textDocument.uri")
 	}
 	
 	uri := payload.TextDocument.URI
 	return uri, nil
 }
 
+// some clients send the document version a request was made against. edits are applied on the read loop before
+// any later request is looked at, so the stored document is never behind one the client still has unless an edit
+// was dropped (bad params, out of order). answering from the older text then would point at the wrong places, the
+// client is told the content changed and asks again
+func replyIfBehind(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, file OpenFile) bool {
+	var payload struct {
+		TextDocument struct {
+			Version *int `json:"version"`
+		} `json:"textDocument"`
+	}
+	if req.Params == nil || json.Unmarshal(*req.Params, &payload) != nil || payload.TextDocument.Version == nil {
+		return false
+	}
+	if *payload.TextDocument.Version <= file.version {
+		return false
+	}
+	replyError(ctx, conn, req, &jsonrpc2.Error{
+		Code:    codeContentModified,
+		Message: "document is at version " + strconv.Itoa(file.version) + ", the request was made against " + strconv.Itoa(*payload.TextDocument.Version),
+	})
+	return true
+}
+
+// ParseError is for params that aren't JSON at all, valid JSON of the wrong shape is InvalidParams and says which
+// field was off
+func decodeParams(req *jsonrpc2.Request, v interface{}, what string) *jsonrpc2.Error {
+	if req.Params == nil {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "invalid " + what + " params: missing params"}
+	}
+	
+	var raw json.RawMessage
+	if err := json.Unmarshal(*req.Params, &raw); err != nil {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeParseError, Message: "invalid " + what + " params: " + err.Error()}
+	}
+	
+	if err := json.Unmarshal(raw, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInvalidParams,
+				Message: "invalid " + what + " params: expected " + typeErr.Field + " to be " + typeErr.Type.String() + ", got " + typeErr.Value,
+			}
+		}
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "invalid " + what + " params: " + err.Error()}
+	}
+	return nil
+}
+
+func missingField(what string, field string) *jsonrpc2.Error {
+	return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "invalid " + what + " params: expected field " + field}
+}
+
+// builtins rank like a word used this many times
+const builtinFrequency = 11
+
+// decorators are API surface, each `@name` counts this many extra uses of name
+const decoratorBoost = 3
+
 func getWords(text *string) map[string]int64 {
 	words := make(map[string]int64)
 	currentword := ""
 	
+	lineStart := true  // nothing but whitespace so far on this line
+	decorator := false // the current word directly follows an `@` at the start of a line
+	
 	for _, c := range *text {
 		if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
 			currentword += string(c)
 		}else{
-			if currentword != "" && defaultCompletions[currentword] == 0 { // let's not promote builtins because there *will* be more of those and we can all agree variables are *probably* more important
+			if currentword != "" && defaultCompletions[currentword] == 0 && !isNumberWord(currentword) { // let's not promote builtins because there *will* be more of those and we can all agree variables are *probably* more important
 				words[currentword] = words[currentword] + 1 // words[currentword] may evaluate to 0, but then we can add one and assign (not the same as += because of non initialized keys)
+				if decorator {
+					words[currentword] += decoratorBoost
+				}
 			}
 			currentword = ""
+			decorator = c == '@' && lineStart
+		}
+		
+		if c == '\n' {
+			lineStart = true
+		}else if c != ' ' && c != '\t' {
+			lineStart = false
 		}
 	}
 	
-	if currentword != "" {
+	if currentword != "" && !isNumberWord(currentword) {
 		words[currentword] = words[currentword] + 1 // words[currentword] may evaluate to 0, but then we can add one and assign (not the same as += because of non initialized keys)
+		if decorator {
+			words[currentword] += decoratorBoost
+		}
 	}
 	
 	return words
 }
 
+// numeric literals (255, 0xFF, 1_000, 1e10, 3j) come through the word split too. nothing that starts with a
+// digit is an identifier so they never get completed
+func isNumberWord(word string) bool {
+	for _, c := range word {
+		return unicode.IsDigit(c)
+	}
+	return false
+}
+
 func padStart(s string, pad string, length int) string {
 	for len(s) < length {
 		s = pad+s;
@@ -88,21 +362,151 @@ func padStart(s string, pad string, length int) string {
 	return s
 }
 
+// notifications (didOpen, didChange, ...) are applied right here on the connection's read loop so they land in
+// the order the client sent them, which also keeps them in order per document. requests go to the worker pool
+// and work off a snapshot of the documents, so a slow one never holds up the edits queued behind it and still
+// sees every edit sent before it. initialize sets up state everything after it depends on so it's done in line
+// too, as is pypls/ping since the point of it is to show the read loop isn't stuck. any other request before
+// initialize is refused, as LSP asks
 func (h *handler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if getTraceLevel() == traceVerbose {
+		traceIncoming(ctx, conn, req)
+	}
+	if req.Method == "$/cancelRequest" {
+		h.requests.cancel(req.Params)
+		return
+	}
+	if !req.Notif && !h.initialized && req.Method != "initialize" && req.Method != "pypls/ping" {
+		replyError(ctx, conn, req, ErrNotInitialized)
+		return
+	}
+	if req.Notif || req.Method == "initialize" || req.Method == "pypls/ping" {
+		h.handle(ctx, conn, req)
+		return
+	}
+	h.requests.run(ctx, conn, req, h.handle)
+}
+
+func (h *handler) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	switch req.Method {
 	case "initialize":
+		if h.initialized { // a second one would clobber the root and settings everything since was set up with
+			replyError(ctx, conn, req, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: "server already initialized"})
+			return
+		}
+		var params struct {
+			InitializationOptions json.RawMessage `json:"initializationOptions"`
+			RootURI               string          `json:"rootUri"`
+			RootPath              string          `json:"rootPath"`
+			Trace                 string          `json:"trace"`
+			Capabilities          struct {
+				General struct {
+					PositionEncodings []string `json:"positionEncodings"`
+				} `json:"general"`
+				TextDocument struct {
+					Completion struct {
+						CompletionItem struct {
+							SnippetSupport        bool `json:"snippetSupport"`
+							InsertTextModeSupport struct {
+								ValueSet []int `json:"valueSet"`
+							} `json:"insertTextModeSupport"`
+						} `json:"completionItem"`
+						CompletionList struct {
+							ItemDefaults []string `json:"itemDefaults"`
+						} `json:"completionList"`
+					} `json:"completion"`
+					DocumentSymbol struct {
+						HierarchicalDocumentSymbolSupport bool `json:"hierarchicalDocumentSymbolSupport"`
+					} `json:"documentSymbol"`
+				} `json:"textDocument"`
+			} `json:"capabilities"`
+		}
+		if err := decodeParams(req, &params, "initialize"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		h.initialized = true
+		setTraceLevel(ctx, conn, params.Trace)
+		setWorkspaceRoot(params.RootURI, params.RootPath)
+		clientSnippetSupport = params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+		clientHierarchicalSymbols = params.Capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport
+		clientEditRangeDefault = slices.Contains(params.Capabilities.TextDocument.Completion.CompletionList.ItemDefaults, "editRange")
+		clientAdjustIndentation = slices.Contains(params.Capabilities.TextDocument.Completion.CompletionItem.InsertTextModeSupport.ValueSet, insertTextModeAdjustIndentation)
+		if slices.Contains(params.Capabilities.General.PositionEncodings, encodingUTF8) {
+			positionEncoding = encodingUTF8
+		}
+		if err := applyOptions(params.InitializationOptions); err != nil {
+			log(ctx, conn, "invalid initializationOptions: " + err.Error())
+		}
+		loadExtraWordlist(ctx, conn)
+		loadExtraBuiltins(ctx, conn)
+		loadStubs(ctx, conn)
+		loadRequirements()
+		go indexSitePackages(ctx, conn)
+		
 		var result struct {
 			Capabilities struct {
+				PositionEncoding string `json:"positionEncoding"`
+				TextDocumentSync struct {
+					OpenClose         bool `json:"openClose"`
+					Change            int  `json:"change"`
+					WillSaveWaitUntil bool `json:"willSaveWaitUntil"`
+				} `json:"textDocumentSync"`
 				CompletionProvider struct {
 					TriggerCharacters []string `json:"triggerCharacters"`
+					ResolveProvider   bool     `json:"resolveProvider"`
 				} `json:"completionProvider"`
+				DefinitionProvider bool `json:"definitionProvider"`
+				TypeDefinitionProvider bool `json:"typeDefinitionProvider"`
+				ImplementationProvider bool `json:"implementationProvider"`
+				HoverProvider bool `json:"hoverProvider"`
+				DocumentSymbolProvider bool `json:"documentSymbolProvider"`
+				RenameProvider bool `json:"renameProvider"`
+				LinkedEditingRangeProvider bool `json:"linkedEditingRangeProvider"`
+				CodeActionProvider bool `json:"codeActionProvider"`
+				WorkspaceSymbolProvider bool `json:"workspaceSymbolProvider"`
+				ExecuteCommandProvider struct {
+					Commands []string `json:"commands"`
+				} `json:"executeCommandProvider"`
+				SemanticTokensProvider struct {
+					Legend SemanticTokensLegend `json:"legend"`
+					Full   bool                 `json:"full"`
+				} `json:"semanticTokensProvider"`
 			} `json:"capabilities"`
 		}
 		
+		result.Capabilities.PositionEncoding = positionEncoding
+		result.Capabilities.TextDocumentSync.OpenClose = true
+		result.Capabilities.TextDocumentSync.Change = 1 // full, didChange only ever reads the whole text
+		result.Capabilities.TextDocumentSync.WillSaveWaitUntil = true
 		result.Capabilities.CompletionProvider.TriggerCharacters = []string{".",":"}
+		result.Capabilities.CompletionProvider.ResolveProvider = getOptions().RecentFromResolve
+		result.Capabilities.DefinitionProvider = true
+		result.Capabilities.TypeDefinitionProvider = true
+		result.Capabilities.ImplementationProvider = true
+		result.Capabilities.HoverProvider = true
+		result.Capabilities.DocumentSymbolProvider = true
+		result.Capabilities.RenameProvider = true
+		result.Capabilities.LinkedEditingRangeProvider = true
+		result.Capabilities.CodeActionProvider = true
+		result.Capabilities.WorkspaceSymbolProvider = true
+		result.Capabilities.ExecuteCommandProvider.Commands = []string{"pypls.reindex", "pypls.getStatus", "pypls.lintWorkspace"}
+		result.Capabilities.SemanticTokensProvider.Legend = SemanticTokensLegend{semanticTokenTypes, []string{}}
+		result.Capabilities.SemanticTokensProvider.Full = true
 		conn.Reply(ctx, req.ID, result)
 	
+	case "$/setTrace":
+		var params struct {
+			Value string `json:"value"`
+		}
+		if err := decodeParams(req, &params, "setTrace"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		setTraceLevel(ctx, conn, params.Value)
+	
 	case "initialized":
+		clientReady.Store(true)
 		log(ctx, conn, "Language server initialized successfully")
 
 	case "shutdown":
@@ -111,187 +515,648 @@ func (h *handler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2
 	case "exit":
 		os.Exit(0)
 	
+	case "pypls/words": // the raw word index of an open document for external tools, keys come out sorted
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := decodeParams(req, &params, "words"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.URI == "" {
+			replyError(ctx, conn, req, missingField("words", "uri"))
+			return
+		}
+		file, ok := getFile(params.URI)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(params.URI))
+			return
+		}
+		conn.Reply(ctx, req.ID, file.words.toMap())
+	
+	case "pypls/stats": // index sizes for tracking down memory use
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		open := snapshotFiles()
+		entries := 0
+		for _, f := range open {
+			entries += f.words.len() + f.attributes.len() + f.receiverAttributes.entries()
+		}
+		hits, misses := completions.counters()
+		conn.Reply(ctx, req.ID, struct {
+			Documents             int    `json:"documents"`
+			InternedSymbols       int    `json:"internedSymbols"`
+			IndexEntries          int    `json:"indexEntries"`
+			HeapAlloc             uint64 `json:"heapAlloc"`
+			CompletionCacheHits   int64  `json:"completionCacheHits"`
+			CompletionCacheMisses int64  `json:"completionCacheMisses"`
+		}{len(open), interned.Load().size(), entries, mem.HeapAlloc, hits, misses})
+	
+	case "pypls/todos": // TODO, FIXME, HACK and XXX comments, for task lists
+		conn.Reply(ctx, req.ID, allTodos(snapshotFiles()))
+	
+	case "pypls/ping": // liveness check for process supervisors, needs no documents and works before initialize
+		conn.Reply(ctx, req.ID, struct {
+			Pong          bool  `json:"pong"`
+			UptimeSeconds int64 `json:"uptimeSeconds"`
+		}{true, int64(time.Since(startTime).Seconds())})
+	
 	case "workspace/didChangeConfiguration":
+		var params struct {
+			Settings json.RawMessage `json:"settings"`
+		}
+		if err := decodeParams(req, &params, "configuration"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if err := applyOptions(params.Settings); err != nil {
+			log(ctx, conn, "invalid configuration: " + err.Error())
+			return
+		}
+		loadExtraWordlist(ctx, conn)
+		loadExtraBuiltins(ctx, conn)
+		loadStubs(ctx, conn)
+		loadRequirements()
+		go indexSitePackages(ctx, conn)
+		for _, file := range snapshotFiles() { // the checks may have been switched on or off
+			publishDiagnostics(ctx, conn, file)
+		}
 		log(ctx, conn, "Ack")
 	
+	case "textDocument/documentSymbol":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		if clientHierarchicalSymbols {
+			conn.Reply(ctx, req.ID, documentSymbolTree(file))
+		}else{
+			conn.Reply(ctx, req.ID, documentSymbols(uri, file))
+		}
+	
+	case "textDocument/rename":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		var params struct {
+			Position *Position `json:"position"`
+			NewName  string    `json:"newName"`
+		}
+		if err := decodeParams(req, &params, "rename"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Position == nil {
+			replyError(ctx, conn, req, missingField("rename", "position"))
+			return
+		}
+		if file, ok := getFile(uri); ok && file.tooLarge { // left out of the snapshot, it would look closed
+			replyError(ctx, conn, req, renameFailed(uri + " is larger than maxDocumentBytes"))
+			return
+		}
+		edit, err := rename(uri, *params.Position, params.NewName, snapshotFiles())
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		conn.Reply(ctx, req.ID, edit)
+	
+	case "textDocument/linkedEditingRange":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		var params struct {
+			Position *Position `json:"position"`
+		}
+		if err := decodeParams(req, &params, "linkedEditingRange"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Position == nil {
+			replyError(ctx, conn, req, missingField("linkedEditingRange", "position"))
+			return
+		}
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if err := checkPosition(file, *params.Position); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		conn.Reply(ctx, req.ID, linkedEditingRanges(file, *params.Position))
+	
+	case "textDocument/codeAction":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		var params struct {
+			Context struct {
+				Diagnostics []Diagnostic `json:"diagnostics"`
+			} `json:"context"`
+		}
+		if err := decodeParams(req, &params, "codeAction"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, []CodeAction{})
+			return
+		}
+		conn.Reply(ctx, req.ID, undefinedNameFixes(file, params.Context.Diagnostics))
+	
+	case "workspace/symbol":
+		var query SymbolQuery
+		if err := decodeParams(req, &query, "workspace symbol"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		
+		symbols, err := workspaceSymbols(query, snapshotFiles())
+		if err != nil {
+			conn.Notify(ctx, "window/showMessage", LogMessageParams{
+				Type:    2,
+				Message: "invalid symbol search pattern " + query.Query + ": " + err.Error(),
+			})
+			symbols = []SymbolInformation{}
+		}
+		conn.Reply(ctx, req.ID, symbols)
+	
+	case "workspace/executeCommand":
+		var params struct {
+			Command string `json:"command"`
+		}
+		if err := decodeParams(req, &params, "executeCommand"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		switch params.Command {
+		case "pypls.reindex": // after installing packages or regenerating stubs
+			loadStubs(ctx, conn)
+			loadRequirements()
+			go indexSitePackages(ctx, conn)
+			conn.Reply(ctx, req.ID, nil)
+		case "pypls.getStatus": // a pypls/serverStatus right away, the reply carries the same
+			conn.Reply(ctx, req.ID, sendStatus(ctx, conn))
+		case "pypls.lintWorkspace": // diagnostics for the files that aren't open, published as they come in
+			if !getOptions().Diagnostics.Workspace {
+				replyError(ctx, conn, req, &jsonrpc2.Error{Code: codeRequestFailed, Message: "workspace diagnostics are off, set diagnostics.workspace to use pypls.lintWorkspace"})
+				return
+			}
+			summary, err := lintWorkspace(ctx, conn)
+			if err != nil {
+				replyError(ctx, conn, req, err)
+				return
+			}
+			conn.Reply(ctx, req.ID, summary)
+		default:
+			replyError(ctx, conn, req, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "unknown command " + params.Command})
+		}
+	
+	case "pypls/completionChosen": // sent by the client when the user accepts a completion
+		var params struct {
+			Label string `json:"label"`
+		}
+		if err := decodeParams(req, &params, "completionChosen"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Label == "" {
+			replyError(ctx, conn, req, missingField("completionChosen", "label"))
+			return
+		}
+		recordCompletionChosen(params.Label)
+		if !req.Notif {
+			conn.Reply(ctx, req.ID, nil)
+		}
+	
+	case "completionItem/resolve":
+		var item CompletionItem
+		if err := decodeParams(req, &item, "completionItem/resolve"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if getOptions().RecentFromResolve && item.Label != "" {
+			recordCompletionChosen(item.Label)
+		}
+		conn.Reply(ctx, req.ID, item)
+	
 	case "textDocument/didChange":
 		uri, err := getURI(req)
 		
 		if err != nil {
-			log(ctx, conn, err.Error())
+			replyError(ctx, conn, req, err)
 			return
 		}
 		
 		var params struct {
+			TextDocument struct {
+				Version *int `json:"version"`
+			} `json:"textDocument"`
 			ContentChanges []struct{ Text string `json:"text"` } `json:"contentChanges"`
 		}
 		
-		if err := json.Unmarshal(*req.Params, &params); err != nil {
-			conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeParseError,
-				Message: "invalid change params: " + err.Error(),
-			})
+		if err := decodeParams(req, &params, "change"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		
+		if len(params.ContentChanges) == 0 {
+			replyError(ctx, conn, req, missingField("change", "contentChanges"))
 			return
 		}
 		
-		files[uri] = OpenFile{ uri, params.ContentChanges[0].Text, getWords(&params.ContentChanges[0].Text) }
+		languageId, version := "", 0
+		previous, known := getFile(uri)
+		if known {
+			languageId, version = previous.languageId, previous.version
+		}
+		var file OpenFile
+		if params.TextDocument.Version == nil { // nothing to order by, the latest to arrive wins
+			file = newOpenFile(uri, languageId, version, params.ContentChanges[0].Text)
+			setFile(file)
+		}else{
+			if known && *params.TextDocument.Version <= version {
+				warn(ctx, conn, "ignoring change to " + uri + ": version " + strconv.Itoa(*params.TextDocument.Version) + " is not newer than " + strconv.Itoa(version))
+				return
+			}
+			file = newOpenFile(uri, languageId, *params.TextDocument.Version, params.ContentChanges[0].Text)
+			if !setFileIfNewer(file) {
+				return
+			}
+		}
+		h.warnIfTooLarge(ctx, conn, file)
+		scheduleDiagnostics(ctx, conn, uri)
 		
 	case "textDocument/didOpen": // get uri from params
 		uri, err := getURI(req)
 		
 		if err != nil {
-			log(ctx, conn, err.Error())
+			replyError(ctx, conn, req, err)
 			return
 		}
 		
 		var params struct {
-			TextDocument struct{ Text string `json:"text"` } `json:"textDocument"`
+			TextDocument struct{
+				Text       string `json:"text"`
+				LanguageID string `json:"languageId"`
+				Version    int    `json:"version"`
+			} `json:"textDocument"`
 		}
 		
-		if err := json.Unmarshal(*req.Params, &params); err != nil {
-			conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeParseError,
-				Message: "invalid open params: " + err.Error(),
-			})
+		if err := decodeParams(req, &params, "open"); err != nil {
+			replyError(ctx, conn, req, err)
 			return
 		}
 		
-		files[uri] = OpenFile{ uri, params.TextDocument.Text, getWords(&params.TextDocument.Text) }
+		file := newOpenFile(uri, params.TextDocument.LanguageID, params.TextDocument.Version, params.TextDocument.Text)
+		setFile(file)
+		h.warnIfTooLarge(ctx, conn, file)
+		forgetPublishedDiagnostics(uri) // the client may have dropped what it had when the document was closed
+		publishDiagnostics(ctx, conn, file)
+	
+	case "textDocument/didClose":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		deleteFile(uri)
+		delete(h.warnedTooLarge, uri)
+		cancelScheduledDiagnostics(uri)
+		sendDiagnostics(ctx, conn, uri, []Diagnostic{}) // the checks are for open documents, workspace lint aside
+		forgetPublishedDiagnostics(uri)
+	
+	case "textDocument/willSaveWaitUntil":
+		uri, err := getURI(req)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		file, ok := getFile(uri)
+		if !ok || file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		conn.Reply(ctx, req.ID, saveEdits(file, getOptions()))
 	
 	case "textDocument/didSave":
 		
 	case "textDocument/hover":
-		
-	case "textDocument/completion":
 		uri, err := getURI(req)
 		
 		if err != nil {
-			log(ctx, conn, err.Error())
+			replyError(ctx, conn, req, err)
 			return
 		}
 		
-		file, ok := files[uri]
-		
+		file, ok := getFile(uri)
 		if !ok {
-			log(ctx, conn, "FILE NOT OPEN")
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if replyIfBehind(ctx, conn, req, file) {
 			return
 		}
-		
-		filecontent := file.content
 		
 		var params struct {
-			Position     struct {
-				Line      int `json:"line"`
-				Character int `json:"character"`
-			} `json:"position"`
-		}
-		if err := json.Unmarshal(*req.Params, &params); err != nil {
-			conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeParseError,
-				Message: "invalid completion params: " + err.Error(),
-			})
+			Position *Position `json:"position"`
+		}
+		if err := decodeParams(req, &params, "hover"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Position == nil {
+			replyError(ctx, conn, req, missingField("hover", "position"))
+			return
+		}
+		if err := checkPosition(file, *params.Position); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
 			return
 		}
 		
-		curline := 0
-		line_pos := 0
-		curword := ""
-		tocomplete := ""
+		word, start, end, inCode := wordAtPosition(file.content, params.Position.Line, params.Position.Character)
+		if word == "" || !inCode {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
 		
-		leadup := make([]string, 0)
+		lines := splitLines(file.content)
+		cc := getCompletionContext(file.content, params.Position.Line, lineCharacter(lines[params.Position.Line], end))
 		
-		for _, c := range filecontent {
-			line_pos ++
-			
-			if c == '\n' {
-				if curline == params.Position.Line && (line_pos == params.Position.Character) {
-					tocomplete = curword
-				}
-				
-				curline ++
-				line_pos = 0
-				if curline > params.Position.Line {
-					break
-				}
-			}else if curline == params.Position.Line {
-				if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
-					curword += string(c)
-				}else if (c == '.') {
-					leadup = append(leadup, curword)
-					curword = "";
-				}else{
-					leadup = make([]string, 0);
-					curword = ""
-				}
-				
-				if (line_pos == params.Position.Character) {
-					tocomplete = curword;
-				}
+		hover := importHover(lines[params.Position.Line], start, end)
+		if hover == nil {
+			hover = annotationHover(lines[params.Position.Line], start, end)
+		}
+		if hover == nil {
+			hover = enumMemberHover(file.content, cc.leadup, word)
+		}
+		if hover == nil {
+			hover = knownMemberHover(file, cc, word)
+		}
+		if hover == nil {
+			hover = stubMemberHover(file.content, cc.leadup, word)
+		}
+		if hover == nil {
+			hover = definitionHover(uri, word, snapshotFiles())
+		}
+		if hover == nil && len(cc.leadup) == 0 {
+			hover = extraBuiltinHover(word)
+		}
+		if hover == nil {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		r := rangeOnLine(lines, params.Position.Line, start, end)
+		hover.Range = &r
+		conn.Reply(ctx, req.ID, hover)
+		
+	case "textDocument/definition", "textDocument/typeDefinition", "textDocument/implementation":
+		uri, err := getURI(req)
+		
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if replyIfBehind(ctx, conn, req, file) {
+			return
+		}
+		
+		var params struct {
+			Position *Position `json:"position"`
+		}
+		if err := decodeParams(req, &params, "definition"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Position == nil {
+			replyError(ctx, conn, req, missingField("definition", "position"))
+			return
+		}
+		if err := checkPosition(file, *params.Position); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		
+		word, _, _, inCode := wordAtPosition(file.content, params.Position.Line, params.Position.Character)
+		if !inCode {
+			conn.Reply(ctx, req.ID, nil)
+			return
+		}
+		switch req.Method {
+		case "textDocument/typeDefinition":
+			// where the type can't be worked out (or is a builtin) the definition is still somewhere to go, an
+			// empty answer just looks broken
+			open := snapshotFiles()
+			locations := typeDefinitionLocations(uri, word, open)
+			if len(locations) == 0 {
+				locations = definitionLocations(uri, word, open)
 			}
+			conn.Reply(ctx, req.ID, locations)
+		case "textDocument/implementation":
+			conn.Reply(ctx, req.ID, implementationLocations(uri, params.Position.Line, word, snapshotFiles()))
+		default:
+			conn.Reply(ctx, req.ID, definitionLocations(uri, word, snapshotFiles()))
 		}
 		
-		if (line_pos+1 == params.Position.Character && curline == params.Position.Line) {
-			tocomplete = curword
+	case "textDocument/semanticTokens/full":
+		uri, err := getURI(req)
+		
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
 		}
 		
-		leadups := ""
-		for _, li := range leadup {
-			leadups += li+"."
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if file.tooLarge {
+			conn.Reply(ctx, req.ID, nil)
+			return
 		}
 		
-		log(ctx, conn, leadups+tocomplete)
+		var result struct {
+			Data []int `json:"data"`
+		}
+		result.Data = encodeSemanticTokens(file.content, languageFor(file.languageId))
+		conn.Reply(ctx, req.ID, result)
 		
+	case "textDocument/completion":
+		uri, err := getURI(req)
 		
-		items := make([]CompletionItem, 0)
+		if err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
 		
-		padLen := 6;
-		for key, value := range file.words {
-			if key == tocomplete { continue }
-			items = append(items, CompletionItem{ key, 3, key, 1, padStart(strconv.FormatInt(1000000-value, 10), "0", padLen), } )
+		var params struct {
+			Position *Position `json:"position"`
+			Context  struct {
+				TriggerKind      int    `json:"triggerKind"`
+				TriggerCharacter string `json:"triggerCharacter"`
+			} `json:"context"`
 		}
-		for key, value := range defaultCompletions {
-			if key == tocomplete { continue }
-			items = append(items, CompletionItem{ key, 3, key, 1, padStart(strconv.FormatInt(1000000-value, 10), "0", padLen), } )
+		if err := decodeParams(req, &params, "completion"); err != nil {
+			replyError(ctx, conn, req, err)
+			return
+		}
+		if params.Position == nil {
+			replyError(ctx, conn, req, missingField("completion", "position"))
+			return
 		}
 		
-		var resp struct {
-			IsIncomplete bool        `json:"isIncomplete"`
-			Items        interface{} `json:"items"`
+		// the revision is read before the file so a change landing in between can only make the key stale, never
+		// store an old document's list under the new revision
+		key := completionKey{uri, completionRevision.Load(), params.Position.Line, params.Position.Character, params.Context.TriggerKind, params.Context.TriggerCharacter}
+		file, ok := getFile(uri)
+		if !ok {
+			replyError(ctx, conn, req, documentNotOpen(uri))
+			return
+		}
+		if replyIfBehind(ctx, conn, req, file) {
+			return
+		}
+		// no checkPosition, a position past the end is clamped to it by the completion contexts. it shows up while
+		// edits are in flight and still deserves a menu
+		resp, ok := completions.get(ctx, key, func() CompletionList {
+			var cc completionContext
+			if file.tooLarge {
+				cc = lineCompletionContext(file.content, params.Position.Line, params.Position.Character)
+			}else{
+				cc = getCompletionContext(file.content, params.Position.Line, params.Position.Character)
+			}
+			
+			leadups := ""
+			for _, li := range cc.leadup {
+				leadups += li+"."
+			}
+			
+			log(ctx, conn, leadups+cc.tocomplete)
+			
+			items, incomplete := buildCompletions(file, cc, getOptions())
+			indentMultiline(items, cc.lineText)
+			
+			// the typed prefix is what gets replaced, clients that can take it once get it once
+			editRange := Range{Position{cc.line, lineCharacter(cc.lineText, cc.offset-len(cc.tocomplete))}, Position{cc.line, lineCharacter(cc.lineText, cc.offset)}}
+			
+			list := CompletionList{IsIncomplete: incomplete, Items: items}
+			if clientEditRangeDefault {
+				list.ItemDefaults = &CompletionItemDefaults{editRange}
+			}else{
+				for i := range items {
+					items[i].TextEdit = &TextEdit{editRange, items[i].InsertText}
+				}
+			}
+			return list
+		})
+		if !ok { // gave up waiting on an identical request
+			replyError(ctx, conn, req, ErrCancelled)
+			return
+		}
+		if replyCancelled(ctx, conn, req) {
+			return
 		}
-		resp.IsIncomplete = false
-		resp.Items = items
 	
 		conn.Reply(ctx, req.ID, resp)
 
 	default:
-		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+		if req.Notif { // notifications we have no use for ($/progress, didChangeWatchedFiles, ...) are meant to be ignored
+			return
+		}
+		replyError(ctx, conn, req, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeMethodNotFound,
 			Message: "method not found < " + req.Method,
 		})
 	}
 }
 
-func main() {
+// the tables every handler reads, filled before the first message is read
+func initServer() {
 	defaultCompletions = make(map[string]int64)
 	
 	defs := []string{"for", "range", "import", "int", "if", "elif", "else", "in", "open", "sort", "sorted", "def", "print", "continue", "break", "return", "not", "del", "eval", "True", "False", "str", "while", "and", "as", "is", "or", "try", "except", "finally", "raise", "assert", "with", "lambda", "yield", "async", "await", "class", "from", "global", "nonlocal", "pass", "None", "abs", "all", "any", "ascii", "bin", "bool", "breakpoint", "bytearray", "bytes", "callable", "chr", "classmethod", "compile", "complex", "delattr", "dict", "dir", "divmod", "enumerate", "exec", "filter", "float", "format", "frozenset", "getattr", "globals", "hasattr", "hash", "help", "hex", "id", "input", "isinstance", "issubclass", "iter", "len", "list", "locals", "map", "max", "memoryview", "min", "next", "object", "oct", "pow", "property", "repr", "reversed", "round", "set", "setattr", "slice", "staticmethod", "sum", "super", "tuple", "type", "vars", "zip", "__import__"}
 	
 	for _, d := range defs {
-		defaultCompletions[d] = 11
+		defaultCompletions[d] = builtinFrequency
 	}
 	
+	initModuleCompletions()
+	
 	files = make(map[string]OpenFile)
+}
+
+func main() {
+	initServer()
+	
+	// a closed stdout shows up as write errors rather than killing the process
+	signal.Ignore(syscall.SIGPIPE)
+	
+	serve(os.Stdin, os.Stdout)
+}
+
+// one client over in and out, returns once it disconnects or out stops taking writes
+func serve(in io.Reader, out io.Writer) {
+	// cancelled when the client goes away, anything running in the background watches it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	
-	ctx := context.Background()
+	var conn *jsonrpc2.Conn
+	writer := &transportWriter{w: out, onFail: func(err error) {
+		cancel()
+		go conn.Close() // not from inside the write, the connection is mid send
+	}}
 	
 	stream := jsonrpc2.NewBufferedStream(
 		struct {
 			io.Reader
 			io.Writer
 			io.Closer
-		}{os.Stdin, os.Stdout, io.NopCloser(nil)},
+		}{in, writer, io.NopCloser(nil)},
 		jsonrpc2.VSCodeObjectCodec{},
 	)
-	conn := jsonrpc2.NewConn(ctx, stream, &handler{})
+	conn = jsonrpc2.NewConn(ctx, stream, &handler{})
+	go statusReporter(ctx, conn)
 	<-conn.DisconnectNotify()
 }
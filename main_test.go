@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// the server end to end: a handler on one side of a pipe and a client on the other. the globals are reset for
+// each test, so tests using it can't run in parallel
+
+func TestMain(m *testing.M) {
+	initServer()
+	os.Exit(m.Run())
+}
+
+type testClient struct {
+	t             *testing.T
+	conn          *jsonrpc2.Conn
+	server        *jsonrpc2.Conn
+	notifications chan *jsonrpc2.Request
+	serverWrites  *sync.Mutex // while held, whatever the server sends waits as it would on a client that isn't reading
+}
+
+// the server's end of the pipe, each write waits for held
+type heldConn struct {
+	net.Conn
+	held *sync.Mutex
+}
+
+func (h heldConn) Write(p []byte) (int, error) {
+	h.held.Lock()
+	h.held.Unlock()
+	return h.Conn.Write(p)
+}
+
+// notifications from the server are queued for waitFor, requests from it are answered with null
+type testClientHandler struct {
+	notifications chan *jsonrpc2.Request
+}
+
+func (h testClientHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if !req.Notif {
+		conn.Reply(ctx, req.ID, nil)
+		return
+	}
+	select {
+	case h.notifications <- req:
+	default: // nobody is looking at them
+	}
+}
+
+func resetServerState() {
+	filesMu.Lock()
+	files = make(map[string]OpenFile)
+	filesMu.Unlock()
+	optionsMu.Lock()
+	options = defaultOptions()
+	optionsMu.Unlock()
+	publishedDiagnosticsMu.Lock()
+	publishedDiagnostics = make(map[string]string)
+	publishedDiagnosticsMu.Unlock()
+	lintCacheMu.Lock()
+	lintCache = make(map[string]lintResult)
+	lintCacheMu.Unlock()
+	recentlyUsedMu.Lock()
+	recentlyUsed = map[string]time.Time{}
+	recentlyUsedMu.Unlock()
+	interned.Store(newInternTable())
+	compactAt.Store(minCompactSize)
+	completions = &completionCache{calls: make(map[completionKey]*completionCall)}
+	invalidateCompletions()
+	clientSnippetSupport = false
+	clientHierarchicalSymbols = false
+	clientEditRangeDefault = false
+	clientAdjustIndentation = false
+	positionEncoding = encodingUTF16
+	traceLevel.Store(traceOff)
+	setWorkspaceRoot("", "")
+}
+
+// a connected client that has not sent initialize yet
+func newTestConnection(t *testing.T) *testClient {
+	t.Helper()
+	resetServerState()
+	serverSide, clientSide := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &testClient{t: t, notifications: make(chan *jsonrpc2.Request, 1000), serverWrites: &sync.Mutex{}}
+	c.server = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(heldConn{serverSide, c.serverWrites}, jsonrpc2.VSCodeObjectCodec{}), &handler{})
+	c.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(clientSide, jsonrpc2.VSCodeObjectCodec{}), testClientHandler{c.notifications})
+	t.Cleanup(func() {
+		cancel()
+		c.conn.Close()
+		c.server.Close()
+	})
+	return c
+}
+
+// initialize and initialized with the given initializationOptions and client capabilities, either may be nil
+func newTestServer(t *testing.T, initOptions any, capabilities any) *testClient {
+	t.Helper()
+	c := newTestConnection(t)
+	if capabilities == nil {
+		capabilities = map[string]any{}
+	}
+	params := map[string]any{"capabilities": capabilities, "initializationOptions": initOptions}
+	if err := c.callErr("initialize", params, nil); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *testClient) callErr(method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return c.conn.Call(ctx, method, params, result)
+}
+
+func (c *testClient) call(method string, params any, result any) {
+	c.t.Helper()
+	if err := c.callErr(method, params, result); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func (c *testClient) notify(method string, params any) {
+	c.t.Helper()
+	if err := c.conn.Notify(context.Background(), method, params); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func (c *testClient) open(uri string, text string) {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "python", "version": 1, "text": text}})
+}
+
+func (c *testClient) change(uri string, version int, text string) {
+	c.t.Helper()
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []any{map[string]any{"text": text}},
+	})
+}
+
+func (c *testClient) completion(uri string, line, character int) CompletionList {
+	c.t.Helper()
+	var list CompletionList
+	c.call("textDocument/completion", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{line, character}}, &list)
+	return list
+}
+
+// the next notification of method within timeout, nil if none came
+func (c *testClient) waitFor(method string, timeout time.Duration) *jsonrpc2.Request {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case n := <-c.notifications:
+			if n.Method == method {
+				return n
+			}
+		case <-deadline:
+			return nil
+		}
+	}
+}
+
+func decodeNotification(t *testing.T, n *jsonrpc2.Request, v any) {
+	t.Helper()
+	if n == nil || n.Params == nil {
+		t.Fatal("no notification")
+	}
+	if err := json.Unmarshal(*n.Params, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a document as didOpen would store it, for tests that call the analysis directly
+func pythonFile(uri string, content string) OpenFile {
+	return newOpenFile(uri, "python", 1, content)
+}
+
+func labels(items []CompletionItem) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = item.Label
+	}
+	return result
+}
+
+func findItem(items []CompletionItem, label string) (CompletionItem, bool) {
+	for _, item := range items {
+		if item.Label == label {
+			return item, true
+		}
+	}
+	return CompletionItem{}, false
+}
+
+// the items in the order the client shows them
+func sortedItems(list CompletionList) []CompletionItem {
+	items := append([]CompletionItem{}, list.Items...)
+	for i := 1; i < len(items); i++ {
+		for j := i; j > 0 && items[j].SortText < items[j-1].SortText; j-- {
+			items[j], items[j-1] = items[j-1], items[j]
+		}
+	}
+	return items
+}
+
+// a before b in the menu, both present
+func assertRanksAbove(t *testing.T, list CompletionList, a, b string) {
+	t.Helper()
+	ia, ib := -1, -1
+	for i, item := range sortedItems(list) {
+		if item.Label == a && ia < 0 {
+			ia = i
+		}
+		if item.Label == b && ib < 0 {
+			ib = i
+		}
+	}
+	if ia < 0 || ib < 0 {
+		t.Fatalf("%q at %d, %q at %d in %v", a, ia, b, ib, labels(sortedItems(list)))
+	}
+	if ia > ib {
+		t.Errorf("%q (at %d) ranks below %q (at %d)", a, ia, b, ib)
+	}
+}
+
+type pong struct {
+	Pong          bool  `json:"pong"`
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+}
+
+// before initialize, with nothing open, and without touching the documents
+func TestPingOnAFreshConnection(t *testing.T) {
+	c := newTestConnection(t)
+	var reply pong
+	c.call("pypls/ping", nil, &reply)
+	if !reply.Pong || reply.UptimeSeconds < 0 {
+		t.Errorf("ping = %+v, want pong", reply)
+	}
+	if len(snapshotFiles()) != 0 {
+		t.Error("ping opened a document")
+	}
+
+	c = newTestServer(t, nil, nil)
+	c.open("file:///a.py", "x = 1\n")
+	reply = pong{}
+	c.call("pypls/ping", map[string]any{}, &reply)
+	if !reply.Pong {
+		t.Errorf("ping after initialize = %+v", reply)
+	}
+	if file, ok := getFile("file:///a.py"); !ok || file.content != "x = 1\n" {
+		t.Error("ping disturbed an open document")
+	}
+}
+
+// the second initialize is refused and leaves the root and settings of the first alone
+func TestSecondInitializeIsRefused(t *testing.T) {
+	root := t.TempDir()
+	c := newTestConnection(t)
+	c.call("initialize", map[string]any{"capabilities": map[string]any{}, "rootPath": root, "initializationOptions": map[string]any{"workers": 3}}, nil)
+	c.notify("initialized", map[string]any{})
+
+	err := c.callErr("initialize", map[string]any{"capabilities": map[string]any{}, "rootPath": t.TempDir(), "initializationOptions": map[string]any{"workers": 7}}, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != jsonrpc2.CodeInvalidRequest {
+		t.Errorf("second initialize: %v, want InvalidRequest", err)
+	}
+	if got := getWorkspaceRoot(); got != root {
+		t.Errorf("workspace root = %q, want %q from the first initialize", got, root)
+	}
+	if got := getOptions().Workers; got != 3 {
+		t.Errorf("workers = %d, want 3 from the first initialize", got)
+	}
+	c.call("pypls/ping", nil, nil) // still serving
+}
+
+func TestWordsRequest(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///counted.py"
+	c.open(uri, "total = start\nfor item in items:\n    total += item\nprint(total)\n")
+	var raw json.RawMessage
+	c.call("pypls/words", map[string]any{"uri": uri}, &raw)
+	if string(raw) != `{"item":2,"items":1,"start":1,"total":3}` { // keywords and builtins aren't indexed
+		t.Errorf("words = %s", raw)
+	}
+	var again json.RawMessage
+	c.call("pypls/words", map[string]any{"uri": uri}, &again)
+	if string(again) != string(raw) {
+		t.Errorf("asked again: %s, was %s", again, raw)
+	}
+
+	err := c.callErr("pypls/words", map[string]any{"uri": "file:///closed.py"}, nil)
+	if rpcErr, ok := err.(*jsonrpc2.Error); !ok || rpcErr.Code != codeDocumentNotOpen {
+		t.Errorf("words of a closed document: %v, want DocumentNotOpen", err)
+	}
+}
+
+// numeric literals never reach the index, names with digits in them do. the document ends on a number so the
+// word after the loop is covered too
+func TestNumbersAreNotWords(t *testing.T) {
+	text := "mask = 255 | 0xFF\ncount = 1_000 + x1\ndigest = sha256(data)\nutf8 = 1e10 + 3j + 0b1010\nlimit = 42"
+	words := getWords(&text)
+	for _, number := range []string{"255", "0xFF", "1_000", "1e10", "3j", "0b1010", "42"} {
+		if _, ok := words[number]; ok {
+			t.Errorf("%s indexed", number)
+		}
+	}
+	for _, name := range []string{"x1", "sha256", "utf8", "mask", "limit"} {
+		if words[name] != 1 {
+			t.Errorf("%s counted %d, want 1", name, words[name])
+		}
+	}
+}
+
+// a change with a version no newer than the document's is dropped with a warning
+func TestStaleChangeIsDropped(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///versions.py"
+	c.open(uri, "a = 1\n")
+	c.change(uri, 3, "c = 3\n")
+	c.call("pypls/ping", nil, nil)
+	for len(c.notifications) > 0 {
+		<-c.notifications
+	}
+
+	for _, version := range []int{2, 3} {
+		c.change(uri, version, "stale = 1\n")
+		var msg LogMessageParams
+		decodeNotification(t, c.waitFor("window/logMessage", 2*time.Second), &msg)
+		if msg.Type != 2 || !strings.Contains(msg.Message, "version "+strconv.Itoa(version)+" is not newer than 3") {
+			t.Errorf("warning for version %d = %+v", version, msg)
+		}
+		if file, _ := getFile(uri); file.version != 3 || file.content != "c = 3\n" {
+			t.Errorf("version %d applied over 3: %d %q", version, file.version, file.content)
+		}
+	}
+
+	c.change(uri, 4, "d = 4\n")
+	c.call("pypls/ping", nil, nil)
+	if file, _ := getFile(uri); file.version != 4 || file.content != "d = 4\n" {
+		t.Errorf("version 4 not applied: %d %q", file.version, file.content)
+	}
+}
+
+// the next log message within a short wait, the reply to a ping first so everything sent before is in
+func (c *testClient) nextLog() *LogMessageParams {
+	c.call("pypls/ping", nil, nil)
+	n := c.waitFor("window/logMessage", 100*time.Millisecond)
+	if n == nil {
+		return nil
+	}
+	var msg LogMessageParams
+	decodeNotification(c.t, n, &msg)
+	return &msg
+}
+
+// completion logs what it completes, which only goes out with tracing on. each completion is at a new position
+// so the cache doesn't skip the log
+func TestSetTraceTogglesLogs(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///traced.py"
+	c.open(uri, "value = 1\nvalue\n")
+	c.call("pypls/ping", nil, nil)
+	for len(c.notifications) > 0 {
+		<-c.notifications
+	}
+	setTrace := func(value string) {
+		c.notify("$/setTrace", map[string]any{"value": value})
+	}
+
+	c.completion(uri, 1, 1)
+	if msg := c.nextLog(); msg != nil {
+		t.Errorf("logged with trace off: %+v", msg)
+	}
+
+	setTrace(traceMessages)
+	c.completion(uri, 1, 2)
+	if msg := c.nextLog(); msg == nil || msg.Type != 4 || msg.Message != "va" {
+		t.Errorf("with trace messages: %+v, want the log of va", msg)
+	}
+	if n := c.waitFor("$/logTrace", 100*time.Millisecond); n != nil {
+		t.Errorf("traced a message below verbose: %s", *n.Params)
+	}
+
+	setTrace(traceVerbose)
+	c.completion(uri, 1, 3)
+	var trace LogTraceParams
+	decodeNotification(t, c.waitFor("$/logTrace", time.Second), &trace)
+	if !strings.HasPrefix(trace.Message, "received request textDocument/completion") || !strings.Contains(trace.Verbose, `"character":3`) {
+		t.Errorf("verbose trace = %+v", trace)
+	}
+	if msg := c.nextLog(); msg == nil || msg.Message != "val" {
+		t.Errorf("with trace verbose: %+v, want the log of val", msg)
+	}
+
+	setTrace(traceOff)
+	c.completion(uri, 1, 4)
+	if msg := c.nextLog(); msg != nil {
+		t.Errorf("logged after trace went back off: %+v", msg)
+	}
+
+	setTrace("loud") // left as it was, with a warning
+	if msg := c.nextLog(); msg == nil || msg.Type != 2 || getTraceLevel() != traceOff {
+		t.Errorf("unknown trace value: %+v, level %s", msg, getTraceLevel())
+	}
+}
+
+func TestTraceFromInitialize(t *testing.T) {
+	c := newTestConnection(t)
+	c.call("initialize", map[string]any{"capabilities": map[string]any{}, "trace": "messages"}, nil)
+	if getTraceLevel() != traceMessages {
+		t.Errorf("trace level = %s after initialize with messages", getTraceLevel())
+	}
+}
+
+// a document over maxDocumentBytes is kept but not indexed, completes builtins only, is warned about once, and
+// doesn't slow down anything else. a small limit keeps the test from spending its time encoding megabytes of JSON
+func TestOversizedDocument(t *testing.T) {
+	c := newTestServer(t, map[string]any{"maxDocumentBytes": 1 << 16}, nil)
+	uri := "file:///generated.py"
+	big := strings.Repeat("generated_value_0123 = [1, 2, 3]\n", (getOptions().MaxDocumentBytes/33)+1) + "pr\n"
+	lastLine := strings.Count(big, "\n") - 1
+	c.open(uri, big)
+
+	var msg LogMessageParams
+	decodeNotification(t, c.waitFor("window/showMessage", 5*time.Second), &msg)
+	if msg.Type != 2 || !strings.Contains(msg.Message, "maxDocumentBytes") {
+		t.Errorf("warning = %+v", msg)
+	}
+	if file, _ := getFile(uri); !file.tooLarge || file.words.len() != 0 {
+		t.Errorf("tooLarge %v with %d words indexed", file.tooLarge, file.words.len())
+	}
+
+	start := time.Now()
+	items := c.completion(uri, lastLine, 2).Items
+	if _, ok := findItem(items, "print"); !ok {
+		t.Errorf("print missing: %v", labels(items))
+	}
+	if _, ok := findItem(items, "generated_value_0123"); ok {
+		t.Error("a word of the oversized document completed")
+	}
+	c.call("textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{0, 3}}, nil)
+	small := "file:///small.py"
+	c.open(small, "response = 1\nres\n")
+	if _, ok := findItem(c.completion(small, 1, 3).Items, "response"); !ok {
+		t.Error("another document stopped completing")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("requests took %v with the oversized document open", elapsed)
+	}
+
+	// once per time it goes over
+	c.change(uri, 2, big+"x\n")
+	c.call("pypls/ping", nil, nil)
+	if n := c.waitFor("window/showMessage", 100*time.Millisecond); n != nil {
+		t.Errorf("warned again while still over: %s", *n.Params)
+	}
+	c.change(uri, 3, "fits = 1\n")
+	c.change(uri, 4, big)
+	if n := c.waitFor("window/showMessage", 5*time.Second); n == nil {
+		t.Error("not warned after going over a second time")
+	}
+}
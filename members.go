@@ -0,0 +1,221 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dot completion: what's offered after `receiver.` once the receiver is something we know the members of
+
+// the module (or module.Class) a dotted chain refers to, import aliases undone
+func resolveDotted(content string, leadup []string) string {
+	if len(leadup) == 0 {
+		return ""
+	}
+	head := leadup[0]
+	if origin := importedName(content, head); origin != "" {
+		head = origin
+	}
+	return strings.Join(append([]string{head}, leadup[1:]...), ".")
+}
+
+func stubItem(m stubMember) CompletionItem {
+	return CompletionItem{ Label: m.name, Kind: m.kind, InsertText: m.name, InsertTextFmt: 1, Detail: m.detail }
+}
+
+// members for the chain before the cursor, nil when the receiver can't be worked out. an alias (`x = self`)
+// gets what its base would, one level deep
+func memberCompletions(lines []string, file OpenFile, cc completionContext) []CompletionItem {
+	if items := chainMembers(lines, file, cc); len(items) > 0 || len(cc.leadup) == 0 {
+		return items
+	}
+	base := aliasOf(file.content, cc.leadup[0])
+	if base == "" {
+		return nil
+	}
+	cc.leadup = append([]string{base}, cc.leadup[1:]...)
+	return chainMembers(lines, file, cc)
+}
+
+func chainMembers(lines []string, file OpenFile, cc completionContext) []CompletionItem {
+	content := file.content
+	if len(cc.leadup) == 1 && cc.leadup[0] == "self" {
+		if cls, ok := enclosingClass(lines, cc.line); ok {
+			return classMemberCompletions(lines, content, cls, make(map[string]bool))
+		}
+	}
+
+	// a value whose type we can name: literals, constructor calls, variables assigned one of those
+	if t := receiverTypeAt(file, cc, cc.tocomplete); t != "" {
+		if attrs, ok := knownTypeAttrs[t]; ok {
+			return append([]CompletionItem{}, attrs...)
+		}
+		if cls, ok := findClass(lines, t); ok {
+			return classMemberCompletions(lines, content, cls, make(map[string]bool))
+		}
+	}
+
+	// the small os. and sys. table is opt-in and only for modules the file actually imports, a local `os` is
+	// someone else's. third party tables also need the project to have the package
+	receiver := resolveDotted(content, cc.leadup)
+	items := make([]CompletionItem, 0)
+	if !optInModules[receiver] || getOptions().StdlibMembers && importedName(content, cc.leadup[0]) != "" {
+		items = append(items, knownModuleAttrs[receiver]...)
+	}
+	if importedName(content, cc.leadup[0]) != "" && packageAvailable(receiver) {
+		items = append(items, knownPackageAttrs[receiver]...)
+	}
+	for _, m := range stubMembers(receiver) {
+		items = append(items, stubItem(m))
+	}
+	if dottedDecoratorRe.MatchString(cc.lineText[:cc.offset-len(cc.tocomplete)]) && strings.TrimSpace(cc.lineText[cc.offset:]) == "" {
+		for i := range items {
+			if snippet, ok := decoratorSnippets[receiver+"."+items[i].Label]; ok {
+				items[i] = withSnippet(items[i], snippet)
+			}
+		}
+	}
+	return items
+}
+
+// modules whose table is only served with stdlibMembers on, the other stdlib tables always are
+var optInModules = map[string]bool{"os": true, "sys": true}
+
+var dottedDecoratorRe = regexp.MustCompile(`^\s*@[\w.]*$`)
+
+// decorators with a usual shape, typed as a decorator they complete with the def they always go on or the
+// arguments they are always called with
+var decoratorSnippets = map[string]string{
+	"contextlib.contextmanager":      "contextmanager\ndef ${1:name}():\n    $2\n    yield $3",
+	"contextlib.asynccontextmanager": "asynccontextmanager\nasync def ${1:name}():\n    $2\n    yield $3",
+	"functools.lru_cache":            "lru_cache(maxsize=$1)",
+}
+
+// receiverType for the receiver of word, an annotated parameter of the function around the cursor first
+func receiverTypeAt(file OpenFile, cc completionContext, word string) string {
+	expr := receiverExpression(cc.lineText, cc.offset-len(word))
+	if identifierRe.MatchString(expr) {
+		if t := parameterType(file.content, cc.line, cc.offset, expr); t != "" {
+			return t
+		}
+	}
+	return receiverType(file.content, file.variableTypeMap, expr)
+}
+
+// the class's own members first, then whatever its bases provide, from this file or from stubs
+func classMemberCompletions(lines []string, content string, cls classInfo, visited map[string]bool) []CompletionItem {
+	visited[cls.name] = true
+	items := make([]CompletionItem, 0)
+	for _, m := range classMembers(lines, cls) {
+		items = append(items, CompletionItem{ Label: m.name, Kind: m.kind, InsertText: m.name, InsertTextFmt: 1, Detail: m.detail })
+	}
+
+	for _, base := range cls.bases {
+		if local, ok := findClass(lines, base); ok && !visited[local.name] {
+			items = append(items, classMemberCompletions(lines, content, local, visited)...)
+			continue
+		}
+		for _, m := range stubMembers(resolveDotted(content, strings.Split(base, "."))) {
+			items = append(items, stubItem(m))
+		}
+	}
+	return items
+}
+
+// attribute names in code position (the token after each `.`), overall and per receiver. receivers are the
+// full dotted chain in front, `a.b.c` counts b for "a" and c for "a.b". a call or subscript breaks the chain
+func getAttributes(content string, lang languageConfig) (attributes map[string]int64, byReceiver map[string]map[string]int64, comments []token) {
+	attributes = make(map[string]int64)
+	byReceiver = make(map[string]map[string]int64)
+	tokens := tokenizeLanguage(content, lang)
+	chain := ""
+	for i, tok := range tokens {
+		afterDot := i > 0 && isOp(tokens[i-1], ".") && tok.line == tokens[i-1].line && tok.start == tokens[i-1].end
+		switch {
+		case tok.kind == tokenIdentifier && afterDot:
+			attributes[tok.text]++
+			if chain != "" {
+				if byReceiver[chain] == nil {
+					byReceiver[chain] = make(map[string]int64)
+				}
+				byReceiver[chain][tok.text]++
+				chain += "." + tok.text
+			}
+		case tok.kind == tokenIdentifier:
+			chain = tok.text
+		case isOp(tok, "."):
+		case tok.kind == tokenComment:
+			comments = append(comments, tok) // for todosFrom, this is the only pass over a new document's tokens
+			chain = ""
+		default:
+			chain = ""
+		}
+	}
+	return attributes, byReceiver, comments
+}
+
+// every attribute seen in the open documents, for receivers we know nothing about
+func observedAttributes(files map[string]OpenFile) map[string]int64 {
+	attributes := make(map[string]int64)
+	for _, f := range files {
+		f.attributes.each(func(name string, count int64) { attributes[name] += count })
+	}
+	return attributes
+}
+
+// attributes seen on this exact receiver anywhere in the open documents, `conn.` offers what `conn.` was
+// followed by elsewhere
+func receiverAttributes(files map[string]OpenFile, receiver string) map[string]int64 {
+	attributes := make(map[string]int64)
+	for _, f := range files {
+		f.receiverAttributes.of(receiver).each(func(name string, count int64) { attributes[name] += count })
+	}
+	return attributes
+}
+
+// the signature of a builtin type's member or a known stdlib module's member
+func knownMemberHover(file OpenFile, cc completionContext, word string) *Hover {
+	content := file.content
+	if len(cc.leadup) == 0 {
+		return nil
+	}
+	if t := receiverTypeAt(file, cc, word); t != "" {
+		for _, item := range knownTypeAttrs[t] {
+			if item.Label == word {
+				value := codeBlock(t + "." + item.Detail)
+				if item.Documentation != "" {
+					value += "\n\n" + item.Documentation
+				}
+				return markdownHover(value)
+			}
+		}
+	}
+	receiver := resolveDotted(content, cc.leadup)
+	known := knownModuleAttrs[receiver]
+	if packageAvailable(receiver) {
+		known = append(append([]CompletionItem{}, known...), knownPackageAttrs[receiver]...)
+	}
+	for _, item := range known {
+		if item.Label == word {
+			value := codeBlock(receiver + "." + moduleMemberSignature(item))
+			if item.Documentation != "" {
+				value += "\n\n" + item.Documentation
+			}
+			return markdownHover(value)
+		}
+	}
+	return nil
+}
+
+// hover for a member that came out of a stub, labelled as such since it isn't the code that actually runs
+func stubMemberHover(content string, leadup []string, word string) *Hover {
+	if len(leadup) == 0 {
+		return nil
+	}
+	for _, m := range stubMembers(resolveDotted(content, leadup)) {
+		if m.name == word {
+			return markdownHover(codeBlock(m.detail) + "\n\n*from stub* `" + m.origin + "`")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// the os. and sys. table is opt-in, with stdlibMembers off they offer only what stubs and the document have.
+// every other module's table is served either way
+func TestStdlibMembers(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		line   int
+		char   int
+		member string
+		optIn  bool   // only offered with stdlibMembers on
+		kind   int    // checked when set
+		detail string // checked when set
+		insert string // checked when set, snippets are on
+	}{
+		{name: "os", text: "import os\nos.\n", line: 1, char: 3, member: "getcwd", optIn: true},
+		{name: "sys", text: "import sys\nsys.\n", line: 1, char: 4, member: "argv", optIn: true},
+		{name: "os.path", text: "import os\nos.path.\n", line: 1, char: 8, member: "join"},
+		{name: "json", text: "import json\njson.\n", line: 1, char: 5, member: "dumps"},
+		{name: "re", text: "import re\nre.\n", line: 1, char: 3, member: "IGNORECASE", kind: 21, detail: "re.RegexFlag = 2"},
+		{name: "collections", text: "import collections\ncollections.\n", line: 1, char: 12, member: "namedtuple"},
+		{name: "datetime", text: "import datetime\ndatetime.\n", line: 1, char: 9, member: "timedelta"},
+		{name: "typing", text: "import typing\ntyping.\n", line: 1, char: 7, member: "Optional"},
+		{name: "logging", text: "import logging\nlogging.\n", line: 1, char: 8, member: "getLogger"},
+		{name: "contextlib", text: "import contextlib\n@contextlib.\n", line: 1, char: 12, member: "contextmanager", insert: "contextmanager\ndef ${1:name}():\n    $2\n    yield $3"},
+		{name: "functools", text: "import functools\n@functools.\n", line: 1, char: 11, member: "lru_cache", insert: "lru_cache(maxsize=$1)"},
+		{name: "itertools", text: "import itertools\nitertools.chain.\n", line: 1, char: 16, member: "from_iterable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "file:///" + tt.name + "_members.py"
+
+			c := newTestServer(t, nil, snippetCapabilities)
+			c.open(uri, tt.text)
+			item, ok := findItem(c.completion(uri, tt.line, tt.char).Items, tt.member)
+			if tt.optIn && ok {
+				t.Errorf("%s.%s offered with stdlibMembers off", tt.name, tt.member)
+			}
+			if !tt.optIn && !ok {
+				t.Errorf("%s.%s not offered with stdlibMembers off", tt.name, tt.member)
+			}
+
+			c = newTestServer(t, map[string]any{"stdlibMembers": true}, snippetCapabilities)
+			c.open(uri, tt.text)
+			item, ok = findItem(c.completion(uri, tt.line, tt.char).Items, tt.member)
+			if !ok {
+				t.Fatalf("%s.%s not offered with stdlibMembers on", tt.name, tt.member)
+			}
+			if tt.kind != 0 && item.Kind != tt.kind {
+				t.Errorf("%s.%s kind = %d, want %d", tt.name, tt.member, item.Kind, tt.kind)
+			}
+			if tt.detail != "" && item.Detail != tt.detail {
+				t.Errorf("%s.%s detail = %q, want %q", tt.name, tt.member, item.Detail, tt.detail)
+			}
+			if tt.insert != "" && item.InsertText != tt.insert {
+				t.Errorf("%s.%s insert = %q, want %q", tt.name, tt.member, item.InsertText, tt.insert)
+			}
+		})
+	}
+}
+
+// a local variable named like a module isn't the module
+func TestStdlibMembersNeedTheImport(t *testing.T) {
+	c := newTestServer(t, map[string]any{"stdlibMembers": true}, nil)
+	uri := "file:///shadow.py"
+	c.open(uri, "os = object()\nos.\n")
+	if _, ok := findItem(c.completion(uri, 1, 3).Items, "getcwd"); ok {
+		t.Error("os.getcwd offered for a local os")
+	}
+}
+
+// the same `config.` scoped to the class and flat from the words
+func TestMemberCompletionModes(t *testing.T) {
+	text := "class Config:\n    def __init__(self):\n        self.debug = True\n\nconfig = Config()\nhandler = make_handler()\nconfig.\n"
+	uri := "file:///modes.py"
+
+	c := newTestServer(t, nil, nil)
+	c.open(uri, text)
+	items := c.completion(uri, 6, 7).Items
+	if _, ok := findItem(items, "debug"); !ok {
+		t.Errorf("scoped: debug missing from %v", labels(items))
+	}
+	if _, ok := findItem(items, "handler"); ok {
+		t.Errorf("scoped: handler offered after config.: %v", labels(items))
+	}
+
+	c = newTestServer(t, map[string]any{"memberCompletion": "flat"}, nil)
+	c.open(uri, text)
+	items = c.completion(uri, 6, 7).Items
+	for _, word := range []string{"handler", "make_handler", "debug"} {
+		if _, ok := findItem(items, word); !ok {
+			t.Errorf("flat: %s missing from %v", word, labels(items))
+		}
+	}
+
+	// the typed part filters the same way either mode
+	c.change(uri, 2, strings.TrimSuffix(text, "\n")+"han\n")
+	items = sortedItems(c.completion(uri, 6, 10))
+	if len(items) == 0 || items[0].Label != "handler" {
+		t.Errorf("flat: config.han = %v", labels(items))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const moduleDocTimeout = 3 * time.Second
+
+// __doc__ per module name, failures included so a module that won't import isn't retried on every hover
+var moduleDocCache = map[string]string{}
+var moduleDocCacheMu sync.Mutex
+
+var importModuleRe = regexp.MustCompile(`^\s*(?:import|from)\s+([\w.]+)`)
+var importListRe = regexp.MustCompile(`^\s*import\s+(.*)$`)
+var importItemRe = regexp.MustCompile(`[\w.]+(?:\s+as\s+\w+)?`)
+
+// the dotted module name the hovered word belongs to on an import line, up to and including the word:
+// hovering os in `import os.path` gives "os", hovering path gives "os.path"
+func importedModuleAt(lineText string, start, end int) string {
+	spans := make([][]int, 0)
+	if m := importListRe.FindStringSubmatchIndex(lineText); m != nil {
+		for _, item := range importItemRe.FindAllStringIndex(lineText[m[2]:m[3]], -1) {
+			spans = append(spans, []int{m[2] + item[0], m[2] + item[1]})
+		}
+	}else if m := importModuleRe.FindStringSubmatchIndex(lineText); m != nil {
+		spans = append(spans, []int{m[2], m[3]})
+	}
+
+	for _, span := range spans {
+		if start < span[0] || end > span[1] { continue }
+		module := strings.Fields(lineText[span[0]:span[1]])[0]
+		if end-span[0] > len(module) {
+			return "" // the alias after `as`
+		}
+		return module[:end-span[0]]
+	}
+	return ""
+}
+
+// asks the configured interpreter for the module's docstring
+func moduleDoc(module string) (doc string, ok bool) {
+	moduleDocCacheMu.Lock()
+	doc, cached := moduleDocCache[module]
+	moduleDocCacheMu.Unlock()
+	if cached {
+		return doc, doc != ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), moduleDocTimeout)
+	defer cancel()
+	// the name goes in as an argument rather than into the source so nothing on the line can run as code
+	script := "import importlib, sys; print(importlib.import_module(sys.argv[1]).__doc__ or '')"
+	out, err := exec.CommandContext(ctx, getOptions().PythonPath, "-c", script, module).Output()
+	if err == nil {
+		doc = strings.TrimSpace(string(out))
+	}
+
+	moduleDocCacheMu.Lock()
+	moduleDocCache[module] = doc
+	moduleDocCacheMu.Unlock()
+	return doc, doc != ""
+}
+
+func importHover(lineText string, start, end int) *Hover {
+	module := importedModuleAt(lineText, start, end)
+	if module == "" {
+		return nil
+	}
+	doc, ok := moduleDoc(module)
+	if !ok {
+		return markdownHover("Module " + module + " (documentation unavailable)")
+	}
+	return markdownHover(codeBlock("module " + module) + "\n\n" + doc)
+}
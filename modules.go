@@ -0,0 +1,447 @@
+package main
+
+// curated members of commonly used stdlib modules for `module.` completion, so the common case works without
+// any stubs around. keyed by the module's full dotted name
+var knownModuleAttrs map[string][]CompletionItem
+
+// the same for popular third party packages, only offered when the project has the package (see packageAvailable)
+var knownPackageAttrs map[string][]CompletionItem
+
+func moduleFunc(name string, signature string, doc string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 3, InsertText: name, InsertTextFmt: 1, Detail: name + signature, Documentation: doc }
+}
+
+func moduleClass(name string, signature string, doc string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 7, InsertText: name, InsertTextFmt: 1, Detail: "class " + name + signature, Documentation: doc }
+}
+
+// data attributes carry just their type as the detail, moduleMemberSignature puts the name back for hover
+func moduleConst(name string, typ string, doc string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 21, InsertText: name, InsertTextFmt: 1, Detail: typ, Documentation: doc }
+}
+
+func moduleVar(name string, typ string, doc string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 6, InsertText: name, InsertTextFmt: 1, Detail: typ, Documentation: doc }
+}
+
+func moduleMemberSignature(item CompletionItem) string {
+	if item.Kind == 6 || item.Kind == 21 {
+		return item.Label + ": " + item.Detail
+	}
+	return item.Detail
+}
+
+// a snippet insert for clients that take them, dot completion falls back to the bare name for the others
+func withSnippet(item CompletionItem, snippet string) CompletionItem {
+	item.InsertText, item.InsertTextFmt = snippet, 2
+	return item
+}
+
+func submodule(parent string, name string, doc string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 9, InsertText: name, InsertTextFmt: 1, Detail: "module " + parent + "." + name, Documentation: doc }
+}
+
+func initModuleCompletions() {
+	knownModuleAttrs = map[string][]CompletionItem{
+		"os.path": {
+			moduleFunc("join", "(path, *paths) -> str", "Join one or more path segments with the platform separator."),
+			moduleFunc("exists", "(path) -> bool", "True if path refers to an existing path. False for broken symlinks."),
+			moduleFunc("lexists", "(path) -> bool", "True if path exists, broken symlinks included."),
+			moduleFunc("dirname", "(path) -> str", "The directory part of path, everything before the last separator."),
+			moduleFunc("basename", "(path) -> str", "The final component of path."),
+			moduleFunc("abspath", "(path) -> str", "A normalized absolute version of path."),
+			moduleFunc("realpath", "(path) -> str", "The canonical path, with symlinks resolved."),
+			moduleFunc("relpath", "(path, start=os.curdir) -> str", "path relative to start."),
+			moduleFunc("normpath", "(path) -> str", "Collapse redundant separators and up-level references."),
+			moduleFunc("normcase", "(path) -> str", "Normalize the case of path. Does nothing on POSIX."),
+			moduleFunc("expanduser", "(path) -> str", "Replace a leading ~ or ~user with that user's home directory."),
+			moduleFunc("expandvars", "(path) -> str", "Expand $name and ${name} environment variables."),
+			moduleFunc("isfile", "(path) -> bool", "True if path is an existing regular file."),
+			moduleFunc("isdir", "(path) -> bool", "True if path is an existing directory."),
+			moduleFunc("islink", "(path) -> bool", "True if path is a symbolic link."),
+			moduleFunc("isabs", "(path) -> bool", "True if path is absolute."),
+			moduleFunc("ismount", "(path) -> bool", "True if path is a mount point."),
+			moduleFunc("split", "(path) -> tuple[str, str]", "Split path into (head, tail), where tail is the last component."),
+			moduleFunc("splitext", "(path) -> tuple[str, str]", "Split path into (root, ext), where ext starts with a dot or is empty."),
+			moduleFunc("splitdrive", "(path) -> tuple[str, str]", "Split path into (drive, tail)."),
+			moduleFunc("commonpath", "(paths) -> str", "The longest common sub-path of the given paths."),
+			moduleFunc("getsize", "(path) -> int", "The size of path in bytes."),
+			moduleFunc("getmtime", "(path) -> float", "Last modification time of path, in seconds since the epoch."),
+			moduleFunc("getatime", "(path) -> float", "Last access time of path, in seconds since the epoch."),
+			moduleFunc("getctime", "(path) -> float", "Metadata change time (Unix) or creation time (Windows) of path."),
+			moduleFunc("samefile", "(path1, path2) -> bool", "True if both paths refer to the same file or directory."),
+			moduleConst("sep", "str", "The separator used between path components."),
+		},
+		"os": {
+			submodule("os", "path", "Common pathname manipulations."),
+			moduleVar("environ", "os._Environ[str]", "A mapping of the process environment variables."),
+			moduleFunc("getenv", "(key, default=None) -> str | None", "The value of environment variable key, or default."),
+			moduleFunc("getcwd", "() -> str", "The current working directory."),
+			moduleFunc("chdir", "(path) -> None", "Change the current working directory."),
+			moduleFunc("listdir", "(path='.') -> list[str]", "Names of the entries in a directory, in arbitrary order."),
+			moduleFunc("scandir", "(path='.') -> Iterator[os.DirEntry]", "An iterator of DirEntry objects for the entries in a directory."),
+			moduleFunc("walk", "(top, topdown=True, onerror=None, followlinks=False) -> Iterator[tuple[str, list[str], list[str]]]", "Walk a directory tree, yielding (dirpath, dirnames, filenames)."),
+			moduleFunc("makedirs", "(name, mode=0o777, exist_ok=False) -> None", "Create a directory and any missing parents."),
+			moduleFunc("mkdir", "(path, mode=0o777) -> None", "Create a single directory."),
+			moduleFunc("remove", "(path) -> None", "Delete a file."),
+			moduleFunc("rmdir", "(path) -> None", "Delete an empty directory."),
+			moduleFunc("rename", "(src, dst) -> None", "Rename a file or directory."),
+			moduleFunc("replace", "(src, dst) -> None", "Rename, overwriting dst if it exists."),
+			moduleFunc("system", "(command) -> int", "Run command in a subshell and return its exit status."),
+			moduleFunc("getpid", "() -> int", "The current process id."),
+			moduleFunc("cpu_count", "() -> int | None", "The number of logical CPUs, or None if it can't be determined."),
+			moduleConst("sep", "str", "The separator used between path components."),
+			moduleConst("linesep", "str", "The line separator of the platform."),
+			moduleConst("name", "str", "The name of the OS-dependent module imported, such as 'posix' or 'nt'."),
+		},
+		"sys": {
+			moduleVar("argv", "list[str]", "The command line arguments. argv[0] is the script name."),
+			moduleVar("path", "list[str]", "The module search path: the directories searched by import, in order. Initialized from the script's directory, PYTHONPATH and the installation defaults, and can be modified at runtime."),
+			moduleVar("modules", "dict[str, ModuleType]", "The modules that have already been loaded."),
+			moduleVar("stdin", "TextIO", "Standard input."),
+			moduleVar("stdout", "TextIO", "Standard output."),
+			moduleVar("stderr", "TextIO", "Standard error."),
+			moduleFunc("exit", "(status=None) -> NoReturn", "Exit by raising SystemExit with the given status."),
+			moduleVar("version", "str", "The version of the interpreter, with build information."),
+			moduleVar("version_info", "sys.version_info", "The version as a named tuple (major, minor, micro, releaselevel, serial)."),
+			moduleVar("platform", "str", "A platform identifier such as 'linux', 'win32' or 'darwin'."),
+			moduleVar("executable", "str", "The absolute path of the interpreter binary."),
+			moduleVar("prefix", "str", "The site-specific directory prefix, the virtualenv when one is active."),
+			moduleVar("exec_prefix", "str", "The site-specific directory prefix for platform-dependent files."),
+			moduleVar("maxsize", "int", "The largest value a Py_ssize_t can take, the maximum size of lists, strings and the like."),
+			moduleVar("maxunicode", "int", "The largest Unicode code point, 0x10FFFF."),
+			moduleFunc("getdefaultencoding", "() -> str", "The name of the default string encoding, 'utf-8'."),
+			moduleFunc("getfilesystemencoding", "() -> str", "The encoding used to convert between str and bytes file names."),
+			moduleFunc("getrecursionlimit", "() -> int", "The current maximum depth of the interpreter stack."),
+			moduleFunc("setrecursionlimit", "(limit) -> None", "Set the maximum depth of the interpreter stack."),
+		},
+		"json": {
+			moduleFunc("dumps", "(obj, *, skipkeys=False, ensure_ascii=True, indent=None, separators=None, default=None, sort_keys=False) -> str", "Serialize obj to a JSON formatted str."),
+			moduleFunc("loads", "(s, *, cls=None, object_hook=None, parse_float=None, parse_int=None, object_pairs_hook=None) -> Any", "Deserialize a str, bytes or bytearray holding a JSON document."),
+			moduleFunc("dump", "(obj, fp, *, skipkeys=False, ensure_ascii=True, indent=None, separators=None, default=None, sort_keys=False) -> None", "Serialize obj as a JSON formatted stream to the file-like fp."),
+			moduleFunc("load", "(fp, *, cls=None, object_hook=None, parse_float=None, parse_int=None, object_pairs_hook=None) -> Any", "Deserialize the JSON document read from the file-like fp."),
+			moduleClass("JSONDecodeError", "(msg, doc, pos)", "Subclass of ValueError raised for invalid JSON, with msg, doc, pos, lineno and colno."),
+			moduleClass("JSONEncoder", "(*, skipkeys=False, ensure_ascii=True, check_circular=True, allow_nan=True, sort_keys=False, indent=None, separators=None, default=None)", "Extensible JSON encoder. Override default() to serialize other types."),
+			moduleClass("JSONDecoder", "(*, object_hook=None, parse_float=None, parse_int=None, parse_constant=None, strict=True, object_pairs_hook=None)", "Simple JSON decoder."),
+		},
+		"re": {
+			withSnippet(moduleFunc("compile", "(pattern, flags=0) -> re.Pattern", "Compile a regular expression pattern into a Pattern object."), "compile($1)"),
+			moduleFunc("match", "(pattern, string, flags=0) -> re.Match | None", "Match pattern at the start of string."),
+			moduleFunc("search", "(pattern, string, flags=0) -> re.Match | None", "Find the first match of pattern anywhere in string."),
+			moduleFunc("fullmatch", "(pattern, string, flags=0) -> re.Match | None", "Match pattern against the whole of string."),
+			moduleFunc("sub", "(pattern, repl, string, count=0, flags=0) -> str", "Replace matches of pattern with repl, a string or a function."),
+			moduleFunc("subn", "(pattern, repl, string, count=0, flags=0) -> tuple[str, int]", "Like sub, but also return the number of substitutions made."),
+			moduleFunc("split", "(pattern, string, maxsplit=0, flags=0) -> list[str]", "Split string by the occurrences of pattern."),
+			moduleFunc("findall", "(pattern, string, flags=0) -> list", "All non-overlapping matches, as strings or tuples of groups."),
+			moduleFunc("finditer", "(pattern, string, flags=0) -> Iterator[re.Match]", "An iterator of Match objects over all non-overlapping matches."),
+			moduleFunc("escape", "(pattern) -> str", "Escape the special characters in pattern."),
+			moduleFunc("purge", "() -> None", "Clear the regular expression cache."),
+			moduleConst("IGNORECASE", "re.RegexFlag = 2", "re.I. Case-insensitive matching."),
+			moduleConst("MULTILINE", "re.RegexFlag = 8", "re.M. ^ and $ match at the start and end of each line."),
+			moduleConst("DOTALL", "re.RegexFlag = 16", "re.S. . matches newlines too."),
+			moduleConst("VERBOSE", "re.RegexFlag = 64", "re.X. Whitespace and # comments in the pattern are ignored."),
+			moduleConst("ASCII", "re.RegexFlag = 256", "re.A. \\w, \\b, \\d and \\s match ASCII characters only."),
+			moduleConst("UNICODE", "re.RegexFlag = 32", "re.U. The default for str patterns, kept for compatibility."),
+			moduleConst("LOCALE", "re.RegexFlag = 4", "re.L. \\w, \\b and case-insensitive matching follow the current locale. bytes patterns only."),
+		},
+		"math": {
+			moduleFunc("sqrt", "(x) -> float", "The square root of x."),
+			moduleFunc("floor", "(x) -> int", "The largest integer less than or equal to x."),
+			moduleFunc("ceil", "(x) -> int", "The smallest integer greater than or equal to x."),
+			moduleFunc("log", "(x, base=math.e) -> float", "The logarithm of x to the given base."),
+			moduleFunc("isclose", "(a, b, *, rel_tol=1e-09, abs_tol=0.0) -> bool", "True if a and b are close to each other."),
+			moduleConst("pi", "float", "3.141592..."),
+			moduleConst("e", "float", "2.718281..."),
+			moduleConst("inf", "float", "Positive infinity."),
+		},
+		"time": {
+			moduleFunc("time", "() -> float", "Seconds since the epoch, as a float."),
+			moduleFunc("sleep", "(secs) -> None", "Suspend execution for the given number of seconds."),
+			moduleFunc("perf_counter", "() -> float", "A high resolution clock for measuring short durations."),
+			moduleFunc("monotonic", "() -> float", "A clock that never goes backwards."),
+			moduleFunc("strftime", "(format, t=None) -> str", "Format a struct_time (the current local time by default) as a string."),
+		},
+		"collections": {
+			moduleFunc("namedtuple", "(typename, field_names, *, rename=False, defaults=None, module=None) -> type", "Factory for tuple subclasses with named fields."),
+			moduleClass("deque", "(iterable=(), maxlen=None)", "List-like sequence with fast appends and pops on either end."),
+			moduleClass("Counter", "(iterable=None, /, **kwds)", "dict subclass for counting hashable items."),
+			moduleClass("OrderedDict", "(other=(), /, **kwds)", "dict subclass that remembers insertion order and can reorder entries."),
+			moduleClass("defaultdict", "(default_factory=None, /, *args, **kwargs)", "dict subclass that calls a factory to supply missing values."),
+			moduleClass("ChainMap", "(*maps)", "Groups several mappings into a single updateable view."),
+			moduleClass("UserDict", "(dict=None, /, **kwargs)", "Wrapper around a dict for easier dict subclassing."),
+			moduleClass("UserList", "(initlist=None)", "Wrapper around a list for easier list subclassing."),
+			moduleClass("UserString", "(seq)", "Wrapper around a str for easier str subclassing."),
+		},
+		"contextlib": {
+			moduleFunc("contextmanager", "(func) -> Callable[..., ContextManager]", "Decorator turning a generator function into a context manager. Code before the yield runs on enter, code after it on exit."),
+			moduleFunc("asynccontextmanager", "(func) -> Callable[..., AsyncContextManager]", "contextmanager for async generator functions, used with async with."),
+			moduleClass("suppress", "(*exceptions)", "Context manager that swallows the given exceptions raised in its block."),
+			moduleClass("redirect_stdout", "(new_target)", "Context manager sending sys.stdout to another file object for its block."),
+			moduleClass("redirect_stderr", "(new_target)", "Context manager sending sys.stderr to another file object for its block."),
+			moduleClass("nullcontext", "(enter_result=None)", "Context manager that does nothing, for when a with statement needs one optionally."),
+			moduleClass("closing", "(thing)", "Context manager that calls thing.close() when the block ends."),
+			moduleClass("ExitStack", "()", "Context manager combining others, entered with enter_context and unwound in reverse order."),
+			moduleClass("AsyncExitStack", "()", "ExitStack for async context managers, used with async with."),
+		},
+		"functools": {
+			moduleFunc("reduce", "(function, iterable[, initializer])", "Fold iterable into one value by applying function(accumulated, item) left to right, starting from initializer if given."),
+			moduleClass("partial", "(func, /, *args, **keywords)", "A callable that calls func with args and keywords filled in ahead of the ones it is called with."),
+			moduleClass("partialmethod", "(func, /, *args, **keywords)", "partial for methods, defined in a class body it binds self like a normal method."),
+			moduleFunc("lru_cache", "(maxsize=128, typed=False)", "Decorator memoizing a function's results for its most recent maxsize argument combinations. maxsize=None never evicts."),
+			moduleFunc("cache", "(user_function)", "Decorator memoizing every result, lru_cache(maxsize=None) without the bookkeeping."),
+			moduleClass("cached_property", "(func)", "Decorator for a method computed once on first access, then stored on the instance as a plain attribute."),
+			moduleFunc("wraps", "(wrapped, assigned=WRAPPER_ASSIGNMENTS, updated=WRAPPER_UPDATES)", "Decorator for a wrapper function copying the wrapped function's name, docstring and other metadata onto it."),
+			moduleFunc("total_ordering", "(cls)", "Class decorator filling in the missing rich comparisons from __eq__ and one of __lt__, __le__, __gt__ or __ge__."),
+			moduleFunc("singledispatch", "(func)", "Decorator making func a generic function dispatched on the type of its first argument, implementations added with .register."),
+			moduleClass("singledispatchmethod", "(func)", "singledispatch for methods, dispatched on the type of the first argument after self or cls."),
+			moduleFunc("update_wrapper", "(wrapper, wrapped, assigned=WRAPPER_ASSIGNMENTS, updated=WRAPPER_UPDATES)", "What wraps does, as a plain function: copies wrapped's metadata onto wrapper and returns wrapper."),
+			moduleFunc("cmp_to_key", "(func)", "Turn an old style comparison function into a key function for sorted, min, max and friends."),
+		},
+		"itertools": {
+			moduleFunc("count", "(start=0, step=1) -> Iterator", "start, start+step, start+2*step, ... without end."),
+			moduleFunc("cycle", "(iterable) -> Iterator", "The items of iterable over and over, forever. Keeps a copy of them."),
+			moduleFunc("repeat", "(object[, times]) -> Iterator", "object again and again, times times or forever."),
+			moduleFunc("chain", "(*iterables) -> Iterator", "The items of each iterable in turn, as one iterator."),
+			moduleFunc("compress", "(data, selectors) -> Iterator", "The items of data whose matching item in selectors is true."),
+			moduleFunc("dropwhile", "(predicate, iterable) -> Iterator", "Skip items while predicate holds, then every item after."),
+			moduleFunc("takewhile", "(predicate, iterable) -> Iterator", "Items while predicate holds, stopping at the first that fails."),
+			moduleFunc("filterfalse", "(predicate, iterable) -> Iterator", "The items for which predicate is false, filter turned around."),
+			moduleFunc("islice", "(iterable, [start,] stop[, step]) -> Iterator", "Slice of any iterable, like seq[start:stop:step]. No negative values."),
+			moduleFunc("starmap", "(function, iterable) -> Iterator", "function(*args) for each args tuple in iterable."),
+			moduleFunc("tee", "(iterable, n=2) -> tuple[Iterator, ...]", "n independent iterators over one iterable. Don't use the original afterwards."),
+			moduleFunc("zip_longest", "(*iterables, fillvalue=None) -> Iterator", "zip that runs until the longest iterable ends, the shorter ones padded with fillvalue."),
+			moduleFunc("product", "(*iterables, repeat=1) -> Iterator", "The cartesian product as tuples, nested for loops in one."),
+			moduleFunc("permutations", "(iterable, r=None) -> Iterator", "Every ordering of r items of iterable, all of them when r is None."),
+			moduleFunc("combinations", "(iterable, r) -> Iterator", "Every choice of r items in their original order, no item repeated."),
+			moduleFunc("combinations_with_replacement", "(iterable, r) -> Iterator", "Every choice of r items in their original order, items may repeat."),
+			moduleFunc("accumulate", "(iterable[, function], *, initial=None) -> Iterator", "Running totals, or running results of function(total, item)."),
+			moduleFunc("groupby", "(iterable, key=None) -> Iterator", "(key, group) pairs for runs of consecutive items with the same key. Sort by the key first to group them all."),
+			moduleFunc("pairwise", "(iterable) -> Iterator", "Overlapping pairs: (a, b), (b, c), (c, d), ... New in 3.10."),
+		},
+		"itertools.chain": {
+			moduleFunc("from_iterable", "(iterable) -> Iterator", "chain for an iterable of iterables, read lazily."),
+		},
+		"datetime": {
+			moduleClass("datetime", "(year, month, day, hour=0, minute=0, second=0, microsecond=0, tzinfo=None, *, fold=0)", "A date together with a time of day."),
+			moduleClass("date", "(year, month, day)", "A calendar date."),
+			moduleClass("time", "(hour=0, minute=0, second=0, microsecond=0, tzinfo=None, *, fold=0)", "A time of day, independent of any particular day."),
+			moduleClass("timedelta", "(days=0, seconds=0, microseconds=0, milliseconds=0, minutes=0, hours=0, weeks=0)", "A duration, the difference between two dates or datetimes."),
+			moduleClass("timezone", "(offset, name=None)", "A fixed offset from UTC. timezone.utc is UTC itself."),
+			moduleConst("MINYEAR", "int = 1", "The smallest year a date or datetime can have."),
+			moduleConst("MAXYEAR", "int = 9999", "The largest year a date or datetime can have."),
+		},
+		"typing": {
+			moduleClass("Any", "", "Compatible with every type, static checking is off for it."),
+			moduleClass("Union", "", "Union[X, Y] is either X or Y. X | Y is the same thing since 3.10."),
+			moduleClass("Optional", "", "Optional[X] is Union[X, None]."),
+			moduleClass("List", "", "Deprecated alias of list, list[int] works since 3.9."),
+			moduleClass("Dict", "", "Deprecated alias of dict."),
+			moduleClass("Tuple", "", "Deprecated alias of tuple. Tuple[int, ...] is a tuple of ints of any length."),
+			moduleClass("Set", "", "Deprecated alias of set."),
+			moduleClass("FrozenSet", "", "Deprecated alias of frozenset."),
+			moduleClass("Type", "", "Type[C] is the class C itself or a subclass, not an instance."),
+			moduleClass("Callable", "", "Callable[[Arg1, Arg2], Return] is anything that can be called that way."),
+			moduleClass("Iterator", "", "Iterator[T] yields T. Deprecated alias of collections.abc.Iterator."),
+			moduleClass("Generator", "", "Generator[Yield, Send, Return], what a function with yield returns."),
+			moduleClass("AsyncIterator", "", "AsyncIterator[T] yields T with async for."),
+			moduleClass("AsyncGenerator", "", "AsyncGenerator[Yield, Send], what an async def with yield returns."),
+			moduleClass("Coroutine", "", "Coroutine[Yield, Send, Return], what calling an async def returns."),
+			moduleClass("ContextManager", "", "ContextManager[T] has __enter__ returning T. Deprecated alias of contextlib.AbstractContextManager."),
+			moduleClass("IO", "", "IO[AnyStr], the generic file object type."),
+			moduleClass("TextIO", "", "A text file object, IO[str]."),
+			moduleClass("BinaryIO", "", "A binary file object, IO[bytes]."),
+			moduleClass("Pattern", "", "Deprecated alias of re.Pattern."),
+			moduleClass("Match", "", "Deprecated alias of re.Match."),
+			moduleClass("TypeVar", "(name, *constraints, bound=None, covariant=False, contravariant=False)", "A type variable for generic functions and classes."),
+			moduleClass("Generic", "", "Base class for generic classes, class Box(Generic[T])."),
+			moduleClass("Protocol", "", "Base class for structural types, anything with the right members matches."),
+			moduleClass("TypedDict", "", "Base class for dicts with a fixed set of typed string keys."),
+			moduleClass("NamedTuple", "", "Base class for typed namedtuples, fields are class annotations."),
+			moduleFunc("overload", "(func) -> func", "Decorator for the typed signatures of an overloaded function, the real one follows undecorated."),
+			moduleFunc("cast", "(typ, val) -> typ", "Tell the type checker val is a typ. Does nothing at runtime."),
+			moduleFunc("get_type_hints", "(obj, globalns=None, localns=None, include_extras=False) -> dict[str, Any]", "The evaluated annotations of a function, method, module or class."),
+			moduleConst("TYPE_CHECKING", "bool = False", "True only while a type checker reads the code, for imports that are only needed by annotations."),
+			moduleClass("Final", "", "Final[T] marks a name that must not be reassigned or overridden."),
+			moduleClass("Literal", "", "Literal['a', 'b'] is exactly one of the given values."),
+			moduleClass("ClassVar", "", "ClassVar[T] marks a class attribute that instances must not set."),
+		},
+		"logging": {
+			moduleFunc("getLogger", "(name=None) -> Logger", "The logger with the given name, the root logger without one. Usually getLogger(__name__)."),
+			moduleFunc("basicConfig", "(*, filename=None, filemode='a', format=None, datefmt=None, style='%', level=None, stream=None, handlers=None, force=False, encoding=None) -> None", "One-shot setup of the root logger."),
+			moduleFunc("debug", "(msg, *args, **kwargs) -> None", "Log msg % args at DEBUG on the root logger."),
+			moduleFunc("info", "(msg, *args, **kwargs) -> None", "Log msg % args at INFO on the root logger."),
+			moduleFunc("warning", "(msg, *args, **kwargs) -> None", "Log msg % args at WARNING on the root logger."),
+			moduleFunc("error", "(msg, *args, **kwargs) -> None", "Log msg % args at ERROR on the root logger."),
+			moduleFunc("critical", "(msg, *args, **kwargs) -> None", "Log msg % args at CRITICAL on the root logger."),
+			moduleFunc("exception", "(msg, *args, exc_info=True, **kwargs) -> None", "Log at ERROR with the current exception's traceback. Call it from an except block."),
+			moduleConst("DEBUG", "int = 10", "Detailed information, for diagnosing problems."),
+			moduleConst("INFO", "int = 20", "Confirmation that things are working as expected."),
+			moduleConst("WARNING", "int = 30", "Something unexpected happened, the default level."),
+			moduleConst("ERROR", "int = 40", "A function could not be performed."),
+			moduleConst("CRITICAL", "int = 50", "The program itself may be unable to continue."),
+			moduleClass("Logger", "(name, level=NOTSET)", "A named logger. Get one with getLogger rather than constructing it."),
+			moduleClass("Handler", "(level=NOTSET)", "Base class for handlers, which send records somewhere."),
+			moduleClass("Formatter", "(fmt=None, datefmt=None, style='%', validate=True, *, defaults=None)", "Turns a LogRecord into text."),
+			moduleClass("FileHandler", "(filename, mode='a', encoding=None, delay=False, errors=None)", "Writes records to a file."),
+			moduleClass("StreamHandler", "(stream=None)", "Writes records to a stream, sys.stderr by default."),
+			moduleClass("NullHandler", "(level=NOTSET)", "Does nothing. For libraries that shouldn't configure logging."),
+			moduleClass("LogRecord", "(name, level, pathname, lineno, msg, args, exc_info, func=None, sinfo=None)", "One logged event."),
+		},
+		"argparse": {
+			moduleClass("ArgumentParser", "(prog=None, usage=None, description=None, epilog=None, parents=[], formatter_class=HelpFormatter, prefix_chars='-', fromfile_prefix_chars=None, argument_default=None, conflict_handler='error', add_help=True, allow_abbrev=True, exit_on_error=True)", "Parses command line arguments into a Namespace."),
+			moduleClass("Namespace", "(**kwargs)", "The simple object parse_args returns, one attribute per argument."),
+			moduleClass("FileType", "(mode='r', bufsize=-1, encoding=None, errors=None)", "A type= that opens the argument as a file, - meaning stdin or stdout."),
+			moduleClass("Action", "(option_strings, dest, nargs=None, const=None, default=None, type=None, choices=None, required=False, help=None, metavar=None)", "Base class for custom action= handlers."),
+			moduleClass("HelpFormatter", "(prog, indent_increment=2, max_help_position=24, width=None)", "The default formatter_class."),
+			moduleClass("RawDescriptionHelpFormatter", "(prog, indent_increment=2, max_help_position=24, width=None)", "A formatter_class that keeps the description and epilog as written."),
+			moduleClass("ArgumentDefaultsHelpFormatter", "(prog, indent_increment=2, max_help_position=24, width=None)", "A formatter_class that adds each argument's default to its help."),
+			moduleClass("BooleanOptionalAction", "(option_strings, dest, default=None, required=False, help=None)", "action= for a --flag/--no-flag pair."),
+			moduleClass("ArgumentTypeError", "", "Raise from a type= function to report a bad value."),
+			moduleConst("SUPPRESS", "str = '==SUPPRESS=='", "As help= hides the argument, as default= leaves the attribute off the Namespace."),
+		},
+		// the class itself, `from datetime import datetime` then `datetime.`
+		"datetime.datetime": append(append([]CompletionItem{}, datetimeConstructors...), datetimeAttrs...),
+	}
+
+	knownPackageAttrs = map[string][]CompletionItem{
+		"requests": {
+			moduleFunc("get", "(url, params=None, *, headers=None, timeout=None, **kwargs) -> Response", "Send a GET request."),
+			moduleFunc("post", "(url, data=None, json=None, *, headers=None, timeout=None, **kwargs) -> Response", "Send a POST request."),
+			moduleFunc("put", "(url, data=None, *, json=None, headers=None, timeout=None, **kwargs) -> Response", "Send a PUT request."),
+			moduleFunc("patch", "(url, data=None, *, json=None, headers=None, timeout=None, **kwargs) -> Response", "Send a PATCH request."),
+			moduleFunc("delete", "(url, *, params=None, headers=None, timeout=None, **kwargs) -> Response", "Send a DELETE request."),
+			moduleFunc("head", "(url, *, params=None, headers=None, timeout=None, **kwargs) -> Response", "Send a HEAD request. Redirects aren't followed unless allow_redirects=True."),
+			moduleFunc("options", "(url, *, params=None, headers=None, timeout=None, **kwargs) -> Response", "Send an OPTIONS request."),
+			moduleFunc("request", "(method, url, *, params=None, data=None, json=None, headers=None, timeout=None, **kwargs) -> Response", "Send a request with any method."),
+			moduleClass("Session", "()", "Keeps cookies, headers and pooled connections across requests. Use it as a context manager."),
+			moduleClass("Response", "()", "What a request returns: status_code, headers, text, json() and so on."),
+			submodule("requests", "exceptions", "The exceptions requests raises, all subclasses of RequestException."),
+		},
+		"flask": {
+			moduleClass("Flask", "(import_name, static_url_path=None, static_folder='static', template_folder='templates', instance_path=None, root_path=None)", "The application. Usually Flask(__name__)."),
+			moduleVar("request", "Request", "The request being handled, only inside a request context."),
+			moduleClass("Response", "(response=None, status=None, headers=None, mimetype=None, content_type=None)", "The response class, views can also return a str, dict or tuple."),
+			moduleFunc("make_response", "(*args) -> Response", "Turn a view's return value into a Response to add headers or cookies to."),
+			moduleFunc("render_template", "(template_name_or_list, **context) -> str", "Render a template from the templates folder with the given variables."),
+			moduleFunc("redirect", "(location, code=302, Response=None) -> Response", "A response redirecting to location."),
+			moduleFunc("url_for", "(endpoint, *, _anchor=None, _method=None, _scheme=None, _external=None, **values) -> str", "The URL of an endpoint, values fill its variables and the rest go in the query string."),
+			moduleFunc("abort", "(code, *args, **kwargs) -> NoReturn", "Stop the request with an HTTP error."),
+			moduleFunc("jsonify", "(*args, **kwargs) -> Response", "A JSON response of the arguments."),
+			moduleVar("session", "SessionMixin", "The signed cookie session of the current request, needs app.secret_key."),
+			moduleVar("g", "_AppCtxGlobals", "Storage for the current app context, reset every request."),
+			moduleVar("current_app", "Flask", "The application handling the current request."),
+			moduleClass("Blueprint", "(name, import_name, static_folder=None, template_folder=None, url_prefix=None, subdomain=None, url_defaults=None, root_path=None)", "A group of routes and handlers registered on an app with app.register_blueprint."),
+		},
+		"sqlalchemy": append([]CompletionItem{
+			moduleClass("Column", "(type_=None, *args, primary_key=False, nullable=..., default=None, index=None, unique=None, server_default=None)", "A table column, or a mapped attribute of a declarative class."),
+			moduleFunc("create_engine", "(url, *, echo=False, future=True, pool_size=5, pool_pre_ping=False, **kwargs) -> Engine", "The Engine for a database URL."),
+			moduleFunc("select", "(*entities) -> Select", "A SELECT statement of the given columns or mapped classes."),
+			moduleFunc("insert", "(table) -> Insert", "An INSERT statement."),
+			moduleFunc("update", "(table) -> Update", "An UPDATE statement."),
+			moduleFunc("delete", "(table) -> Delete", "A DELETE statement."),
+			moduleFunc("text", "(text) -> TextClause", "Literal SQL with :name bound parameters."),
+			moduleFunc("and_", "(*clauses) -> ColumnElement[bool]", "Clauses joined with AND."),
+			moduleFunc("or_", "(*clauses) -> ColumnElement[bool]", "Clauses joined with OR."),
+			moduleClass("Table", "(name, metadata, *columns, **kwargs)", "A table in a MetaData."),
+			moduleClass("MetaData", "(schema=None, naming_convention=None)", "A collection of Table definitions."),
+			submodule("sqlalchemy", "orm", "The ORM: sessions, declarative mapping and relationships."),
+		}, sqlalchemyColumnTypes...),
+		"sqlalchemy.orm": {
+			moduleClass("Session", "(bind=None, *, autoflush=True, expire_on_commit=True)", "Tracks mapped objects and talks to the database in a transaction."),
+			moduleFunc("sessionmaker", "(bind=None, *, class_=Session, autoflush=True, expire_on_commit=True) -> sessionmaker", "A factory making Sessions with the same configuration."),
+			moduleFunc("relationship", "(argument=None, *, back_populates=None, secondary=None, lazy='select', uselist=None, cascade=...) -> Relationship", "A link to another mapped class."),
+			moduleFunc("mapped_column", "(__type=None, *args, primary_key=False, nullable=..., default=..., index=None, unique=None) -> MappedColumn", "A column of a declarative class, typed with Mapped[...]."),
+			moduleClass("Mapped", "", "Mapped[T] annotates a mapped attribute of a declarative class."),
+			moduleClass("DeclarativeBase", "()", "Subclass it once to get the base of the declarative classes."),
+			moduleFunc("declarative_base", "(*, metadata=None, cls=object, name='Base') -> type", "The base of the declarative classes, the pre 2.0 way."),
+			moduleFunc("joinedload", "(*keys) -> Load", "Load a relationship in the same query with a JOIN."),
+			moduleFunc("selectinload", "(*keys) -> Load", "Load a relationship with a second SELECT ... IN query."),
+		},
+		"requests.exceptions": {
+			moduleClass("RequestException", "(*args, **kwargs)", "Base class of everything requests raises."),
+			moduleClass("HTTPError", "(*args, **kwargs)", "Raised by Response.raise_for_status for a 4xx or 5xx status."),
+			moduleClass("ConnectionError", "(*args, **kwargs)", "The connection failed: DNS, refused, reset."),
+			moduleClass("Timeout", "(*args, **kwargs)", "The request timed out, ConnectTimeout or ReadTimeout."),
+			moduleClass("TooManyRedirects", "(*args, **kwargs)", "More redirects than Session.max_redirects."),
+			moduleClass("JSONDecodeError", "(*args, **kwargs)", "Response.json found no valid JSON in the body."),
+		},
+	}
+
+	// collections' dict subclasses get everything dict has on top of their own
+	knownTypeAttrs["Counter"] = append([]CompletionItem{
+		typeMethod("most_common", "(n=None) -> list[tuple[T, int]]"),
+		typeMethod("elements", "() -> Iterator[T]"),
+		typeMethod("subtract", "(iterable=None, /, **kwds) -> None"),
+		typeMethod("total", "() -> int"),
+	}, knownTypeAttrs["dict"]...)
+	knownTypeAttrs["defaultdict"] = append([]CompletionItem{
+		typeProperty("default_factory", "Callable[[], V] | None"),
+	}, knownTypeAttrs["dict"]...)
+	knownTypeAttrs["OrderedDict"] = append([]CompletionItem{
+		typeMethod("move_to_end", "(key, last=True) -> None"),
+	}, knownTypeAttrs["dict"]...)
+	knownTypeAttrs["datetime"] = append(append([]CompletionItem{}, datetimeAttrs...), datetimeConstructors...)
+}
+
+// what a datetime instance has, the class shares these
+var datetimeAttrs = []CompletionItem{
+	typeProperty("year", "int"),
+	typeProperty("month", "int"),
+	typeProperty("day", "int"),
+	typeProperty("hour", "int"),
+	typeProperty("minute", "int"),
+	typeProperty("second", "int"),
+	typeProperty("microsecond", "int"),
+	typeProperty("tzinfo", "tzinfo | None"),
+	typeMethod("strftime", "(format) -> str"),
+	typeMethod("isoformat", "(sep='T', timespec='auto') -> str"),
+	typeMethod("timestamp", "() -> float"),
+	typeMethod("replace", "(year=..., month=..., day=..., hour=..., minute=..., second=..., microsecond=..., tzinfo=...) -> datetime"),
+	typeMethod("date", "() -> date"),
+	typeMethod("time", "() -> time"),
+	typeMethod("astimezone", "(tz=None) -> datetime"),
+	typeMethod("weekday", "() -> int"),
+}
+
+// datetime's alternate constructors, classmethods so instances have them too
+var datetimeConstructors = []CompletionItem{
+	moduleFunc("now", "(tz=None) -> datetime", "The current local date and time, or the time in tz."),
+	moduleFunc("today", "() -> datetime", "The current local date and time."),
+	moduleFunc("utcnow", "() -> datetime", "The current UTC date and time, as a naive datetime. Deprecated in favor of now(timezone.utc)."),
+	moduleFunc("fromtimestamp", "(timestamp, tz=None) -> datetime", "The local date and time of a POSIX timestamp."),
+	moduleFunc("fromisoformat", "(date_string) -> datetime", "Parse a date and time in ISO 8601 format."),
+	moduleFunc("strptime", "(date_string, format) -> datetime", "Parse a date and time according to format."),
+	moduleFunc("combine", "(date, time, tzinfo=time.tzinfo) -> datetime", "A datetime from a date and a time."),
+}
+
+// the column types sqlalchemy exports, offered in the argument list of Column and mapped_column too
+var sqlalchemyColumnTypes = []CompletionItem{
+	moduleClass("Integer", "()", "An int column."),
+	moduleClass("BigInteger", "()", "A 64 bit int column."),
+	moduleClass("String", "(length=None, collation=None)", "A VARCHAR column, some databases need the length."),
+	moduleClass("Text", "(length=None, collation=None)", "A column for long text."),
+	moduleClass("Boolean", "(create_constraint=False, name=None)", "A bool column."),
+	moduleClass("DateTime", "(timezone=False)", "A datetime column."),
+	moduleClass("Date", "()", "A date column."),
+	moduleClass("Float", "(precision=None, asdecimal=False)", "A floating point column."),
+	moduleClass("Numeric", "(precision=None, scale=None, asdecimal=True)", "A fixed precision column, Decimal in python."),
+	moduleClass("JSON", "(none_as_null=False)", "A JSON column, dicts and lists in python."),
+	moduleClass("LargeBinary", "(length=None)", "A bytes column."),
+	moduleClass("Enum", "(*enums, name=None, native_enum=True)", "A column limited to the given values or a python Enum."),
+	moduleClass("ForeignKey", "(column, ondelete=None, onupdate=None)", "Makes a column reference another table's, ForeignKey(\"users.id\")."),
+}
+
+// the feature names `from __future__ import` accepts, most are mandatory by now and only still accepted
+var futureImports = []CompletionItem{
+	moduleConst("annotations", "_Feature", "Annotations are kept as strings and not evaluated (PEP 563), so they can name classes defined later."),
+	moduleConst("division", "_Feature", "`/` is true division. Mandatory since 3.0."),
+	moduleConst("print_function", "_Feature", "print is a function. Mandatory since 3.0."),
+	moduleConst("unicode_literals", "_Feature", "String literals are str, not bytes. Mandatory since 3.0."),
+	moduleConst("absolute_import", "_Feature", "Imports are absolute unless written relative. Mandatory since 3.0."),
+	moduleConst("generators", "_Feature", "Generator functions with yield. Mandatory since 2.3."),
+	moduleConst("nested_scopes", "_Feature", "Statically nested scopes. Mandatory since 2.2."),
+	moduleConst("with_statement", "_Feature", "The with statement. Mandatory since 2.6."),
+	moduleConst("generator_stop", "_Feature", "StopIteration raised inside a generator becomes RuntimeError (PEP 479). Mandatory since 3.7."),
+	moduleConst("barry_as_FLUFL", "_Feature", "An easter egg, makes `<>` the inequality operator instead of `!=` (PEP 401)."),
+	moduleConst("braces", "_Feature", "An easter egg, importing it raises SyntaxError: not a chance."),
+}
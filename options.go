@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// settings come from initializationOptions and from workspace/didChangeConfiguration (either bare or under a "pypls" key)
+type Options struct {
+	FallbackOnEmpty        bool     `json:"fallbackOnEmpty"`        // when nothing matches the typed prefix offer the most frequent words instead of an empty menu
+	ExtraWordlistPath      string   `json:"extraWordlistPath"`      // newline separated file of extra terms to complete, a team glossary for example
+	ExtraWordlistPriority  int64    `json:"extraWordlistPriority"`  // ranks like a word used this many times in the file
+	ExtraBuiltins          []string `json:"extraBuiltins"`          // globals an embedding injects, completed like builtins
+	ExtraBuiltinsFile      string   `json:"extraBuiltinsFile"`      // JSON array of {"name", "signature", "doc"} for the same, with hover
+	SkipComments           bool     `json:"skipComments"`           // leave words that only appear in comments out of the index
+	Stopwords              bool     `json:"stopwords"`              // leave common english words (the, this, would, ...) out of the index wherever they appear
+	ExtraStopwords         []string `json:"extraStopwords"`         // more words to leave out, with or without the default set
+	NoisyWordLength        int      `json:"noisyWordLength"`        // words longer than this (hashes, base64 blobs) sink to the bottom of the menu, 0 turns it off
+	NoisyWordLetterRatio   float64  `json:"noisyWordLetterRatio"`   // so do words of 8+ characters where less than this fraction of the letters and digits are letters
+	StubsPath              string   `json:"stubsPath"`              // directory of .pyi stubs for member completion, typings/ or typeshed/ in the workspace are found on their own
+	PythonPath             string   `json:"pythonPath"`             // interpreter asked for module docstrings on hover
+	RecentFromResolve      bool     `json:"recentFromResolve"`      // count completionItem/resolve as picking the item, only right for clients that resolve on accept
+	Workers                int      `json:"workers"`                // requests handled at once, 0 for one per CPU
+	MaxDocumentBytes       int      `json:"maxDocumentBytes"`       // documents bigger than this are kept but never indexed or analysed, 0 for no limit
+	StatusInterval         int      `json:"statusInterval"`         // seconds between pypls/serverStatus notifications, 0 turns them off
+	StdlibMembers          bool     `json:"stdlibMembers"`          // complete `os.` and `sys.` from the small built in table of common members when the module is imported
+	TrimTrailingWhitespace bool     `json:"trimTrailingWhitespace"` // on willSaveWaitUntil
+	InsertFinalNewline     bool     `json:"insertFinalNewline"`     // on willSaveWaitUntil, also drops extra blank lines at the end
+	MemberCompletion       string   `json:"memberCompletion"`       // "scoped" works out what's after a `.`, "flat" completes it from the words like anything else
+	Completion             struct {
+		CallSnippets        bool `json:"callSnippets"`        // a call template with the parameters as placeholders next to each function, snippet clients only
+		AutoImport          bool `json:"autoImport"`          // names the other open documents define, with the import they need as an additional edit
+		Docstrings          bool `json:"docstrings"`          // after the opening `"""` of a def's docstring, a template with a `:param name:` line per parameter, snippet clients only
+		OverrideParams      bool `json:"overrideParams"`      // in the parameter list of a method, the parameters a base class's method of the same name takes
+		ShowDetail          bool `json:"showDetail"`          // a detail for items that have none: "12 uses" for the document's words, "builtin" or "keyword", "snippet"
+		DemoteUnusedImports bool `json:"demoteUnusedImports"` // modules imported with `import` that nothing is accessed on yet rank as if never used
+	} `json:"completion"`
+	Diagnostics struct {
+		DuplicateDefinitions bool     `json:"duplicateDefinitions"` // a def repeated in the same module or class body, warned on the second one
+		ShadowedBuiltins     bool     `json:"shadowedBuiltins"`     // module level names like `list` or `id` that hide a builtin
+		Brackets             bool     `json:"brackets"`             // unclosed or mismatched brackets and unterminated triple quoted strings
+		UnawaitedCalls       bool     `json:"unawaitedCalls"`       // a call of an async def of the document that an async def neither awaits nor keeps
+		UndefinedNames       bool     `json:"undefinedNames"`       // a name bound nowhere in scope, with the closest names that are as suggestions
+		Todos                bool     `json:"todos"`                // TODO, FIXME, HACK and XXX comments as hints, the tag as the code
+		Workspace            bool     `json:"workspace"`            // allow the pypls.lintWorkspace command, which checks every python file under the workspace
+		WorkspaceExclude     []string `json:"workspaceExclude"`     // directory names pypls.lintWorkspace never goes into, wherever they are. hidden ones are always skipped
+	} `json:"diagnostics"`
+}
+
+var options = defaultOptions()
+var optionsMu sync.RWMutex
+
+func defaultOptions() Options {
+	opts := Options{
+		FallbackOnEmpty:        true,
+		Stopwords:              true,
+		ExtraWordlistPriority:  5,
+		NoisyWordLength:        40,
+		NoisyWordLetterRatio:   0.5,
+		PythonPath:             "python",
+		StatusInterval:         30,
+		MaxDocumentBytes:       10 << 20,
+		TrimTrailingWhitespace: true,
+		InsertFinalNewline:     true,
+		MemberCompletion:       "scoped",
+	}
+	opts.Completion.CallSnippets = true
+	opts.Completion.Docstrings = true
+	opts.Completion.OverrideParams = true
+	opts.Completion.DemoteUnusedImports = true
+	opts.Completion.ShowDetail = true
+	opts.Diagnostics.DuplicateDefinitions = true
+	opts.Diagnostics.ShadowedBuiltins = true
+	opts.Diagnostics.Brackets = true
+	opts.Diagnostics.UnawaitedCalls = true
+	opts.Diagnostics.UndefinedNames = true
+	opts.Diagnostics.WorkspaceExclude = []string{"venv", "env", "node_modules", "__pycache__", "site-packages", "build", "dist"}
+	return opts
+}
+
+func getOptions() Options {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	return options
+}
+
+// fields missing from raw keep their current value
+func applyOptions(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var section struct {
+		Pypls json.RawMessage `json:"pypls"`
+	}
+	if err := json.Unmarshal(raw, &section); err == nil && len(section.Pypls) > 0 {
+		raw = section.Pypls
+	}
+
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	updated := options
+	if err := json.Unmarshal(raw, &updated); err != nil {
+		return err
+	}
+	if updated.MemberCompletion != "scoped" && updated.MemberCompletion != "flat" {
+		return fmt.Errorf("memberCompletion must be \"scoped\" or \"flat\", not %q", updated.MemberCompletion)
+	}
+	options = updated
+	invalidateCompletions()
+	return nil
+}
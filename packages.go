@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// importable names of the project's virtualenv: top level packages and modules plus one level of submodules.
+// what a package exports is only read from its __init__ when a `from x import` asks for it
+
+type sitePackage struct {
+	name string // dotted import name, "numpy" or "numpy.linalg"
+	dist string // the distribution installing it, "numpy" or "PyYAML"
+	path string // __init__.py[i] or the module file itself, empty for compiled modules
+}
+
+var sitePackages = map[string]sitePackage{}
+var packageExports = map[string][]stubMember{}
+var requirements = map[string]bool{} // distribution names from the workspace's requirements.txt, normalized
+var sitePackagesMu sync.Mutex
+
+// the venv the pythonPath setting points into, or .venv/venv in the workspace, or the one the server was started in
+func findVirtualenv(opts Options) string {
+	if strings.ContainsAny(opts.PythonPath, `/\`) {
+		return filepath.Dir(filepath.Dir(workspacePath(opts.PythonPath))) // <venv>/bin/python
+	}
+	if root := getWorkspaceRoot(); root != "" {
+		for _, dir := range []string{".venv", "venv"} {
+			if info, err := os.Stat(filepath.Join(root, dir)); err == nil && info.IsDir() {
+				return filepath.Join(root, dir)
+			}
+		}
+	}
+	return os.Getenv("VIRTUAL_ENV")
+}
+
+func findSitePackages(venv string) string {
+	if venv == "" {
+		return ""
+	}
+	candidates, _ := filepath.Glob(filepath.Join(venv, "lib", "python*", "site-packages"))
+	candidates = append(candidates, filepath.Join(venv, "Lib", "site-packages")) // windows layout
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// runs off the read loop, completions just see fewer packages until it's done
+func indexSitePackages(ctx context.Context, conn *jsonrpc2.Conn) {
+	site := findSitePackages(findVirtualenv(getOptions()))
+	packages := make(map[string]sitePackage)
+
+	if site != "" {
+		log(ctx, conn, "indexing packages in " + site)
+		entries, err := os.ReadDir(site)
+		if err != nil {
+			warn(ctx, conn, "could not read " + site + ": " + err.Error())
+		}
+		dists := distributionNames(site, entries)
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return // the client is gone
+			}
+			name, path, ok := importableEntry(site, entry)
+			if !ok { continue }
+			packages[name] = sitePackage{name, dists[name], path}
+
+			if !entry.IsDir() { continue }
+			subEntries, _ := os.ReadDir(filepath.Join(site, entry.Name()))
+			for _, sub := range subEntries {
+				subName, subPath, ok := importableEntry(filepath.Join(site, entry.Name()), sub)
+				if !ok { continue }
+				packages[name+"."+subName] = sitePackage{name + "." + subName, dists[name], subPath}
+			}
+		}
+		log(ctx, conn, "indexed " + strconv.Itoa(len(packages)) + " importable names from " + site)
+	}
+
+	sitePackagesMu.Lock()
+	sitePackages = packages
+	packageExports = make(map[string][]stubMember)
+	sitePackagesMu.Unlock()
+	invalidateCompletions()
+}
+
+// a package directory, a module file or a compiled extension, with the file its names can be read from
+func importableEntry(dir string, entry os.DirEntry) (name, path string, ok bool) {
+	n := entry.Name()
+	if strings.HasPrefix(n, "__") || strings.ContainsAny(n, "-") {
+		return "", "", false
+	}
+	if entry.IsDir() {
+		if strings.Contains(n, ".") {
+			return "", "", false
+		}
+		for _, init := range []string{"__init__.pyi", "__init__.py"} {
+			if _, err := os.Stat(filepath.Join(dir, n, init)); err == nil {
+				return n, filepath.Join(dir, n, init), true
+			}
+		}
+		return "", "", false
+	}
+	switch ext := filepath.Ext(n); ext {
+	case ".py", ".pyi":
+		return strings.TrimSuffix(n, ext), filepath.Join(dir, n), true
+	case ".so", ".pyd": // name.cpython-312-x86_64-linux-gnu.so
+		return n[:strings.Index(n, ".")], "", true
+	}
+	return "", "", false
+}
+
+// top level import name to the distribution that installs it, from each dist-info's top_level.txt or failing
+// that the first path component of the files in its RECORD
+func distributionNames(site string, entries []os.DirEntry) map[string]string {
+	dists := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".dist-info") { continue }
+		dist := strings.SplitN(strings.TrimSuffix(entry.Name(), ".dist-info"), "-", 2)[0]
+		info := filepath.Join(site, entry.Name())
+
+		names := make([]string, 0)
+		if data, err := os.ReadFile(filepath.Join(info, "top_level.txt")); err == nil {
+			names = strings.Fields(string(data))
+		}else if f, err := os.Open(filepath.Join(info, "RECORD")); err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				file := strings.SplitN(scanner.Text(), ",", 2)[0]
+				first := strings.SplitN(file, "/", 2)[0]
+				if strings.HasSuffix(first, ".dist-info") || strings.HasPrefix(first, "__") || strings.HasPrefix(first, "..") { continue }
+				names = append(names, strings.TrimSuffix(first, ".py"))
+			}
+			f.Close()
+		}
+		for _, name := range names {
+			if _, seen := dists[name]; !seen {
+				dists[name] = dist
+			}
+		}
+	}
+	return dists
+}
+
+// what `from name import ...` can pull out of a package: the public names its __init__ binds, imports included
+// since that's how packages re-export, plus its indexed submodules
+func getPackageExports(name string) []stubMember {
+	sitePackagesMu.Lock()
+	defer sitePackagesMu.Unlock()
+	if exports, ok := packageExports[name]; ok {
+		return exports
+	}
+	pkg, ok := sitePackages[name]
+	if !ok {
+		return nil
+	}
+
+	exports := make([]stubMember, 0)
+	if content, err := os.ReadFile(pkg.path); err == nil && pkg.path != "" {
+		root := analyzeScopes(string(content))
+		for _, n := range root.order {
+			if strings.HasPrefix(n, "_") { continue }
+			kind := 6
+			switch root.bindings[n][0].kind {
+			case bindDef:
+				kind = 3
+			case bindClass:
+				kind = 7
+			case bindImport:
+				kind = 9
+			}
+			exports = append(exports, stubMember{n, kind, "", filepath.Base(pkg.path)})
+		}
+	}
+	for _, sub := range childModules(sitePackages, name) {
+		exports = append(exports, stubMember{sub, 9, "module " + name + "." + sub, ""})
+	}
+
+	packageExports[name] = exports
+	return exports
+}
+
+// the next component of every indexed name directly under parent, all top level names when parent is empty
+func childModules[T any](index map[string]T, parent string) []string {
+	children := make([]string, 0)
+	for name := range index {
+		rest := name
+		if parent != "" {
+			var found bool
+			if rest, found = strings.CutPrefix(name, parent+"."); !found { continue }
+		}
+		if !strings.Contains(rest, ".") {
+			children = append(children, rest)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+func getSitePackage(name string) (sitePackage, bool) {
+	sitePackagesMu.Lock()
+	defer sitePackagesMu.Unlock()
+	pkg, ok := sitePackages[name]
+	return pkg, ok
+}
+
+func sitePackageChildren(parent string) []string {
+	sitePackagesMu.Lock()
+	defer sitePackagesMu.Unlock()
+	return childModules(sitePackages, parent)
+}
+
+// pip compares distribution names case insensitively with - _ and . all the same
+func normalizeDistribution(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(name))
+}
+
+// read in line rather than with the site-packages index, it's one small file
+func loadRequirements() {
+	required := readRequirements()
+	sitePackagesMu.Lock()
+	requirements = required
+	sitePackagesMu.Unlock()
+	invalidateCompletions()
+}
+
+// the distributions requirements.txt at the workspace root asks for. options (-r, -e, --index-url) and urls
+// are skipped, only `name`, `name==1.0`, `name[extra]>=1; python_version < "3.12"` and the like count
+func readRequirements() map[string]bool {
+	required := make(map[string]bool)
+	root := getWorkspaceRoot()
+	if root == "" {
+		return required
+	}
+	data, err := os.ReadFile(filepath.Join(root, "requirements.txt"))
+	if err != nil {
+		return required
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") { continue }
+		if end := strings.IndexAny(line, "[<>=!~;@ \t"); end >= 0 {
+			line = line[:end]
+		}
+		if line != "" {
+			required[normalizeDistribution(line)] = true
+		}
+	}
+	return required
+}
+
+// whether the project uses a third party package: installed in its virtualenv or listed in requirements.txt
+func packageAvailable(module string) bool {
+	top := strings.SplitN(module, ".", 2)[0]
+	if _, ok := getSitePackage(top); ok {
+		return true
+	}
+	sitePackagesMu.Lock()
+	defer sitePackagesMu.Unlock()
+	return requirements[normalizeDistribution(top)]
+}
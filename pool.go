@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// requests run on at most `workers` goroutines at once, the rest wait for a slot. a request still waiting
+// when the client cancels it never runs
+
+type requestPool struct {
+	mu      sync.Mutex
+	slots   chan struct{}
+	running map[jsonrpc2.ID]context.CancelFunc
+}
+
+// the slots for the current workers setting. a resize only swaps the channel, requests holding a slot of the
+// old one hand it back there
+func (p *requestPool) pool() chan struct{} {
+	size := getOptions().Workers
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.slots == nil || cap(p.slots) != size {
+		p.slots = make(chan struct{}, size)
+	}
+	return p.slots
+}
+
+// registered before the goroutine starts so a $/cancelRequest read right after the request always finds it
+func (p *requestPool) track(ctx context.Context, id jsonrpc2.ID) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == nil {
+		p.running = make(map[jsonrpc2.ID]context.CancelFunc)
+	}
+	p.running[id] = cancel
+	return ctx
+}
+
+func (p *requestPool) done(id jsonrpc2.ID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cancel, ok := p.running[id]; ok {
+		cancel()
+		delete(p.running, id)
+	}
+}
+
+func (p *requestPool) cancel(raw *json.RawMessage) {
+	var params struct {
+		ID jsonrpc2.ID `json:"id"`
+	}
+	if raw == nil || json.Unmarshal(*raw, &params) != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cancel, ok := p.running[params.ID]; ok {
+		cancel()
+	}
+}
+
+func (p *requestPool) run(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, handle func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request)) {
+	ctx = p.track(ctx, req.ID)
+	go func() {
+		defer p.done(req.ID)
+		slots := p.pool()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			replyCancelled(ctx, conn, req)
+			return
+		}
+		defer func() { <-slots }()
+		if replyCancelled(ctx, conn, req) { // cancelled while both were ready
+			return
+		}
+		handle(ctx, conn, req)
+	}()
+}
+
+// replies RequestCancelled when the request was cancelled, handlers doing real work check before replying
+func replyCancelled(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	replyError(ctx, conn, req, ErrCancelled)
+	return true
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// a completion that takes its time doesn't hold up the didChange sent after it: the edit is applied while the
+// completion is still running. here it runs until the server is let write its answer
+func TestSlowCompletionDoesNotBlockDidChange(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///slow.py"
+	c.open(uri, "value = 1\nva\n")
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{1, 2}}
+	c.call("textDocument/completion", params, nil) // whatever the didOpen sends is out of the way
+
+	c.serverWrites.Lock()
+	release := sync.OnceFunc(c.serverWrites.Unlock)
+	defer release()
+	waiter, err := c.conn.DispatchCall(context.Background(), "textDocument/completion", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a server stuck on the completion wouldn't read this, so it's sent from elsewhere
+	go c.conn.Notify(context.Background(), "textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []any{map[string]any{"text": "value = 1\nvalue\n"}},
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if file, _ := getFile(uri); file.content == "value = 1\nvalue\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("didChange not applied while a completion was running")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	release()
+	if err := waiter.Wait(context.Background(), nil); err != nil {
+		t.Errorf("completion: %v", err)
+	}
+}
+
+// never more than `workers` handlers at once, and every request still runs
+func TestPoolIsBounded(t *testing.T) {
+	resetServerState()
+	optionsMu.Lock()
+	options.Workers = 2
+	optionsMu.Unlock()
+
+	var pool requestPool
+	var running, peak, ran atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		pool.run(context.Background(), nil, &jsonrpc2.Request{ID: jsonrpc2.ID{Num: uint64(i)}}, func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+			ran.Add(1)
+		})
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("%d handlers ran at once with 2 workers", peak.Load())
+	}
+	if ran.Load() != 20 {
+		t.Errorf("%d of 20 requests ran", ran.Load())
+	}
+}
+
+// edits to several documents interleaved with requests on them, on a pool smaller than the load. every request
+// is answered, each sees at least the edits sent before it, and the documents end on their last edit
+func TestPoolStress(t *testing.T) {
+	c := newTestServer(t, map[string]any{"workers": 2}, nil)
+	const documents, edits = 4, 40
+	uri := func(d int) string { return fmt.Sprintf("file:///stress%d.py", d) }
+	text := func(d, v int) string { return fmt.Sprintf("d%d_v%d = %d\nd%d\n", d, v, v, d) }
+	for d := 0; d < documents; d++ {
+		c.open(uri(d), text(d, 1))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, documents*edits*2)
+	for v := 2; v <= edits; v++ {
+		for d := 0; d < documents; d++ {
+			c.change(uri(d), v, text(d, v))
+			wg.Add(2)
+			go func(d, v int) {
+				defer wg.Done()
+				var list CompletionList
+				params := map[string]any{"textDocument": map[string]any{"uri": uri(d)}, "position": Position{1, 2}}
+				if err := c.callErr("textDocument/completion", params, &list); err != nil {
+					errs <- fmt.Errorf("completion on %d after v%d: %v", d, v, err)
+					return
+				}
+				for _, item := range list.Items {
+					var seen int
+					if n, _ := fmt.Sscanf(item.Label, fmt.Sprintf("d%d_v%%d", d), &seen); n == 1 && seen >= v {
+						return
+					}
+				}
+				errs <- fmt.Errorf("completion on %d after v%d saw an older document: %v", d, v, labels(list.Items))
+			}(d, v)
+			go func(d int) {
+				defer wg.Done()
+				params := map[string]any{"textDocument": map[string]any{"uri": uri(d)}, "position": Position{0, 0}}
+				if err := c.callErr("textDocument/hover", params, nil); err != nil {
+					errs <- fmt.Errorf("hover on %d: %v", d, err)
+				}
+			}(d)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	c.call("pypls/ping", nil, nil)
+	for d := 0; d < documents; d++ {
+		file, ok := getFile(uri(d))
+		if !ok || !strings.HasPrefix(file.content, fmt.Sprintf("d%d_v%d ", d, edits)) {
+			t.Errorf("document %d ended on %q, want the last edit", d, file.content)
+		}
+	}
+}
+
+// the dispatcher held still: one worker, taken by a completion stuck on an identical one in flight. didChange
+// and a completion sent back to back behind it must apply the edit at once and run the completion on the edited
+// text once the worker frees up. were edits queued on the workers like requests this would hang or complete `va`
+func TestCompletionSeesTheEditSentBeforeIt(t *testing.T) {
+	c := newTestServer(t, map[string]any{"workers": 1}, nil)
+	uri := "file:///typing.py"
+	c.open(uri, "value = 1\nva\n")
+	c.call("pypls/ping", nil, nil)
+
+	key := completionKey{uri, completionRevision.Load(), 1, 2, 0, ""}
+	stuck := &completionCall{done: make(chan struct{})}
+	completions.mu.Lock()
+	completions.calls[key] = stuck
+	completions.mu.Unlock()
+	released := false
+	defer func() {
+		if !released {
+			close(stuck.done)
+		}
+	}()
+
+	first := make(chan error, 1)
+	go func() {
+		params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{1, 2}}
+		first <- c.conn.Call(context.Background(), "textDocument/completion", params, nil)
+	}()
+	time.Sleep(20 * time.Millisecond) // holding the worker
+
+	c.change(uri, 2, "value = 1\nvalu\n")
+	second := make(chan CompletionList, 1)
+	go func() {
+		var list CompletionList
+		params := map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{1, 4}}
+		c.conn.Call(context.Background(), "textDocument/completion", params, &list)
+		second <- list
+	}()
+
+	c.call("pypls/ping", nil, nil)
+	if file, _ := getFile(uri); file.version != 2 {
+		t.Fatalf("the edit waited behind the busy worker, version %d", file.version)
+	}
+	select {
+	case <-second:
+		t.Fatal("the second completion ran with the only worker taken")
+	default:
+	}
+
+	close(stuck.done)
+	released = true
+	if err := <-first; err != nil {
+		t.Errorf("first completion: %v", err)
+	}
+	list := <-second
+	item, ok := findItem(list.Items, "value")
+	if !ok || item.TextEdit == nil || item.TextEdit.Range != (Range{Position{1, 0}, Position{1, 4}}) {
+		t.Errorf("value = %+v, %v, want it replacing valu", item, ok)
+	}
+}
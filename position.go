@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// how the client counts the characters of a position: utf-16 code units unless it offered utf-8 in
+// initialize, then they're byte offsets and there's nothing to convert. lineOffset and lineCharacter are the
+// only places that look at this
+const (
+	encodingUTF8  = "utf-8"
+	encodingUTF16 = "utf-16"
+)
+
+var positionEncoding = encodingUTF16 // set while handling initialize and only read after
+
+// positions coming from the client count characters, everything in here works on byte offsets into a line
+func splitLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// byte offset of the given character in line, clamped to the end of the line. a position in the middle of a
+// character (half a surrogate pair, a byte inside a utf-8 sequence) goes to the end of it
+func lineOffset(line string, character int) int {
+	if positionEncoding == encodingUTF8 {
+		offset := max(0, min(character, len(line)))
+		for offset < len(line) && !utf8.RuneStart(line[offset]) {
+			offset++
+		}
+		return offset
+	}
+	offset := 0
+	for units := 0; units < character && offset < len(line); {
+		r, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+		units += utf16.RuneLen(r)
+	}
+	return offset
+}
+
+// the inverse of lineOffset
+func lineCharacter(line string, offset int) int {
+	if offset > len(line) {
+		offset = len(line)
+	}
+	if positionEncoding == encodingUTF8 {
+		return offset
+	}
+	units := 0
+	for _, r := range line[:offset] {
+		units += utf16.RuneLen(r)
+	}
+	return units
+}
+
+func isWordChar(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// the identifier touching the given position along with its byte range in the line, empty if there isn't one.
+// inCode is false when the position is inside string content or a comment (f-string replacement fields are code)
+func wordAtPosition(content string, line, character int) (word string, start, end int, inCode bool) {
+	lines := splitLines(content)
+	if line < 0 || line >= len(lines) {
+		return "", 0, 0, false
+	}
+	text := lines[line]
+	offset := lineOffset(text, character)
+
+	start = offset
+	for start > 0 {
+		c, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isWordChar(c) { break }
+		start -= size
+	}
+	end = offset
+	for end < len(text) {
+		c, size := utf8.DecodeRuneInString(text[end:])
+		if !isWordChar(c) { break }
+		end += size
+	}
+
+	inCode = inCodeContext(tokenize(content), line, offset)
+
+	word = text[start:end]
+	if word != "" && unicode.IsDigit([]rune(word)[0]) { // numbers aren't something you can go to
+		return "", 0, 0, inCode
+	}
+	return word, start, end, inCode
+}
+
+func rangeOnLine(lines []string, line, start, end int) Range {
+	text := ""
+	if line < len(lines) {
+		text = lines[line]
+	}
+	return Range{
+		Start: Position{line, lineCharacter(text, start)},
+		End:   Position{line, lineCharacter(text, end)},
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import "testing"
+
+// runs fn once with each position encoding set
+func underEachEncoding(t *testing.T, fn func(t *testing.T, encoding string)) {
+	t.Cleanup(func() { positionEncoding = encodingUTF16 })
+	for _, encoding := range []string{encodingUTF16, encodingUTF8} {
+		t.Run(encoding, func(t *testing.T) {
+			positionEncoding = encoding
+			fn(t, encoding)
+		})
+	}
+}
+
+// é is two bytes and one utf-16 unit, 😀 four bytes and a surrogate pair
+const mixedLine = "é = '😀' + x"
+
+func TestPositionMath(t *testing.T) {
+	tests := []struct {
+		offset, utf16 int
+	}{
+		{0, 0}, {2, 1}, {6, 5}, {10, 7}, {14, 11}, {15, 12},
+	}
+	underEachEncoding(t, func(t *testing.T, encoding string) {
+		for _, tt := range tests {
+			character := tt.offset
+			if encoding == encodingUTF16 {
+				character = tt.utf16
+			}
+			if got := lineOffset(mixedLine, character); got != tt.offset {
+				t.Errorf("lineOffset(%d) = %d, want %d", character, got, tt.offset)
+			}
+			if got := lineCharacter(mixedLine, tt.offset); got != character {
+				t.Errorf("lineCharacter(%d) = %d, want %d", tt.offset, got, character)
+			}
+		}
+		// past the end clamps to it
+		if got := lineOffset(mixedLine, 100); got != len(mixedLine) {
+			t.Errorf("lineOffset past the end = %d", got)
+		}
+		if got := lineCharacter(mixedLine, 100); got != lineCharacter(mixedLine, len(mixedLine)) {
+			t.Errorf("lineCharacter past the end = %d", got)
+		}
+	})
+}
+
+// a position inside a character moves to its end
+func TestPositionInsideACharacter(t *testing.T) {
+	underEachEncoding(t, func(t *testing.T, encoding string) {
+		inside := map[string]int{encodingUTF16: 6, encodingUTF8: 7}[encoding] // in the middle of 😀
+		if got := lineOffset(mixedLine, inside); got != 10 {
+			t.Errorf("lineOffset(%d) = %d, want 10", inside, got)
+		}
+		if encoding == encodingUTF8 {
+			if got := lineOffset(mixedLine, 1); got != 2 { // the second byte of é
+				t.Errorf("lineOffset(1) = %d, want 2", got)
+			}
+		}
+	})
+}
+
+func TestWordAtPositionUnderEachEncoding(t *testing.T) {
+	content := "x = 1\n" + mixedLine + "\n"
+	underEachEncoding(t, func(t *testing.T, encoding string) {
+		character := map[string]int{encodingUTF16: 11, encodingUTF8: 14}[encoding]
+		word, start, end, inCode := wordAtPosition(content, 1, character)
+		if word != "x" || start != 14 || end != 15 || !inCode {
+			t.Errorf("wordAtPosition = %q %d %d %v, want x 14 15 true", word, start, end, inCode)
+		}
+		r := rangeOnLine(splitLines(content), 1, start, end)
+		if r.Start.Character != character || r.End.Character != character+1 {
+			t.Errorf("rangeOnLine = %v", r)
+		}
+	})
+}
+
+// the encoding the client offers is the one advertised and the one positions come back in
+func TestPositionEncodingNegotiation(t *testing.T) {
+	uri := "file:///encoded.py"
+	text := "café = 1\nx = café + café\n"
+	tests := []struct {
+		offered   []string
+		encoding  string
+		character int // of the second café on line 1
+		end       int // of the café on line 0
+	}{
+		{nil, encodingUTF16, 11, 4},
+		{[]string{"utf-16"}, encodingUTF16, 11, 4},
+		{[]string{"utf-8", "utf-16"}, encodingUTF8, 12, 5},
+	}
+	for _, tt := range tests {
+		c := newTestConnection(t)
+		var result struct {
+			Capabilities struct {
+				PositionEncoding string `json:"positionEncoding"`
+			} `json:"capabilities"`
+		}
+		capabilities := map[string]any{"general": map[string]any{"positionEncodings": tt.offered}}
+		c.call("initialize", map[string]any{"capabilities": capabilities}, &result)
+		c.notify("initialized", map[string]any{})
+		if result.Capabilities.PositionEncoding != tt.encoding {
+			t.Errorf("offered %v, advertised %q, want %q", tt.offered, result.Capabilities.PositionEncoding, tt.encoding)
+		}
+		c.open(uri, text)
+		locations := c.definition(uri, 1, tt.character)
+		want := Range{Position{0, 0}, Position{0, tt.end}}
+		if len(locations) != 1 || locations[0].Range != want {
+			t.Errorf("%s: definition = %v, want %v", tt.encoding, locations, want)
+		}
+	}
+}
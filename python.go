@@ -0,0 +1,347 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// lightweight structural helpers over the raw lines of a python file, everything here is indentation based
+
+var classHeaderRe = regexp.MustCompile(`^(\s*)class\s+(\w+)\s*(?:\((.*)\))?\s*:`)
+var defHeaderRe = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+(\w+)\s*\(`)
+var simpleAssignRe = regexp.MustCompile(`^(\s*)(\w+)\s*(?::\s*([^=]+?))?\s*=\s*([^=].*)$`)
+
+type classInfo struct {
+	name   string
+	bases  []string
+	line   int // the `class` line
+	indent int
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func isBlankLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+var codingLineRe = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=]`)
+
+// the top of a module ends after a shebang, an encoding declaration (python only looks for one on the first two
+// lines) and the module docstring, single or triple quoted, raw or not. anything inserted "at the top of the
+// file" goes here. the line can be one past the last when the docstring ends the file without a newline
+func moduleHeaderEnd(content string) Position {
+	lines := splitLines(content)
+	end := 0
+	if end < len(lines) && strings.HasPrefix(lines[end], "#!") {
+		end++
+	}
+	if end < len(lines) && end < 2 && codingLineRe.MatchString(lines[end]) {
+		end++
+	}
+	if ll := logicalLines(lines, tokenize(content)); len(ll) > 0 && len(ll[0].tokens) == 1 && ll[0].tokens[0].kind == tokenString {
+		end = ll[0].endLine + 1
+	}
+	return Position{end, 0}
+}
+
+func parseClassHeader(lines []string, i int) (classInfo, bool) {
+	if !strings.HasPrefix(strings.TrimLeft(lines[i], " \t"), "class") { // most lines, without running the regex
+		return classInfo{}, false
+	}
+	m := classHeaderRe.FindStringSubmatch(lines[i])
+	if m == nil {
+		return classInfo{}, false
+	}
+	bases := make([]string, 0)
+	for _, b := range strings.Split(m[3], ",") {
+		if b = strings.TrimSpace(b); b != "" && !strings.Contains(b, "=") { // metaclass=... isn't a base
+			bases = append(bases, b)
+		}
+	}
+	return classInfo{m[2], bases, i, len(m[1])}, true
+}
+
+// the innermost class whose body contains the given line
+func enclosingClass(lines []string, line int) (classInfo, bool) {
+	if line < 0 || line >= len(lines) {
+		return classInfo{}, false
+	}
+	threshold := indentOf(lines[line])
+	for i := line - 1; i >= 0 && threshold > 0; i-- {
+		if isBlankLine(lines[i]) { continue }
+		indent := indentOf(lines[i])
+		if indent >= threshold { continue }
+		if cls, ok := parseClassHeader(lines, i); ok {
+			return cls, true
+		}
+		threshold = indent
+	}
+	return classInfo{}, false
+}
+
+func findClass(lines []string, name string) (classInfo, bool) {
+	for i := range lines {
+		if cls, ok := parseClassHeader(lines, i); ok && cls.name == name {
+			return cls, true
+		}
+	}
+	return classInfo{}, false
+}
+
+// indices of the lines directly in the class body, nested blocks (method bodies and such) are skipped
+func classBodyLines(lines []string, cls classInfo) []int {
+	body := make([]int, 0)
+	bodyIndent := -1
+	for i := cls.line + 1; i < len(lines); i++ {
+		if isBlankLine(lines[i]) { continue }
+		indent := indentOf(lines[i])
+		if indent <= cls.indent { break }
+		if bodyIndent < 0 {
+			bodyIndent = indent
+		}
+		if indent == bodyIndent {
+			body = append(body, i)
+		}
+	}
+	return body
+}
+
+func baseName(base string) string {
+	if i := strings.LastIndex(base, "."); i >= 0 {
+		return base[i+1:]
+	}
+	return base
+}
+
+func isEnumClass(cls classInfo) bool {
+	for _, b := range cls.bases {
+		switch baseName(b) {
+		case "Enum", "IntEnum", "StrEnum", "Flag", "IntFlag":
+			return true
+		}
+	}
+	return false
+}
+
+type enumMember struct {
+	name  string
+	value string
+}
+
+// the NAME = value assignments directly in the class body
+func enumMembers(lines []string, cls classInfo) []enumMember {
+	members := make([]enumMember, 0)
+	for _, i := range classBodyLines(lines, cls) {
+		m := simpleAssignRe.FindStringSubmatch(lines[i])
+		if m == nil { continue }
+		members = append(members, enumMember{m[2], strings.TrimSpace(m[4])})
+	}
+	return members
+}
+
+// the value assigned to memberName in the Enum subclass className
+func resolveEnumMember(content, className, memberName string) (value string, found bool) {
+	lines := splitLines(content)
+	cls, ok := findClass(lines, className)
+	if !ok || !isEnumClass(cls) {
+		return "", false
+	}
+	for _, m := range enumMembers(lines, cls) {
+		if m.name == memberName {
+			return m.value, true
+		}
+	}
+	return "", false
+}
+
+var decoratorRe = regexp.MustCompile(`^\s*@([\w.]+)`)
+
+// methods of the class decorated with a bare @property, in order
+func findPropertyNames(content, className string) []string {
+	lines := splitLines(content)
+	cls, ok := findClass(lines, className)
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, 0)
+	isProperty := false
+	for _, i := range classBodyLines(lines, cls) {
+		if m := decoratorRe.FindStringSubmatch(lines[i]); m != nil {
+			isProperty = isProperty || m[1] == "property"
+			continue
+		}
+		if m := defHeaderRe.FindStringSubmatch(lines[i]); m != nil && isProperty {
+			names = append(names, m[2])
+		}
+		isProperty = false
+	}
+	return names
+}
+
+var classFieldRe = regexp.MustCompile(`^\s*(\w+)\s*:\s*([^=]+?)\s*(?:=.*)?$`)
+
+type classField struct {
+	name       string
+	annotation string
+}
+
+// `name: type` declarations directly in the class body, what dataclasses, NamedTuples and TypedDicts are made of
+func classFields(lines []string, cls classInfo) []classField {
+	fields := make([]classField, 0)
+	for _, i := range classBodyLines(lines, cls) {
+		if m := classFieldRe.FindStringSubmatch(lines[i]); m != nil && !pythonKeywords[m[1]] {
+			fields = append(fields, classField{m[1], m[2]})
+		}
+	}
+	return fields
+}
+
+func isTypedDictClass(cls classInfo) bool {
+	for _, b := range cls.bases {
+		if baseName(b) == "TypedDict" {
+			return true
+		}
+	}
+	return false
+}
+
+// the keys declared by the TypedDict class typeName, nil when there's no such TypedDict in content
+func findTypedDictKeys(content, typeName string) []string {
+	lines := splitLines(content)
+	cls, ok := findClass(lines, typeName)
+	if !ok || !isTypedDictClass(cls) {
+		return nil
+	}
+	keys := make([]string, 0)
+	for _, f := range classFields(lines, cls) {
+		keys = append(keys, f.name)
+	}
+	return keys
+}
+
+// the type a variable was declared with, from an annotation (`x: Foo`, parameters included) or a constructor call
+// (`x = Foo(...)`), empty when neither shows up
+func declaredType(content, name string) string {
+	quoted := regexp.QuoteMeta(name)
+	if m := regexp.MustCompile(`\b` + quoted + `\s*:\s*([\w.]+)`).FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	if m := regexp.MustCompile(`(?m)^\s*` + quoted + `\s*=\s*([\w.]+)\(`).FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+var importLineRe = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+(.+)$`)
+var fromImportLineRe = regexp.MustCompile(`(?m)^[ \t]*from[ \t]+([\w.]+)[ \t]+import[ \t]+(.+)$`)
+
+// the dotted name a local name was imported as, `import numpy as np` gives "numpy" for np and
+// `from os import path` gives "os.path" for path. empty when name isn't imported
+func importedName(content, name string) string {
+	return fileImports(content)[name]
+}
+
+// every imported name of content with where it came from, the first binding of a name wins. variable types
+// ask once per assignment so the last few documents' results are kept, comparing a document against itself is
+// just a pointer check
+func fileImports(content string) map[string]string {
+	importsCacheMu.Lock()
+	for _, c := range importsCache {
+		if c.content == content {
+			importsCacheMu.Unlock()
+			return c.imports
+		}
+	}
+	importsCacheMu.Unlock()
+
+	imports := make(map[string]string)
+	bind := func(name, origin string) {
+		if _, seen := imports[name]; !seen {
+			imports[name] = origin
+		}
+	}
+	for _, m := range importLineRe.FindAllStringSubmatch(content, -1) {
+		for _, item := range strings.Split(m[1], ",") {
+			fields := strings.Fields(item)
+			if len(fields) == 3 && fields[1] == "as" {
+				bind(fields[2], fields[0])
+			}
+			if len(fields) == 1 {
+				head := strings.Split(fields[0], ".")[0]
+				bind(head, head)
+			}
+		}
+	}
+	for _, m := range fromImportLineRe.FindAllStringSubmatch(content, -1) {
+		names := strings.Trim(strings.TrimSpace(m[2]), "()")
+		for _, item := range strings.Split(names, ",") {
+			fields := strings.Fields(item)
+			if len(fields) == 3 && fields[1] == "as" {
+				bind(fields[2], m[1]+"."+fields[0])
+			}
+			if len(fields) == 1 {
+				bind(fields[0], m[1]+"."+fields[0])
+			}
+		}
+	}
+
+	importsCacheMu.Lock()
+	importsCache = append(importsCache[max(0, len(importsCache)-importsCacheSize+1):], parsedImports{content, imports})
+	importsCacheMu.Unlock()
+	return imports
+}
+
+type parsedImports struct {
+	content string
+	imports map[string]string
+}
+
+const importsCacheSize = 4
+
+var importsCache []parsedImports
+var importsCacheMu sync.Mutex
+
+var defSignatureRe = regexp.MustCompile(`^\s*((?:async\s+)?def\s+\w+\s*\(.*?\)(?:\s*->\s*[^:]+)?)\s*:`)
+
+// `def name(args) -> ret` off a def line, body on the same line or not
+func defSignature(line string) string {
+	if m := defSignatureRe.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return strings.TrimSuffix(strings.TrimSpace(line), ":")
+}
+
+var selfAttributeRe = regexp.MustCompile(`\bself\.(\w+)\s*(?::[^=]*)?=[^=]`)
+
+type classMember struct {
+	name   string
+	kind   int // CompletionItemKind
+	detail string
+}
+
+// what `self.` can reach that the class itself provides: methods, class attributes and every `self.x = ...`
+// assigned anywhere in its methods
+func classMembers(lines []string, cls classInfo) []classMember {
+	members := make([]classMember, 0)
+	for _, i := range classBodyLines(lines, cls) {
+		if m := defHeaderRe.FindStringSubmatch(lines[i]); m != nil {
+			members = append(members, classMember{m[2], 2, defSignature(lines[i])})
+		}else if m := simpleAssignRe.FindStringSubmatch(lines[i]); m != nil {
+			members = append(members, classMember{m[2], 5, m[3]})
+		}else if m := classFieldRe.FindStringSubmatch(lines[i]); m != nil {
+			members = append(members, classMember{m[1], 5, m[2]})
+		}
+	}
+	for i := cls.line + 1; i < len(lines); i++ {
+		if !isBlankLine(lines[i]) && indentOf(lines[i]) <= cls.indent { break }
+		for _, m := range selfAttributeRe.FindAllStringSubmatch(lines[i], -1) {
+			members = append(members, classMember{m[1], 5, ""})
+		}
+	}
+	return members
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// the imports cache is keyed by content, documents asked about in turn each get their own imports
+func TestImportedNameAcrossDocuments(t *testing.T) {
+	a := "import numpy as np\nfrom os import path\n"
+	b := "import pandas as np\n"
+	for i := 0; i < importsCacheSize+2; i++ {
+		if got := importedName(a, "np"); got != "numpy" {
+			t.Fatalf("np in a = %q, want numpy", got)
+		}
+		if got := importedName(a, "path"); got != "os.path" {
+			t.Fatalf("path in a = %q, want os.path", got)
+		}
+		if got := importedName(b, "np"); got != "pandas" {
+			t.Fatalf("np in b = %q, want pandas", got)
+		}
+		if got := importedName(b, "path"); got != "" {
+			t.Fatalf("path in b = %q, want nothing", got)
+		}
+		importedName("import other_"+strconv.Itoa(i)+" as np\n", "np") // pushes others out of the cache
+	}
+}
+
+func TestParseClassHeader(t *testing.T) {
+	lines := []string{"class Plain:", "    class Inner(Base, metaclass=Meta):", "classify = 1", "x = Plain()", "\tclass Tabbed:"}
+	tests := []struct {
+		line int
+		name string
+		ok   bool
+	}{
+		{0, "Plain", true},
+		{1, "Inner", true},
+		{2, "", false},
+		{3, "", false},
+		{4, "Tabbed", true},
+	}
+	for _, tt := range tests {
+		cls, ok := parseClassHeader(lines, tt.line)
+		if ok != tt.ok || cls.name != tt.name {
+			t.Errorf("parseClassHeader(%q) = %q, %v, want %q, %v", lines[tt.line], cls.name, ok, tt.name, tt.ok)
+		}
+	}
+}
+
+// where an inserted import goes: after the shebang, the coding line and the module docstring, whichever are there
+func TestModuleHeaderEnd(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          int
+	}{
+		{"neither", "import os\n", 0},
+		{"shebang only", "#!/usr/bin/env python3\nimport os\n", 1},
+		{"docstring only", "\"\"\"Tools.\n\nMore about them.\n\"\"\"\nimport os\n", 4},
+		{"both", "#!/usr/bin/env python3\n\"\"\"Tools.\"\"\"\nimport os\n", 2},
+		{"shebang, coding line and docstring", "#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\n\"\"\"Tools.\"\"\"\n", 3},
+		{"single quotes", "'''Tools.\n'''\nimport os\n", 2},
+		{"single quoted line", "'Tools.'\nimport os\n", 1},
+		{"raw docstring", "r\"\"\"Matches \\d+.\"\"\"\nimport re\n", 1},
+		{"a string that isn't alone", "\"\"\"Tools.\"\"\" + suffix\nimport os\n", 0},
+		{"empty", "", 0},
+	}
+	for _, tt := range tests {
+		if got := moduleHeaderEnd(tt.content); got != (Position{tt.want, 0}) {
+			t.Errorf("%s: moduleHeaderEnd = %v, want line %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// completions the user picked this session float up in later menus. full strength for a while after the
+// pick, then halving every recentHalfLife
+const (
+	recentFullBoost = 5 * time.Minute
+	recentHalfLife  = 5 * time.Minute
+	recentMaxBoost  = 40 // in match score points, a bit more than two well placed matching characters
+	recentForget    = time.Hour
+)
+
+var recentlyUsed = map[string]time.Time{}
+var recentlyUsedMu sync.Mutex
+
+func recordCompletionChosen(label string) {
+	recentlyUsedMu.Lock()
+	defer recentlyUsedMu.Unlock()
+	defer invalidateCompletions()
+	now := time.Now()
+	recentlyUsed[label] = now
+	for l, t := range recentlyUsed {
+		if now.Sub(t) > recentForget {
+			delete(recentlyUsed, l)
+		}
+	}
+}
+
+func recencyBoost(label string) int {
+	recentlyUsedMu.Lock()
+	t, ok := recentlyUsed[label]
+	recentlyUsedMu.Unlock()
+	if !ok {
+		return 0
+	}
+	age := time.Since(t)
+	if age <= recentFullBoost {
+		return recentMaxBoost
+	}
+	return int(recentMaxBoost * math.Exp2(-float64(age-recentFullBoost)/float64(recentHalfLife)))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// textDocument/rename. the scope analyzer decides which scope the name under the cursor lives in and every code
+// token resolving to that same scope is rewritten, so strings never are and f-string replacement fields are.
+// names from a class body (methods, class attributes) or after a dot go by attribute name across the workspace
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type WorkspaceEdit struct {
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+// the request was fine but the rename can't be done
+func renameFailed(message string) *jsonrpc2.Error {
+	return &jsonrpc2.Error{Code: codeRequestFailed, Message: message}
+}
+
+type renameEdits struct {
+	newName string
+	files   map[string]OpenFile
+	edits   map[string]map[[2]int]TextEdit // uri to (line, byte offset) so the same token is never edited twice
+}
+
+func (r *renameEdits) add(uri string, tok token) {
+	if r.edits[uri] == nil {
+		r.edits[uri] = make(map[[2]int]TextEdit)
+	}
+	lines := splitLines(r.files[uri].content)
+	r.edits[uri][[2]int{tok.line, tok.start}] = TextEdit{rangeOnLine(lines, tok.line, tok.start, tok.end), r.newName}
+}
+
+func (r *renameEdits) workspaceEdit() *WorkspaceEdit {
+	changes := make(map[string][]TextEdit)
+	for uri, edits := range r.edits {
+		list := make([]TextEdit, 0, len(edits))
+		for _, e := range edits {
+			list = append(list, e)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			a, b := list[i].Range.Start, list[j].Range.Start
+			return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+		})
+		changes[uri] = list
+	}
+	return &WorkspaceEdit{changes}
+}
+
+func afterDot(tokens []token, i int) bool {
+	return i > 0 && isOp(tokens[i-1], ".")
+}
+
+// the python files to look through, sorted so edits come out the same every time
+func pythonURIs(files map[string]OpenFile) []string {
+	uris := make([]string, 0, len(files))
+	for u, f := range files {
+		if languageFor(f.languageId).pythonStrings {
+			uris = append(uris, u)
+		}
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+func rename(uri string, pos Position, newName string, files map[string]OpenFile) (*WorkspaceEdit, *jsonrpc2.Error) {
+	file, ok := files[uri]
+	if !ok {
+		return nil, rpcError(documentNotOpen(uri))
+	}
+	if !identifierRe.MatchString(newName) {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: newName + " is not a valid identifier"}
+	}
+	if pythonKeywords[newName] {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: newName + " is a keyword"}
+	}
+
+	word, start, _, inCode := wordAtPosition(file.content, pos.Line, pos.Character)
+	tokens := tokenize(file.content)
+	at := -1
+	for i, tok := range tokens {
+		if tok.kind == tokenIdentifier && tok.line == pos.Line && tok.start == start && tok.text == word {
+			at = i
+			break
+		}
+	}
+	if !inCode || at < 0 || pythonKeywords[word] {
+		return nil, renameFailed("nothing to rename here")
+	}
+
+	r := &renameEdits{newName, files, make(map[string]map[[2]int]TextEdit)}
+	root := analyzeScopes(file.content)
+
+	var target *scope
+	if !afterDot(tokens, at) {
+		target, ok = root.scopeAt(tokens[at].line, tokens[at].start).lookup(word)
+		if !ok {
+			return nil, renameFailed(word + " isn't defined anywhere in this file")
+		}
+	}
+	if target != nil {
+		if target.bindings[word][0].kind == bindImport {
+			return nil, renameFailed(word + " is imported, rename it where it's defined")
+		}
+		if _, taken := target.bindings[newName]; taken {
+			return nil, renameFailed(newName + " is already defined in the same scope")
+		}
+	}
+
+	switch {
+	case target == nil || target.kind == scopeClass:
+		r.attribute(word)
+	case target.kind == scopeModule:
+		r.local(uri, tokens, root, target, word)
+		r.importers(uri, word)
+	default:
+		r.local(uri, tokens, root, target, word)
+		if b := target.bindings[word]; target.kind == scopeFunction && b[0].kind == bindParam {
+			r.keywordArguments(target, word)
+		}
+	}
+	return r.workspaceEdit(), nil
+}
+
+// every token in the file that resolves to target
+func (r *renameEdits) local(uri string, tokens []token, root *scope, target *scope, name string) {
+	for i, tok := range tokens {
+		if tok.kind != tokenIdentifier || tok.text != name || afterDot(tokens, i) { continue }
+		if s, ok := root.scopeAt(tok.line, tok.start).lookup(name); ok && s == target {
+			r.add(uri, tok)
+		}
+	}
+}
+
+// a module level name in the other files: where they import it (`from mod import name`) or use it through
+// the module (`mod.name`). a file with a name of its own that happens to match is left alone
+func (r *renameEdits) importers(uri string, name string) {
+	module := strings.TrimSuffix(path.Base(uri), ".py")
+	for _, u := range pythonURIs(r.files) {
+		if u == uri { continue }
+		content := r.files[u].content
+		tokens := tokenize(content)
+		root := analyzeScopes(content)
+
+		imported := len(root.bindings[name]) > 0
+		for _, b := range root.bindings[name] {
+			imported = imported && b.kind == bindImport
+		}
+		origin := importedName(content, name)
+		if imported && (origin == module+"."+name || strings.HasSuffix(origin, "."+module+"."+name)) {
+			r.local(u, tokens, root, root, name)
+		}
+
+		for i, tok := range tokens {
+			if tok.kind != tokenIdentifier || tok.text != name || !afterDot(tokens, i) || i < 2 { continue }
+			receiver := tokens[i-2]
+			if receiver.kind != tokenIdentifier || afterDot(tokens, i-2) { continue }
+			if origin := importedName(content, receiver.text); origin == module || strings.HasSuffix(origin, "."+module) {
+				r.add(u, tok)
+			}
+		}
+	}
+}
+
+// methods, class attributes and anything else reached with a dot: every class body binding of the name plus
+// every `.name` in the workspace, there's no telling the receivers apart
+func (r *renameEdits) attribute(name string) {
+	for _, u := range pythonURIs(r.files) {
+		tokens := tokenize(r.files[u].content)
+		for i, tok := range tokens {
+			if tok.kind == tokenIdentifier && tok.text == name && afterDot(tokens, i) {
+				r.add(u, tok)
+			}
+		}
+
+		var walk func(s *scope)
+		walk = func(s *scope) {
+			if s.kind == scopeClass {
+				for _, b := range s.bindings[name] {
+					r.add(u, token{kind: tokenIdentifier, text: name, line: b.line, start: b.start, end: b.end})
+				}
+			}
+			for _, c := range s.children {
+				walk(c)
+			}
+		}
+		walk(analyzeScopes(r.files[u].content))
+	}
+}
+
+// `f(old=1)` at the call sites of the function whose parameter is being renamed. methods are called with a dot
+// in front, plain functions without. `partial(f, old=1)` (functools.partial and partialmethod too) fills in the
+// same keyword ahead of the call so it's renamed as well
+func (r *renameEdits) keywordArguments(fn *scope, param string) {
+	method := fn.parent != nil && fn.parent.kind == scopeClass
+	for _, u := range pythonURIs(r.files) {
+		tokens := tokenize(r.files[u].content)
+		for i := 0; i+1 < len(tokens); i++ {
+			if tokens[i].kind != tokenIdentifier || !isOp(tokens[i+1], "(") || i > 0 && isKeyword(tokens[i-1], "def") { continue }
+			switch {
+			case tokens[i].text == fn.name && afterDot(tokens, i) == method:
+				r.callKeywords(u, tokens, i+1, param)
+			case tokens[i].text == "partial" || tokens[i].text == "partialmethod":
+				if partialOf(tokens[i+2:], fn.name, method) {
+					r.callKeywords(u, tokens, i+1, param)
+				}
+			}
+		}
+	}
+}
+
+// the first argument of a partial(...) is the function itself: f, or for a method obj.m (or a bare m, the way
+// partialmethod is used in a class body)
+func partialOf(args []token, name string, method bool) bool {
+	end := indexTopLevel(args, func(t token) bool { return isOp(t, ",") || isOp(t, ")") })
+	if end < 1 { return false }
+	last := args[end-1]
+	if last.kind != tokenIdentifier || last.text != name { return false }
+	return end == 1 || method && afterDot(args, end-1)
+}
+
+// param= among the arguments of the call whose `(` is tokens[open]
+func (r *renameEdits) callKeywords(uri string, tokens []token, open int, param string) {
+	depth := 0
+	for j := open; j < len(tokens); j++ {
+		tok := tokens[j]
+		switch {
+		case isOp(tok, "(") || isOp(tok, "[") || isOp(tok, "{"):
+			depth++
+		case isOp(tok, ")") || isOp(tok, "]") || isOp(tok, "}"):
+			depth--
+		case depth == 1 && tok.kind == tokenIdentifier && tok.text == param && j+1 < len(tokens) && isOp(tokens[j+1], "=") &&
+			(isOp(tokens[j-1], "(") || isOp(tokens[j-1], ",")):
+			r.add(uri, tok)
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
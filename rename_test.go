@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+type renameCase struct {
+	Name      string `json:"name"`
+	Line      int    `json:"line"`
+	Character int    `json:"character"`
+	NewName   string `json:"newName"`
+}
+
+// testdata/rename/corpus.py renamed at each of cases.json, the edits compared with golden.json. go test -update
+// rewrites golden.json, check the diff by hand
+func TestRenameCorpus(t *testing.T) {
+	dir := filepath.Join("testdata", "rename")
+	content, err := os.ReadFile(filepath.Join(dir, "corpus.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []renameCase
+	raw, err := os.ReadFile(filepath.Join(dir, "cases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := "file:///corpus.py"
+	corpus := map[string]OpenFile{uri: pythonFile(uri, string(content))}
+	got := make(map[string]*WorkspaceEdit)
+	for _, c := range cases {
+		edit, rpcErr := rename(uri, Position{c.Line, c.Character}, c.NewName, corpus)
+		if rpcErr != nil {
+			t.Errorf("%s: %v", c.Name, rpcErr)
+			continue
+		}
+		got[c.Name] = edit
+	}
+
+	goldenPath := filepath.Join(dir, "golden.json")
+	if *updateGolden {
+		out, _ := json.MarshalIndent(got, "", "\t")
+		if err := os.WriteFile(goldenPath, append(out, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	raw, err = os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]*WorkspaceEdit
+	if err := json.Unmarshal(raw, &want); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		gotJSON, _ := json.Marshal(got[c.Name])
+		wantJSON, _ := json.Marshal(want[c.Name])
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s:\n got  %s\n want %s", c.Name, gotJSON, wantJSON)
+		}
+	}
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"strings"
+)
+
+// a small scope analyzer: good enough to know which names a function binds and where, not a python parser
+
+type scopeKind int
+
+const (
+	scopeModule scopeKind = iota
+	scopeClass
+	scopeFunction
+	scopeComprehension // list/set/dict comprehensions and generator expressions
+)
+
+type bindingKind int
+
+const (
+	bindAssign bindingKind = iota
+	bindParam
+	bindImport
+	bindDef
+	bindClass
+	bindLoop   // for targets
+	bindWith   // with ... as x
+	bindExcept // except E as e
+)
+
+type binding struct {
+	name  string
+	kind  bindingKind
+	line  int
+	start int
+	end   int
+}
+
+type param struct {
+	name       string
+	star       string // "", "*" or "**"
+	annotation string
+	value      string // the default, empty when there isn't one
+}
+
+type scope struct {
+	kind     scopeKind
+	name     string
+	parent   *scope
+	children []*scope
+
+	line      int // where the scope starts, just past the def/class name so parameters are inside
+	offset    int
+	endLine   int
+	endOffset int   // comprehensions only, they start and end in the middle of a line
+	iterable  *span // comprehensions only, the leftmost iterable is evaluated in the enclosing scope
+	indent    int // indentation of the def/class line
+	isAsync   bool
+
+	params    []param
+	returns   string // the def's return annotation
+	bindings  map[string][]binding
+	order     []string // binding names in the order they first appear
+	globals   map[string]bool
+	nonlocals map[string]bool
+}
+
+func newScope(kind scopeKind, name string, parent *scope) *scope {
+	s := &scope{kind: kind, name: name, parent: parent, bindings: make(map[string][]binding), indent: -1, globals: make(map[string]bool), nonlocals: make(map[string]bool)}
+	if parent != nil {
+		parent.children = append(parent.children, s)
+	}
+	return s
+}
+
+func (s *scope) bind(b binding) {
+	if _, ok := s.bindings[b.name]; !ok {
+		s.order = append(s.order, b.name)
+	}
+	s.bindings[b.name] = append(s.bindings[b.name], b)
+}
+
+type span struct {
+	line, start, endLine, end int
+}
+
+func (p span) contains(line, offset int) bool {
+	if line < p.line || line > p.endLine {
+		return false
+	}
+	if line == p.line && offset < p.start {
+		return false
+	}
+	return line < p.endLine || offset <= p.end
+}
+
+func (s *scope) contains(line, offset int) bool {
+	if s.kind == scopeModule {
+		return true
+	}
+	if s.kind == scopeComprehension {
+		return span{s.line, s.offset, s.endLine, s.endOffset}.contains(line, offset) && !(s.iterable != nil && s.iterable.contains(line, offset))
+	}
+	if line < s.line || line > s.endLine {
+		return false
+	}
+	return line > s.line || offset >= s.offset
+}
+
+// the innermost scope containing the position
+func (s *scope) scopeAt(line, offset int) *scope {
+	for _, c := range s.children {
+		if c.contains(line, offset) {
+			return c.scopeAt(line, offset)
+		}
+	}
+	return s
+}
+
+func (s *scope) enclosingFunction() *scope {
+	for cur := s; cur != nil; cur = cur.parent {
+		if cur.kind == scopeFunction {
+			return cur
+		}
+	}
+	return nil
+}
+
+func (s *scope) module() *scope {
+	cur := s
+	for cur.parent != nil {
+		cur = cur.parent
+	}
+	return cur
+}
+
+// where an assignment to name in s actually lands: `global` sends it to the module, `nonlocal` to the nearest
+// enclosing function that has it (or failing that the nearest enclosing function at all)
+func (s *scope) bindingScope(name string) *scope {
+	if s.globals[name] {
+		return s.module()
+	}
+	if s.nonlocals[name] {
+		var nearest *scope
+		for cur := s.parent; cur != nil; cur = cur.parent {
+			if cur.kind != scopeFunction { continue }
+			if _, ok := cur.bindings[name]; ok {
+				return cur
+			}
+			if nearest == nil {
+				nearest = cur
+			}
+		}
+		if nearest != nil {
+			return nearest
+		}
+	}
+	return s
+}
+
+// python's name resolution from this scope outwards, class bodies are only visible from the class itself
+func (s *scope) lookup(name string) (*scope, bool) {
+	if s.globals[name] || s.nonlocals[name] {
+		target := s.bindingScope(name)
+		if _, ok := target.bindings[name]; ok {
+			return target, true
+		}
+	}
+	for cur := s; cur != nil; cur = cur.parent {
+		if cur.kind == scopeClass && cur != s {
+			continue
+		}
+		if _, ok := cur.bindings[name]; ok {
+			return cur, true
+		}
+	}
+	return nil, false
+}
+
+// code tokens of one logical line (brackets and backslashes join physical lines)
+type logicalLine struct {
+	tokens []token
+	indent int
+	line   int
+	endLine int
+}
+
+func logicalLines(lines []string, tokens []token) []logicalLine {
+	result := make([]logicalLine, 0)
+	var cur *logicalLine
+	depth := 0
+
+	for _, tok := range tokens {
+		if tok.kind == tokenComment { continue }
+
+		continued := cur != nil && (depth > 0 || strings.HasSuffix(strings.TrimRight(lines[cur.endLine], " \t"), "\\"))
+		if cur == nil || tok.line > cur.endLine && !continued {
+			result = append(result, logicalLine{indent: indentOf(lines[tok.line]), line: tok.line, endLine: tok.endLine})
+			cur = &result[len(result)-1]
+			depth = 0
+		}
+
+		cur.tokens = append(cur.tokens, tok)
+		if tok.endLine > cur.endLine {
+			cur.endLine = tok.endLine
+		}
+		if tok.kind == tokenOperator {
+			switch tok.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth > 0 { depth-- }
+			}
+		}
+	}
+	return result
+}
+
+type scopeAnalyzer struct {
+	src        string
+	lines      []string
+	lineStarts []int
+	root       *scope
+}
+
+func analyzeScopes(content string) *scope {
+	lines := splitLines(content)
+	a := &scopeAnalyzer{src: content, lines: lines, lineStarts: make([]int, len(lines))}
+	offset := 0
+	for i := range lines {
+		a.lineStarts[i] = offset
+		offset = strings.IndexByte(content[offset:], '\n') + offset + 1
+	}
+
+	a.root = newScope(scopeModule, "", nil)
+	a.root.endLine = len(lines) - 1
+
+	stack := []*scope{a.root}
+	lastLine := 0
+	for _, ll := range logicalLines(lines, tokenize(content)) {
+		for len(stack) > 1 && ll.indent <= stack[len(stack)-1].indent {
+			stack[len(stack)-1].endLine = a.blockEnd(lastLine, stack[len(stack)-1].indent)
+			stack = stack[:len(stack)-1]
+		}
+		if opened := a.statement(stack[len(stack)-1], ll.tokens, ll.indent); opened != nil {
+			stack = append(stack, opened)
+		}
+		lastLine = ll.endLine
+	}
+	for len(stack) > 1 {
+		stack[len(stack)-1].endLine = a.blockEnd(lastLine, stack[len(stack)-1].indent)
+		stack = stack[:len(stack)-1]
+	}
+	return a.root
+}
+
+// the last line of a block whose last statement ends on last: blank lines after it still belong to it while
+// they're indented past the header, that's where the cursor sits when a new line is started in the body
+func (a *scopeAnalyzer) blockEnd(last int, indent int) int {
+	for last+1 < len(a.lines) && isBlankLine(a.lines[last+1]) && indentOf(a.lines[last+1]) > indent {
+		last++
+	}
+	return last
+}
+
+// source text covered by the tokens from..to inclusive
+func (a *scopeAnalyzer) text(from, to token) string {
+	start := a.lineStarts[from.line] + from.start
+	end := a.lineStarts[to.endLine] + to.end
+	if end < start {
+		return ""
+	}
+	return strings.TrimSpace(a.src[start:end])
+}
+
+func isOp(tok token, text string) bool {
+	return tok.kind == tokenOperator && tok.text == text
+}
+
+func isKeyword(tok token, text string) bool {
+	return tok.kind == tokenIdentifier && tok.text == text
+}
+
+// splits tokens on the given operator where it isn't nested in brackets
+func splitTopLevel(tokens []token, sep string) [][]token {
+	parts := make([][]token, 0)
+	depth := 0
+	last := 0
+	for i, tok := range tokens {
+		if tok.kind == tokenOperator {
+			switch tok.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth > 0 { depth-- }
+			}
+		}
+		if depth == 0 && (tok.kind == tokenOperator && tok.text == sep || tok.kind == tokenIdentifier && tok.text == sep) {
+			parts = append(parts, tokens[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, tokens[last:])
+}
+
+func indexTopLevel(tokens []token, match func(token) bool) int {
+	depth := 0
+	for i, tok := range tokens {
+		if depth == 0 && match(tok) {
+			return i
+		}
+		if tok.kind == tokenOperator {
+			switch tok.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth > 0 { depth-- }
+			}
+		}
+	}
+	return -1
+}
+
+var compoundKeywords = map[string]bool{"if": true, "elif": true, "else": true, "for": true, "while": true, "with": true, "try": true, "except": true, "finally": true, "def": true, "class": true, "async": true}
+
+// binds whatever the statement binds in s, and returns the new scope when it's a def or class header
+func (a *scopeAnalyzer) statement(s *scope, tokens []token, indent int) *scope {
+	var opened *scope
+	for _, stmt := range splitTopLevel(tokens, ";") {
+		if len(stmt) == 0 { continue }
+
+		if !(stmt[0].kind == tokenIdentifier && compoundKeywords[stmt[0].text]) {
+			a.comprehensions(s, stmt)
+			a.walrusTargets(s, stmt)
+			a.simpleStatement(s, stmt)
+			continue
+		}
+
+		colon := indexTopLevel(stmt, func(t token) bool { return isOp(t, ":") })
+		header := stmt
+		var body []token
+		if colon >= 0 {
+			header = stmt[:colon]
+			body = stmt[colon+1:]
+		}
+
+		a.comprehensions(s, header)
+		a.walrusTargets(s, header)
+		target := s
+		if inner := a.header(s, header, indent); inner != nil {
+			opened = inner
+			target = inner
+		}
+		if len(body) > 0 {
+			a.statement(target, body, indent+1)
+		}
+	}
+	return opened
+}
+
+func (a *scopeAnalyzer) header(s *scope, header []token, indent int) *scope {
+	isAsync := false
+	if isKeyword(header[0], "async") && len(header) > 1 {
+		header = header[1:]
+		isAsync = true
+	}
+
+	switch header[0].text {
+	case "def", "class":
+		if len(header) < 2 || header[1].kind != tokenIdentifier {
+			return nil
+		}
+		name := header[1]
+		kind, inner := bindDef, scopeFunction
+		if header[0].text == "class" {
+			kind, inner = bindClass, scopeClass
+		}
+		s.bindingScope(name.text).bind(binding{name.text, kind, name.line, name.start, name.end})
+
+		child := newScope(inner, name.text, s)
+		child.indent = indent
+		child.isAsync = isAsync
+		child.line, child.offset = name.line, name.end
+		child.endLine = name.line
+		if inner == scopeFunction && len(header) > 2 && isOp(header[2], "(") {
+			a.parameters(child, header[3:])
+		}
+		if arrow := indexTopLevel(header, func(t token) bool { return isOp(t, "->") }); arrow >= 0 && arrow+1 < len(header) {
+			child.returns = a.text(header[arrow+1], header[len(header)-1])
+		}
+		return child
+
+	case "for":
+		in := indexTopLevel(header, func(t token) bool { return isKeyword(t, "in") })
+		if in > 1 {
+			a.bindTargets(s, header[1:in], bindLoop)
+		}
+
+	case "with":
+		for _, item := range splitTopLevel(header[1:], ",") {
+			if as := indexTopLevel(item, func(t token) bool { return isKeyword(t, "as") }); as >= 0 {
+				a.bindTargets(s, item[as+1:], bindWith)
+			}
+		}
+
+	case "except":
+		if as := indexTopLevel(header, func(t token) bool { return isKeyword(t, "as") }); as >= 0 {
+			a.bindTargets(s, header[as+1:], bindExcept)
+		}
+	}
+	return nil
+}
+
+// opens a scope for every bracketed comprehension in tokens. the for targets are bound inside it, the leftmost
+// iterable is left to s since that's where python evaluates it
+func (a *scopeAnalyzer) comprehensions(s *scope, tokens []token) {
+	for i := 0; i < len(tokens); i++ {
+		if !(isOp(tokens[i], "(") || isOp(tokens[i], "[") || isOp(tokens[i], "{")) { continue }
+
+		j := i + 1 + indexTopLevel(tokens[i+1:], func(t token) bool { return isOp(t, ")") || isOp(t, "]") || isOp(t, "}") })
+		if j == i {
+			j = len(tokens) // unclosed, the comprehension runs to the end of what we have
+		}
+		open, inner := tokens[i], tokens[i+1:j]
+		i = j
+
+		first := indexTopLevel(inner, func(t token) bool { return isKeyword(t, "for") })
+		if first < 0 {
+			a.comprehensions(s, inner)
+			continue
+		}
+
+		comp := newScope(scopeComprehension, "", s)
+		comp.indent = s.indent
+		comp.line, comp.offset = open.line, open.end
+		if j < len(tokens) {
+			comp.endLine, comp.endOffset = tokens[j].line, tokens[j].start
+		}else{
+			last := tokens[len(tokens)-1]
+			comp.endLine, comp.endOffset = last.endLine, last.end
+		}
+
+		iterStart, iterEnd := len(inner), len(inner)
+		for k := first; k < len(inner); {
+			in := indexTopLevel(inner[k:], func(t token) bool { return isKeyword(t, "in") })
+			if in < 0 { break }
+			in += k
+			a.bindTargets(comp, inner[k+1:in], bindLoop)
+
+			next := indexTopLevel(inner[in+1:], func(t token) bool { return isKeyword(t, "for") })
+			if k == first {
+				iterStart, iterEnd = in+1, len(inner)
+				if clause := indexTopLevel(inner[in+1:], func(t token) bool { return isKeyword(t, "for") || isKeyword(t, "if") || isKeyword(t, "async") }); clause >= 0 {
+					iterEnd = in + 1 + clause
+				}
+			}
+			if next < 0 { break }
+			k = in + 1 + next
+		}
+		if iterStart < iterEnd {
+			from, to := inner[iterStart], inner[iterEnd-1]
+			comp.iterable = &span{from.line, from.start, to.endLine, to.end}
+		}
+
+		a.comprehensions(comp, inner[:iterStart])
+		a.comprehensions(s, inner[iterStart:iterEnd])
+		a.comprehensions(comp, inner[iterEnd:])
+	}
+}
+
+// tokens start just past the opening paren of the def
+func (a *scopeAnalyzer) parameters(fn *scope, tokens []token) {
+	closing := indexTopLevel(tokens, func(t token) bool { return isOp(t, ")") })
+	if closing >= 0 {
+		tokens = tokens[:closing]
+	}
+
+	for _, part := range splitTopLevel(tokens, ",") {
+		if len(part) == 0 { continue }
+		p := param{}
+		if isOp(part[0], "*") || isOp(part[0], "**") {
+			p.star = part[0].text
+			part = part[1:]
+		}
+		if len(part) == 0 || part[0].kind != tokenIdentifier { continue } // a bare `*` or `/`
+
+		name := part[0]
+		p.name = name.text
+		rest := part[1:]
+		if eq := indexTopLevel(rest, func(t token) bool { return isOp(t, "=") }); eq >= 0 {
+			if eq+1 < len(rest) {
+				p.value = a.text(rest[eq+1], rest[len(rest)-1])
+			}
+			rest = rest[:eq]
+		}
+		if len(rest) > 1 && isOp(rest[0], ":") {
+			p.annotation = a.text(rest[1], rest[len(rest)-1])
+		}
+
+		fn.params = append(fn.params, p)
+		fn.bind(binding{name.text, bindParam, name.line, name.start, name.end})
+	}
+}
+
+func (a *scopeAnalyzer) simpleStatement(s *scope, stmt []token) {
+	first := stmt[0]
+	switch {
+	case isKeyword(first, "global") || isKeyword(first, "nonlocal"):
+		if s.kind == scopeModule { return } // a no-op at module level
+		for _, tok := range stmt[1:] {
+			if tok.kind != tokenIdentifier { continue }
+			if first.text == "global" {
+				s.globals[tok.text] = true
+			}else{
+				s.nonlocals[tok.text] = true
+			}
+		}
+		return
+
+	case isKeyword(first, "import"):
+		for _, item := range splitTopLevel(stmt[1:], ",") {
+			a.bindImported(s, item, true)
+		}
+		return
+
+	case isKeyword(first, "from"):
+		imp := indexTopLevel(stmt, func(t token) bool { return isKeyword(t, "import") })
+		if imp < 0 { return }
+		names := make([]token, 0)
+		for _, tok := range stmt[imp+1:] {
+			if !isOp(tok, "(") && !isOp(tok, ")") {
+				names = append(names, tok)
+			}
+		}
+		for _, item := range splitTopLevel(names, ",") {
+			a.bindImported(s, item, false)
+		}
+		return
+	}
+
+	// a = b = value, x: int = value, total += 1
+	if i := indexTopLevel(stmt, func(t token) bool { return t.kind == tokenOperator && isAssignOperator(t.text) }); i > 0 {
+		target := stmt[:i]
+		if colon := indexTopLevel(target, func(t token) bool { return isOp(t, ":") }); colon >= 0 {
+			target = target[:colon]
+		}
+		a.bindTargets(s, target, bindAssign)
+
+		if stmt[i].text == "=" {
+			rest := stmt[i+1:]
+			for {
+				j := indexTopLevel(rest, func(t token) bool { return isOp(t, "=") })
+				if j < 0 { break }
+				a.bindTargets(s, rest[:j], bindAssign)
+				rest = rest[j+1:]
+			}
+		}
+		return
+	}
+
+	// a bare annotation, `x: int`
+	if colon := indexTopLevel(stmt, func(t token) bool { return isOp(t, ":") }); colon == 1 && first.kind == tokenIdentifier {
+		a.bindTargets(s, stmt[:1], bindAssign)
+	}
+}
+
+func isAssignOperator(op string) bool {
+	switch op {
+	case "=", "+=", "-=", "*=", "/=", "//=", "%=", "**=", ">>=", "<<=", "&=", "|=", "^=", "@=":
+		return true
+	}
+	return false
+}
+
+// `import a.b` binds a, `import a.b as c` and `from m import x as c` bind c
+func (a *scopeAnalyzer) bindImported(s *scope, item []token, plainImport bool) {
+	if len(item) == 0 { return }
+	if as := indexTopLevel(item, func(t token) bool { return isKeyword(t, "as") }); as >= 0 && as+1 < len(item) {
+		name := item[as+1]
+		s.bindingScope(name.text).bind(binding{name.text, bindImport, name.line, name.start, name.end})
+		return
+	}
+	name := item[0]
+	if name.kind != tokenIdentifier { return } // `from m import *`
+	if !plainImport && len(item) > 1 { return }
+	s.bindingScope(name.text).bind(binding{name.text, bindImport, name.line, name.start, name.end})
+}
+
+// binds plain names, including ones nested in tuple/list targets and starred ones: `a, *rest = ...` and
+// `for i, (x, y) in ...`. attribute and subscript targets bind nothing
+func (a *scopeAnalyzer) bindTargets(s *scope, target []token, kind bindingKind) {
+	for _, part := range splitTopLevel(target, ",") {
+		if len(part) > 1 && isOp(part[0], "*") {
+			part = part[1:]
+		}
+		if len(part) > 1 && (isOp(part[0], "(") || isOp(part[0], "[")) {
+			if closing := indexTopLevel(part[1:], func(t token) bool { return isOp(t, ")") || isOp(t, "]") }); closing == len(part)-2 {
+				a.bindTargets(s, part[1:len(part)-1], kind)
+			}
+			continue
+		}
+		if len(part) == 1 && part[0].kind == tokenIdentifier && !pythonKeywords[part[0].text] {
+			s.bindingScope(part[0].text).bind(binding{part[0].text, kind, part[0].line, part[0].start, part[0].end})
+		}
+	}
+}
+
+// `(n := len(data))` binds n in the statement's scope, comprehensions included, that's where python puts it
+func (a *scopeAnalyzer) walrusTargets(s *scope, tokens []token) {
+	for i := 1; i < len(tokens); i++ {
+		name := tokens[i-1]
+		if !isOp(tokens[i], ":=") || name.kind != tokenIdentifier || pythonKeywords[name.text] { continue }
+		if i > 1 && isOp(tokens[i-2], ".") { continue }
+		s.bindingScope(name.text).bind(binding{name.text, bindAssign, name.line, name.start, name.end})
+	}
+}
+
+// the first binding of name anywhere in the tree, by position
+func firstBinding(root *scope, name string) (binding, bool) {
+	var first binding
+	found := false
+	var walk func(s *scope)
+	walk = func(s *scope) {
+		for _, b := range s.bindings[name] {
+			if !found || b.line < first.line || b.line == first.line && b.start < first.start {
+				first, found = b, true
+			}
+		}
+		for _, c := range s.children {
+			walk(c)
+		}
+	}
+	walk(root)
+	return first, found
+}
+
+// `(a, *args, b: int = 1) -> str`
+func (s *scope) signature() string {
+	parts := make([]string, 0, len(s.params))
+	for _, p := range s.params {
+		part := p.star + p.name
+		if p.annotation != "" {
+			part += ": " + p.annotation
+		}
+		if p.value != "" {
+			if p.annotation != "" {
+				part += " = " + p.value
+			}else{
+				part += "=" + p.value
+			}
+		}
+		parts = append(parts, part)
+	}
+	sig := "(" + strings.Join(parts, ", ") + ")"
+	if s.returns != "" {
+		sig += " -> " + s.returns
+	}
+	return sig
+}
+
+// names with a definition site: defs and classes anywhere plus the module level assignments
+func definedNames(root *scope) map[string]bool {
+	names := make(map[string]bool)
+	var walk func(s *scope)
+	walk = func(s *scope) {
+		for name, bindings := range s.bindings {
+			for _, b := range bindings {
+				if b.kind == bindDef || b.kind == bindClass || s.kind == scopeModule && b.kind == bindAssign {
+					names[name] = true
+				}
+			}
+		}
+		for _, c := range s.children {
+			walk(c)
+		}
+	}
+	walk(root)
+	return names
+}
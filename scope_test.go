@@ -0,0 +1,242 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// the scope of the def or class called name, depth first
+func findScope(root *scope, name string) *scope {
+	if root.name == name && root.kind != scopeModule {
+		return root
+	}
+	for _, c := range root.children {
+		if found := findScope(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func bindingLines(s *scope, name string) []int {
+	lines := make([]int, 0)
+	for _, b := range s.bindings[name] {
+		lines = append(lines, b.line)
+	}
+	return lines
+}
+
+func undefinedIn(content string) []string {
+	file := pythonFile("file:///scopes.py", content)
+	names := make([]string, 0)
+	for _, d := range undefinedNames(file, splitLines(content)) {
+		names = append(names, d.Message)
+	}
+	return names
+}
+
+func TestNonlocalInNestedClosures(t *testing.T) {
+	content := `def outer():
+    count = 0
+    def inner():
+        nonlocal count
+        count += 1
+        def deepest():
+            nonlocal count
+            count = 2
+        return count
+    return inner
+`
+	root := analyzeScopes(content)
+	outer, inner, deepest := findScope(root, "outer"), findScope(root, "inner"), findScope(root, "deepest")
+	if outer == nil || inner == nil || deepest == nil {
+		t.Fatal("missing function scopes")
+	}
+	if got := inner.bindingScope("count"); got != outer {
+		t.Errorf("inner's count lands in %q, want outer", got.name)
+	}
+	if got := deepest.bindingScope("count"); got != outer {
+		t.Errorf("deepest's count lands in %q, want outer", got.name)
+	}
+	if got := bindingLines(outer, "count"); !reflect.DeepEqual(got, []int{1, 4, 7}) {
+		t.Errorf("outer binds count on lines %v, want 1, 4 and 7", got)
+	}
+	if len(inner.bindings["count"]) != 0 || len(deepest.bindings["count"]) != 0 {
+		t.Error("a nonlocal name was bound in the inner function itself")
+	}
+	if got := undefinedIn(content); len(got) != 0 {
+		t.Errorf("undefined names %v", got)
+	}
+}
+
+// assignments after `global` in a method are module level names, usable from anywhere after
+func TestGlobalInsideMethod(t *testing.T) {
+	content := `class Counter:
+    def add(self, n):
+        global total, registry
+        total = n
+        registry = {}
+
+def report():
+    return total, registry
+`
+	root := analyzeScopes(content)
+	add := findScope(root, "add")
+	if add == nil {
+		t.Fatal("no scope for add")
+	}
+	for _, name := range []string{"total", "registry"} {
+		if got := add.bindingScope(name); got != root {
+			t.Errorf("%s lands in %q, want the module", name, got.name)
+		}
+		if len(root.bindings[name]) != 1 {
+			t.Errorf("module bindings of %s: %v", name, root.bindings[name])
+		}
+		if scope, ok := findScope(root, "report").lookup(name); !ok || scope != root {
+			t.Errorf("report doesn't find %s at module level", name)
+		}
+	}
+	defined := make([]string, 0)
+	for name := range definedNames(root) {
+		defined = append(defined, name)
+	}
+	sort.Strings(defined)
+	if want := []string{"Counter", "add", "registry", "report", "total"}; !reflect.DeepEqual(defined, want) {
+		t.Errorf("definedNames = %v, want %v", defined, want)
+	}
+	if got := undefinedIn(content); len(got) != 0 {
+		t.Errorf("undefined names %v", got)
+	}
+}
+
+// a SyntaxError in python, here it just mustn't take the server down
+func TestGlobalThatIsAlsoAParameter(t *testing.T) {
+	for _, content := range []string{
+		"def f(x):\n    global x\n    x = 1\n",
+		"def f(x):\n    def g():\n        nonlocal x, y\n        y = x\n",
+		"global top\nnonlocal nothing\ntop = 1\n",
+		"def f():\n    global\n    nonlocal\n",
+	} {
+		analyzeScopes(content)
+		undefinedIn(content)
+		pythonFile("file:///scopes.py", content)
+	}
+}
+
+func TestDictComprehensionWithTupleTargets(t *testing.T) {
+	content := "pairs = [(1, 2)]\nlookup = {k: v for k, v in pairs if v}\nprint(k)\n"
+	root := analyzeScopes(content)
+	for _, name := range []string{"k", "v"} {
+		if _, ok := root.bindings[name]; ok {
+			t.Errorf("%s leaked into the module scope", name)
+		}
+	}
+	comp := root.scopeAt(1, 11) // on the first k
+	if comp.kind != scopeComprehension {
+		t.Fatalf("scope at the key expression is %v, want the comprehension", comp.kind)
+	}
+	if got := comp.order; !reflect.DeepEqual(got, []string{"k", "v"}) {
+		t.Errorf("comprehension binds %v, want k and v", got)
+	}
+	if got := root.scopeAt(1, 31); got != root { // in pairs
+		t.Errorf("the leftmost iterable is in the %v scope, want the module", got.kind)
+	}
+	if got := undefinedIn(content); len(got) != 1 || got[0] != "k is not defined" {
+		t.Errorf("undefined names %v, want only the k after the comprehension", got)
+	}
+}
+
+// the leftmost iterable is evaluated outside, later ones and the conditions inside
+func TestComprehensionIterableScope(t *testing.T) {
+	root := analyzeScopes("flat = [cell for row in rows for cell in row if cell]\n")
+	if got := root.scopeAt(0, 25); got != root { // in rows
+		t.Errorf("the leftmost iterable is in the %v scope, want the module", got.kind)
+	}
+	for _, at := range []int{42, 49} { // in row, in the condition's cell
+		if got := root.scopeAt(0, at); got.kind != scopeComprehension {
+			t.Errorf("at %d the scope is %v, want the comprehension", at, got.kind)
+		}
+	}
+
+	if got := undefinedIn("rows = [[1]]\nflat = [cell for row in rows for cell in row if cell]\n"); len(got) != 0 {
+		t.Errorf("undefined names %v in a nested for", got)
+	}
+	if got := undefinedIn("squares = [n * n for n in n]\n"); len(got) != 1 {
+		t.Errorf("undefined names %v, want the n the comprehension iterates over", got)
+	}
+	if got := undefinedIn("total = sum(x for x in range(3))\nseen = {y for y in [x]}\n"); len(got) != 1 {
+		t.Errorf("undefined names %v, want the x outside the generator", got)
+	}
+}
+
+type bindingSite struct {
+	name             string
+	kind             bindingKind
+	line, start, end int
+}
+
+func bindingSites(s *scope) []bindingSite {
+	sites := make([]bindingSite, 0)
+	for _, name := range s.order {
+		for _, b := range s.bindings[name] {
+			sites = append(sites, bindingSite{b.name, b.kind, b.line, b.start, b.end})
+		}
+	}
+	return sites
+}
+
+func TestUnpackingTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []bindingSite
+	}{
+		{"tuple", "a, b = pair", []bindingSite{{"a", bindAssign, 0, 0, 1}, {"b", bindAssign, 0, 3, 4}}},
+		{"starred", "head, *rest = items", []bindingSite{{"head", bindAssign, 0, 0, 4}, {"rest", bindAssign, 0, 7, 11}}},
+		{"nested in for", "for i, (x, y) in points:\n    pass", []bindingSite{{"i", bindLoop, 0, 4, 5}, {"x", bindLoop, 0, 8, 9}, {"y", bindLoop, 0, 11, 12}}},
+		{"starred in for", "for first, *others in rows:\n    pass", []bindingSite{{"first", bindLoop, 0, 4, 9}, {"others", bindLoop, 0, 12, 18}}},
+		{"deeply nested", "[(a, [b, *c])] = data", []bindingSite{{"a", bindAssign, 0, 2, 3}, {"b", bindAssign, 0, 6, 7}, {"c", bindAssign, 0, 10, 11}}},
+		{"walrus", "if (n := len(data)) > 10:\n    pass", []bindingSite{{"n", bindAssign, 0, 4, 5}}},
+		{"chained", "x = y = 0", []bindingSite{{"x", bindAssign, 0, 0, 1}, {"y", bindAssign, 0, 4, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bindingSites(analyzeScopes(tt.content)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bindings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// go to definition on a name only unpacking or a walrus binds lands on that binding
+func TestDefinitionOfUnpackedNames(t *testing.T) {
+	content := "head, *rest = load()\nif (count := len(rest)) > 1:\n    print(head, rest, count)\n"
+	files := map[string]OpenFile{"file:///u.py": pythonFile("file:///u.py", content)}
+	for name, want := range map[string]Position{"rest": {0, 7}, "count": {1, 4}, "head": {0, 0}} {
+		got := definitionLocations("file:///u.py", name, files)
+		if len(got) != 1 || got[0].Range.Start != want {
+			t.Errorf("definition of %s = %v, want %v", name, got, want)
+		}
+	}
+	if got := undefinedIn(content); len(got) != 1 || got[0] != "load is not defined" {
+		t.Errorf("undefined names %v, want only load", got)
+	}
+}
+
+// an indented blank line after the last statement is still in the body, an unindented one isn't
+func TestBlankLineAfterTheBody(t *testing.T) {
+	content := "class Reader:\n    def read(self):\n        pass\n        \n    \n\nx = 1\n"
+	root := analyzeScopes(content)
+	tests := []struct {
+		line int
+		want string
+	}{
+		{3, "read"}, {4, "Reader"}, {5, ""},
+	}
+	for _, tt := range tests {
+		if got := root.scopeAt(tt.line, 0).name; got != tt.want {
+			t.Errorf("line %d is in %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true, "await": true,
+	"break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true, "else": true, "except": true,
+	"finally": true, "for": true, "from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true, "return": true, "try": true,
+	"while": true, "with": true, "yield": true,
+}
+
+// indices into semanticTokenTypes, the order is the legend sent in initialize
+const (
+	semanticKeyword = iota
+	semanticFunction
+	semanticVariable
+	semanticString
+	semanticComment
+	semanticNumber
+)
+
+var semanticTokenTypes = []string{"keyword", "function", "variable", "string", "comment", "number"}
+
+type SemanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+func semanticType(tok token) (int, bool) {
+	switch tok.kind {
+	case tokenIdentifier:
+		if pythonKeywords[tok.text] {
+			return semanticKeyword, true
+		}
+		if defaultCompletions[tok.text] != 0 {
+			return semanticFunction, true
+		}
+		return semanticVariable, true
+	case tokenString:
+		return semanticString, true
+	case tokenComment:
+		return semanticComment, true
+	case tokenNumber:
+		return semanticNumber, true
+	}
+	return 0, false
+}
+
+// the LSP relative encoding, five integers per token: line delta, start delta (relative to the previous token when
+// on the same line), length, type and modifiers. tokens spanning lines (triple quoted strings) are split per line
+// since we don't assume the client handles multiline tokens
+func encodeSemanticTokens(content string, lang languageConfig) []int {
+	lines := splitLines(content)
+	data := make([]int, 0)
+	prevLine, prevStart := 0, 0
+
+	push := func(line, start, end, typ int) {
+		if line >= len(lines) || end <= start { return }
+		startChar := lineCharacter(lines[line], start)
+		length := lineCharacter(lines[line], end) - startChar
+		if length <= 0 { return }
+
+		deltaStart := startChar
+		if line == prevLine {
+			deltaStart = startChar - prevStart
+		}
+		data = append(data, line-prevLine, deltaStart, length, typ, 0)
+		prevLine, prevStart = line, startChar
+	}
+
+	for _, tok := range tokenizeLanguage(content, lang) {
+		typ, ok := semanticType(tok)
+		if !ok { continue }
+
+		if tok.line == tok.endLine {
+			push(tok.line, tok.start, tok.end, typ)
+			continue
+		}
+		push(tok.line, tok.start, len(lines[tok.line]), typ)
+		for l := tok.line + 1; l < tok.endLine; l++ {
+			push(l, 0, len(lines[l]), typ)
+		}
+		push(tok.endLine, 0, tok.end, typ)
+	}
+	return data
+}
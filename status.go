@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// pypls/serverStatus is sent every statusInterval seconds and on the pypls.getStatus command, for editor
+// plugins that show the server's health in a status bar
+
+type ServerStatus struct {
+	Documents     int    `json:"documents"`
+	WordsIndexed  int    `json:"wordsIndexed"` // distinct words per document, summed over the open documents
+	HeapAlloc     uint64 `json:"heapAlloc"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	Version       string `json:"version"`
+}
+
+// set by the client's initialized notification, nothing is sent unasked before that
+var clientReady atomic.Bool
+
+func serverVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+func currentStatus() ServerStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	open := snapshotFiles()
+	words := 0
+	for _, f := range open {
+		words += f.words.len()
+	}
+	return ServerStatus{len(open), words, mem.HeapAlloc, int64(time.Since(startTime).Seconds()), serverVersion()}
+}
+
+func sendStatus(ctx context.Context, conn *jsonrpc2.Conn) ServerStatus {
+	status := currentStatus()
+	conn.Notify(ctx, "pypls/serverStatus", status)
+	return status
+}
+
+// runs for the life of the connection. it wakes every second and reads the setting each time, so a changed
+// interval applies straight away
+func statusReporter(ctx context.Context, conn *jsonrpc2.Conn) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		interval := time.Duration(getOptions().StatusInterval) * time.Second
+		if interval <= 0 || !clientReady.Load() || time.Since(last) < interval {
+			continue
+		}
+		sendStatus(ctx, conn)
+		last = time.Now()
+	}
+}
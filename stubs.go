@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// .pyi stubs are plain python with `...` bodies, so they go through the same scope analyzer as open documents.
+// files are only found up front, each one is parsed the first time a completion or hover asks for its module
+
+type stubMember struct {
+	name   string
+	kind   int    // CompletionItemKind
+	detail string // the signature for defs, `class Name` for classes
+	origin string // the .pyi it came from
+}
+
+type stubModule struct {
+	members []stubMember
+	classes map[string][]stubMember
+}
+
+var stubRootDir string
+var stubPaths = map[string]string{}       // module name to its .pyi
+var stubModules = map[string]*stubModule{} // the ones parsed so far
+var stubsMu sync.Mutex
+
+// the stubsPath setting, or failing that the usual places stubs end up in a workspace
+func findStubRoot(opts Options) string {
+	if opts.StubsPath != "" {
+		return workspacePath(opts.StubsPath)
+	}
+	root := getWorkspaceRoot()
+	if root == "" {
+		return ""
+	}
+	for _, dir := range []string{"typings", filepath.Join("typeshed", "stdlib"), "typeshed"} {
+		if info, err := os.Stat(filepath.Join(root, dir)); err == nil && info.IsDir() {
+			return filepath.Join(root, dir)
+		}
+	}
+	return ""
+}
+
+func loadStubs(ctx context.Context, conn *jsonrpc2.Conn) {
+	root := findStubRoot(getOptions())
+	paths := make(map[string]string)
+
+	if root != "" {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(p, ".pyi") {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			module := strings.TrimSuffix(filepath.ToSlash(rel), ".pyi")
+			module = strings.TrimSuffix(strings.TrimSuffix(module, "__init__"), "/")
+			if module != "" {
+				paths[strings.ReplaceAll(module, "/", ".")] = p
+			}
+			return nil
+		})
+		if err != nil {
+			warn(ctx, conn, "could not read stubs from " + root + ": " + err.Error())
+		}else{
+			log(ctx, conn, "indexed " + strconv.Itoa(len(paths)) + " stub modules from " + root)
+		}
+	}
+
+	stubsMu.Lock()
+	stubRootDir = root
+	stubPaths = paths
+	stubModules = make(map[string]*stubModule)
+	stubsMu.Unlock()
+	invalidateCompletions()
+}
+
+func getStubModule(name string) (*stubModule, bool) {
+	stubsMu.Lock()
+	defer stubsMu.Unlock()
+	if mod, ok := stubModules[name]; ok {
+		return mod, true
+	}
+	path, ok := stubPaths[name]
+	if !ok {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	origin, _ := filepath.Rel(stubRootDir, path)
+	mod := parseStub(string(content), filepath.ToSlash(origin))
+
+	// submodules with a stub of their own are members too, os.path for os
+	for _, sub := range childModules(stubPaths, name) {
+		mod.members = append(mod.members, stubMember{sub, 9, "module " + name + "." + sub, origin})
+	}
+
+	stubModules[name] = mod
+	return mod, true
+}
+
+func parseStub(content string, origin string) *stubModule {
+	root := analyzeScopes(content)
+	mod := &stubModule{members: scopeMembers(root, origin), classes: make(map[string][]stubMember)}
+	for _, c := range root.children {
+		if c.kind == scopeClass {
+			if _, seen := mod.classes[c.name]; !seen {
+				mod.classes[c.name] = scopeMembers(c, origin)
+			}
+		}
+	}
+	return mod
+}
+
+// the public names a module or class scope binds, first definition wins (overloads repeat the def)
+func scopeMembers(s *scope, origin string) []stubMember {
+	children := make(map[string]*scope)
+	for _, c := range s.children {
+		if _, seen := children[c.name]; !seen {
+			children[c.name] = c
+		}
+	}
+
+	members := make([]stubMember, 0, len(s.order))
+	for _, name := range s.order {
+		if strings.HasPrefix(name, "_") && !(strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")) { continue }
+		b := s.bindings[name][0]
+		switch b.kind {
+		case bindDef:
+			kind := 3
+			if s.kind == scopeClass {
+				kind = 2
+			}
+			detail := "def " + name
+			if fn := children[name]; fn != nil {
+				detail += fn.signature()
+			}
+			members = append(members, stubMember{name, kind, detail, origin})
+		case bindClass:
+			members = append(members, stubMember{name, 7, "class " + name, origin})
+		case bindAssign:
+			kind := 6
+			if s.kind == scopeClass {
+				kind = 5
+			}
+			members = append(members, stubMember{name, kind, "", origin})
+		}
+	}
+	return members
+}
+
+func stubChildren(parent string) []string {
+	stubsMu.Lock()
+	defer stubsMu.Unlock()
+	return childModules(stubPaths, parent)
+}
+
+// members of a stub module, or of a class when the dotted name ends in one (`collections.OrderedDict`)
+func stubMembers(dotted string) []stubMember {
+	if mod, ok := getStubModule(dotted); ok {
+		return mod.members
+	}
+	if i := strings.LastIndex(dotted, "."); i > 0 {
+		if mod, ok := getStubModule(dotted[:i]); ok {
+			return mod.classes[dotted[i+1:]]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LSP SymbolKind values
+const (
+	symbolClass    = 5
+	symbolMethod   = 6
+	symbolField    = 8
+	symbolFunction = 12
+	symbolVariable = 13
+	symbolConstant = 14
+)
+
+type SymbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
+// workspace/symbol params, query is the standard field and the rest are pypls extensions (see the README)
+type SymbolQuery struct {
+	Query         string `json:"query"`
+	SymbolKind    int    `json:"symbolKind"`    // only symbols of this kind, 0 for all of them
+	UseRegex      bool   `json:"useRegex"`      // query is a regular expression matched anywhere in the name
+	CaseSensitive bool   `json:"caseSensitive"`
+}
+
+// turns the query into a name matcher, an invalid regex comes back as an error rather than a panic
+func (q SymbolQuery) matcher() (match func(string) bool, err error) {
+	if q.UseRegex {
+		pattern := q.Query
+		if !q.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				match, err = nil, fmt.Errorf("%v", r)
+			}
+		}()
+		re := regexp.MustCompile(pattern)
+		return re.MatchString, nil
+	}
+
+	if q.CaseSensitive {
+		return func(name string) bool { return strings.Contains(name, q.Query) }, nil
+	}
+	query := strings.ToLower(q.Query)
+	return func(name string) bool { return strings.Contains(strings.ToLower(name), query) }, nil
+}
+
+// textDocument/documentSymbol for clients with hierarchicalDocumentSymbolSupport
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`          // the whole def or class, body included
+	SelectionRange Range            `json:"selectionRange"` // just the name
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+// assignment details longer than this are cut
+const symbolDetailLength = 40
+
+// defs and classes anywhere plus assignments at module and class level, nested under the def or class they're in
+func documentSymbolTree(file OpenFile) []DocumentSymbol {
+	lines := splitLines(file.content)
+
+	var walk func(s *scope) []DocumentSymbol
+	walk = func(s *scope) []DocumentSymbol {
+		symbols := make([]DocumentSymbol, 0)
+		for _, name := range s.order {
+			for _, b := range s.bindings[name] {
+				selection := rangeOnLine(lines, b.line, b.start, b.end)
+				sym := DocumentSymbol{Name: name, Range: selection, SelectionRange: selection}
+
+				switch {
+				case b.kind == bindClass || b.kind == bindDef:
+					sym.Kind = symbolFunction
+					if b.kind == bindClass {
+						sym.Kind = symbolClass
+					}else if s.kind == scopeClass {
+						sym.Kind = symbolMethod
+					}
+					for _, c := range s.children {
+						if c.name != name || c.line != b.line { continue }
+						if c.kind == scopeClass {
+							if cls, ok := parseClassHeader(lines, b.line); ok && len(cls.bases) > 0 {
+								sym.Detail = "(" + strings.Join(cls.bases, ", ") + ")"
+							}
+						}else{
+							sym.Detail = c.signature()
+							if c.isAsync {
+								sym.Detail = "async " + sym.Detail
+							}
+						}
+						end := blockEnd(lines, b.line, c.indent)
+						sym.Range = Range{Position{b.line, lineCharacter(lines[b.line], indentOf(lines[b.line]))}, Position{end, lineCharacter(lines[end], len(lines[end]))}}
+						sym.Children = walk(c)
+						break
+					}
+				case b.kind == bindAssign && (s.kind == scopeModule || s.kind == scopeClass):
+					sym.Kind = symbolVariable
+					if s.kind == scopeClass {
+						sym.Kind = symbolField
+					}else if isConstantName(name) {
+						sym.Kind = symbolConstant
+					}
+					sym.Detail = assignedValue(lines[b.line][b.end:])
+				}
+				if sym.Kind == 0 { continue }
+				symbols = append(symbols, sym)
+				if b.kind == bindAssign {
+					break // reassignments are the same symbol
+				}
+			}
+		}
+		return symbols
+	}
+	return walk(analyzeScopes(file.content))
+}
+
+// the older flat form, each symbol with the def or class it's in as container
+func documentSymbols(uri string, file OpenFile) []SymbolInformation {
+	symbols := make([]SymbolInformation, 0)
+	var flatten func(tree []DocumentSymbol, container string)
+	flatten = func(tree []DocumentSymbol, container string) {
+		for _, sym := range tree {
+			symbols = append(symbols, SymbolInformation{sym.Name, sym.Kind, Location{uri, sym.SelectionRange}, container})
+			flatten(sym.Children, sym.Name)
+		}
+	}
+	flatten(documentSymbolTree(file), "")
+	return symbols
+}
+
+// ALL_CAPS, with at least one letter
+func isConstantName(name string) bool {
+	return strings.ToUpper(name) == name && strings.ToLower(name) != name
+}
+
+// the right hand side after a binding's name, `= value` or `: type = value`, cut to symbolDetailLength
+func assignedValue(rest string) string {
+	i := strings.Index(rest, "=")
+	if i < 0 {
+		return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ":")) // a bare annotation
+	}
+	value := strings.TrimSpace(trailingCommentRe.ReplaceAllString(rest[i+1:], ""))
+	if runes := []rune(value); len(runes) > symbolDetailLength {
+		value = string(runes[:symbolDetailLength-1]) + "…"
+	}
+	return value
+}
+
+// the last line of the block whose header starts on line at the given indentation. a header spread over several
+// lines (long parameter lists) is skipped as a whole first
+func blockEnd(lines []string, line int, indent int) int {
+	i, depth := line, 0
+	for ; i < len(lines); i++ {
+		for _, c := range lines[i] {
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			}
+		}
+		if depth <= 0 {
+			break
+		}
+	}
+
+	end := min(i, len(lines)-1)
+	for i++; i < len(lines); i++ {
+		if isBlankLine(lines[i]) { continue }
+		if indentOf(lines[i]) <= indent { break }
+		end = i
+	}
+	return end
+}
+
+func workspaceSymbols(q SymbolQuery, files map[string]OpenFile) ([]SymbolInformation, error) {
+	match, err := q.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	uris := make([]string, 0, len(files))
+	for uri := range files {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	result := make([]SymbolInformation, 0)
+	for _, uri := range uris {
+		if !languageFor(files[uri].languageId).pythonStrings { continue }
+		for _, sym := range documentSymbols(uri, files[uri]) {
+			if q.SymbolKind != 0 && sym.Kind != q.SymbolKind { continue }
+			if match(sym.Name) {
+				result = append(result, sym)
+			}
+		}
+	}
+	return result, nil
+}
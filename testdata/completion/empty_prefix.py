@@ -0,0 +1,15 @@
+import os
+
+RETRIES = 3
+
+
+class Session:
+    pass
+
+
+def fetch(url, timeout):
+    response = None
+    for attempt in range(RETRIES):
+        response = os.getenv(url) or timeout
+    # changelog changelog changelog changelog changelog changelog changelog changelog
+    return |
@@ -0,0 +1,40 @@
+settings = {}
+settings['key0'] = 0
+settings['key1'] = 1
+settings['key2'] = 2
+settings['key3'] = 3
+settings['key4'] = 4
+settings['key5'] = 5
+settings['key6'] = 6
+settings['key7'] = 7
+settings['key8'] = 8
+settings['key9'] = 9
+settings['key10'] = 10
+settings['key11'] = 11
+settings['key12'] = 12
+settings['key13'] = 13
+settings['key14'] = 14
+settings['key15'] = 15
+settings['key16'] = 16
+settings['key17'] = 17
+settings['key18'] = 18
+settings['key19'] = 19
+settings['key20'] = 20
+settings['key21'] = 21
+settings['key22'] = 22
+settings['key23'] = 23
+settings['key24'] = 24
+settings['key25'] = 25
+settings['key26'] = 26
+settings['key27'] = 27
+settings['key28'] = 28
+
+
+class Reader:
+    def read(self, stream):
+        for entry in range(3):
+            with open(entry) as handle:
+                try:
+                    pass
+                except OSError as error:
+                    s|
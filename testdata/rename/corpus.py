@@ -0,0 +1,37 @@
+import functools
+from functools import partial
+
+
+def retry(times):
+    def wrap(fn):
+        return fn
+    return wrap
+
+
+@retry(times=3)
+def fetch(url, timeout=10):
+    print(f"fetching {url} within {timeout}s", "timeout is plain text")
+    return url, timeout
+
+
+def handler(request):
+    return request
+
+
+fetch("a", timeout=5)
+fetch(url="b", timeout=1)
+quick = partial(fetch, timeout=2)
+slow = functools.partial(fetch, "c", timeout=60)
+routes = [handler, retry(times=1)(handler)]
+message = f"{handler.__name__} handles requests"
+label = "handler"
+
+
+class Client:
+    def get(self, path, retries=0):
+        return f"{path}:{retries}"
+
+    again = functools.partialmethod(get, retries=1)
+
+
+Client().get("/", retries=2)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TODO, FIXME, HACK and XXX comments, picked out of the comment tokens the attribute pass already has. served by
+// pypls/todos for task lists and, with diagnostics.todos on, published as hints
+
+var todoTags = []string{"TODO", "FIXME", "HACK", "XXX"}
+
+type Todo struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+	Tag   string `json:"tag"`
+	Text  string `json:"text"` // what follows the tag, without the `:` or `-` after it
+}
+
+// the tag only counts as the first word of the comment and in capitals, `# today` and `# a hack` are prose
+func todoComment(tok token, lang languageConfig) (tag string, text string, ok bool) {
+	body := tok.text
+	for _, marker := range []string{lang.lineComment, lang.blockComment[0]} {
+		if marker != "" && strings.HasPrefix(body, marker) {
+			body = body[len(marker):]
+			break
+		}
+	}
+	if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+		body = body[:newline]
+	}
+	if lang.blockComment[1] != "" {
+		body = strings.TrimSuffix(strings.TrimRight(body, " \t\r"), lang.blockComment[1])
+	}
+	body = strings.TrimLeft(body, " \t#*/-")
+
+	for _, tag := range todoTags {
+		if !strings.HasPrefix(body, tag) { continue }
+		rest := body[len(tag):]
+		if r, _ := utf8.DecodeRuneInString(rest); rest != "" && isWordChar(r) {
+			return "", "", false // TODOS, XXXL, FIXME2
+		}
+		return tag, strings.TrimSpace(strings.TrimLeft(rest, ":- \t")), true
+	}
+	return "", "", false
+}
+
+// one Todo per tagged comment token, its range from the tag to the end of the comment's first line
+func todosFrom(uri string, lang languageConfig, lines []string, comments []token) []Todo {
+	todos := make([]Todo, 0, len(comments))
+	for _, tok := range comments {
+		tag, text, ok := todoComment(tok, lang)
+		if !ok { continue }
+		line := lines[tok.line]
+		start := tok.start + strings.Index(line[tok.start:], tag)
+		end := tok.end
+		if tok.endLine != tok.line {
+			end = len(line)
+		}
+		todos = append(todos, Todo{uri, rangeOnLine(lines, tok.line, start, end), tag, text})
+	}
+	return todos
+}
+
+func todoDiagnostics(todos []Todo) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(todos))
+	for _, todo := range todos {
+		message := todo.Tag
+		if todo.Text != "" {
+			message += ": " + todo.Text
+		}
+		diagnostics = append(diagnostics, Diagnostic{Range: todo.Range, Severity: severityHint, Code: todo.Tag, Source: "pypls", Message: message})
+	}
+	return diagnostics
+}
+
+// every open document's, then those of the files pypls.lintWorkspace last went through that aren't open, sorted
+// by document and position
+func allTodos(open map[string]OpenFile) []Todo {
+	todos := make([]Todo, 0)
+	for _, file := range open {
+		todos = append(todos, file.todos...)
+	}
+	lintCacheMu.Lock()
+	for path, result := range lintCache {
+		if _, isOpen := open[pathToURI(path)]; !isOpen {
+			todos = append(todos, result.todos...)
+		}
+	}
+	lintCacheMu.Unlock()
+
+	sort.Slice(todos, func(i, j int) bool {
+		a, b := todos[i], todos[j]
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return a.Range.Start.Line < b.Range.Start.Line
+		}
+		return a.Range.Start.Character < b.Range.Start.Character
+	})
+	return todos
+}
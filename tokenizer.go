@@ -0,0 +1,420 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenNumber
+	tokenString // a whole plain string literal, or one literal piece of an f-string
+	tokenComment
+	tokenOperator
+)
+
+// positions are zero based lines and byte offsets into those lines, strings can span lines so they carry an end line
+type token struct {
+	kind         tokenKind
+	text         string
+	line         int
+	start        int
+	endLine      int
+	end          int
+	unterminated bool // a string running into the end of its line (or the file) without a closing quote
+}
+
+// what the tokenizer needs to know to tell code from comments and strings, picked by the document's languageId
+type languageConfig struct {
+	lineComment      string
+	blockComment     [2]string // open and close, empty when the language has no block comments
+	stringDelimiters []string  // only used when pythonStrings is off
+	pythonStrings    bool      // prefixes, triple quotes and f-strings
+}
+
+var pythonLanguage = languageConfig{lineComment: "#", pythonStrings: true}
+
+var cStyleLanguage = languageConfig{lineComment: "//", blockComment: [2]string{"/*", "*/"}, stringDelimiters: []string{`"`, `'`, "`"}}
+
+var languageConfigs = map[string]languageConfig{
+	"python":      pythonLanguage,
+	"javascript":  cStyleLanguage,
+	"typescript":  cStyleLanguage,
+	"go":          cStyleLanguage,
+	"c":           cStyleLanguage,
+	"cpp":         cStyleLanguage,
+	"java":        cStyleLanguage,
+	"csharp":      cStyleLanguage,
+	"rust":        cStyleLanguage,
+	"lua":         {lineComment: "--", blockComment: [2]string{"--[[", "]]"}, stringDelimiters: []string{`"`, `'`}},
+	"sql":         {lineComment: "--", blockComment: [2]string{"/*", "*/"}, stringDelimiters: []string{`'`, `"`}},
+	"shellscript": {lineComment: "#", stringDelimiters: []string{`"`, `'`}},
+	"ruby":        {lineComment: "#", blockComment: [2]string{"=begin", "=end"}, stringDelimiters: []string{`"`, `'`}},
+}
+
+// python unless we know better, it's what this server is for
+func languageFor(languageId string) languageConfig {
+	if lang, ok := languageConfigs[languageId]; ok {
+		return lang
+	}
+	return pythonLanguage
+}
+
+var multiCharOperators = []string{"**=", "//=", ">>=", "<<=", "...", ":=", "==", "!=", "<=", ">=", "->", "**", "//", "<<", ">>", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@="}
+
+type tokenizer struct {
+	lang      languageConfig
+	src       string
+	pos       int
+	line      int
+	lineStart int
+	tokens    []token
+
+	open       []token    // brackets not closed yet, innermost last
+	mismatched [][2]token // a closer and the opener it was meant for, a zero opener when there wasn't one
+	openString *token     // the opening quotes of a triple quoted string the file ends inside of
+}
+
+func tokenize(content string) []token {
+	return tokenizeLanguage(content, pythonLanguage)
+}
+
+func tokenizeLanguage(content string, lang languageConfig) []token {
+	t := &tokenizer{lang: lang, src: content, tokens: make([]token, 0, len(content)/4)}
+	t.scanCode("")
+	return t.tokens
+}
+
+// brackets that are still open or closed by the wrong kind, and the triple quoted string left open at the end
+func bracketErrors(content string, lang languageConfig) (unclosed []token, mismatched [][2]token, openString *token) {
+	t := &tokenizer{lang: lang, src: content, tokens: make([]token, 0, len(content)/4)}
+	t.scanCode("")
+	return t.open, t.mismatched, t.openString
+}
+
+var closingBracket = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+func (t *tokenizer) emit(kind tokenKind, from, fromLine, fromLineStart int) {
+	t.tokens = append(t.tokens, token{
+		kind:    kind,
+		text:    t.src[from:t.pos],
+		line:    fromLine,
+		start:   from - fromLineStart,
+		endLine: t.line,
+		end:     t.pos - t.lineStart,
+	})
+	if kind != tokenOperator { return }
+
+	tok := t.tokens[len(t.tokens)-1]
+	switch tok.text {
+	case "(", "[", "{":
+		t.open = append(t.open, tok)
+	case ")", "]", "}":
+		if len(t.open) == 0 {
+			t.mismatched = append(t.mismatched, [2]token{tok, {}})
+			return
+		}
+		opener := t.open[len(t.open)-1]
+		t.open = t.open[:len(t.open)-1] // closed either way, one wrong bracket shouldn't flag everything after it
+		if closingBracket[opener.text] != tok.text {
+			t.mismatched = append(t.mismatched, [2]token{tok, opener})
+		}
+	}
+}
+
+func (t *tokenizer) advance() {
+	if t.src[t.pos] == '\n' {
+		t.line++
+		t.lineStart = t.pos + 1
+	}
+	t.pos++
+}
+
+// scans code until the end of the input. inside an f-string replacement field (quote is the enclosing string's
+// quote) it stops without consuming at the `}`, `!` or `:` that ends the expression and reports which one it was,
+// 0 means end of input. a field of a single quoted f-string also ends at a newline so a half typed one doesn't
+// swallow the rest of the file
+func (t *tokenizer) scanCode(quote string) byte {
+	inField := quote != ""
+	depth := 0
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		from, fromLine, fromLineStart := t.pos, t.line, t.lineStart
+
+		switch {
+		case c == '\n' && len(quote) == 1 && depth == 0:
+			return c
+
+		case c == '\n' || c == ' ' || c == '\t' || c == '\r' || c == '\\' || c == '\f':
+			t.advance()
+
+		case !inField && t.lang.blockComment[0] != "" && strings.HasPrefix(t.src[t.pos:], t.lang.blockComment[0]):
+			t.pos += len(t.lang.blockComment[0])
+			for t.pos < len(t.src) && !strings.HasPrefix(t.src[t.pos:], t.lang.blockComment[1]) {
+				t.advance()
+			}
+			t.pos = min(t.pos+len(t.lang.blockComment[1]), len(t.src))
+			t.emit(tokenComment, from, fromLine, fromLineStart)
+
+		case !inField && t.lang.lineComment != "" && strings.HasPrefix(t.src[t.pos:], t.lang.lineComment):
+			for t.pos < len(t.src) && t.src[t.pos] != '\n' {
+				t.pos++
+			}
+			t.emit(tokenComment, from, fromLine, fromLineStart)
+
+		case !t.lang.pythonStrings && t.delimiterAt() != "":
+			t.scanDelimitedString(t.delimiterAt())
+
+		case t.lang.pythonStrings && (c == '"' || c == '\''):
+			t.scanString("")
+
+		case isIdentStart(t.src[t.pos:]):
+			for t.pos < len(t.src) {
+				r, size := utf8.DecodeRuneInString(t.src[t.pos:])
+				if !isWordChar(r) { break }
+				t.pos += size
+			}
+			word := t.src[from:t.pos]
+			if t.lang.pythonStrings && t.pos < len(t.src) && (t.src[t.pos] == '"' || t.src[t.pos] == '\'') && isStringPrefix(word) {
+				t.pos = from
+				t.scanString(word)
+				break
+			}
+			t.emit(tokenIdentifier, from, fromLine, fromLineStart)
+
+		case c >= '0' && c <= '9' || c == '.' && t.pos+1 < len(t.src) && t.src[t.pos+1] >= '0' && t.src[t.pos+1] <= '9':
+			for t.pos < len(t.src) {
+				n := t.src[t.pos]
+				if n == '.' || n == '_' || n >= '0' && n <= '9' || n >= 'a' && n <= 'z' || n >= 'A' && n <= 'Z' {
+					t.pos++
+				}else if (n == '+' || n == '-') && (t.src[t.pos-1] == 'e' || t.src[t.pos-1] == 'E') && !strings.HasPrefix(strings.ToLower(t.src[from:t.pos]), "0x") {
+					t.pos++
+				}else{
+					break
+				}
+			}
+			t.emit(tokenNumber, from, fromLine, fromLineStart)
+
+		default:
+			if inField && depth == 0 {
+				if c == '}' || c == ':' && !strings.HasPrefix(t.src[t.pos:], ":=") || c == '!' && !strings.HasPrefix(t.src[t.pos:], "!=") {
+					return c
+				}
+			}
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 { depth-- }
+			}
+
+			op := string(c)
+			for _, m := range multiCharOperators {
+				if strings.HasPrefix(t.src[t.pos:], m) {
+					op = m
+					break
+				}
+			}
+			if _, size := utf8.DecodeRuneInString(t.src[t.pos:]); len(op) < size {
+				op = t.src[t.pos : t.pos+size]
+			}
+			t.pos += len(op)
+			t.emit(tokenOperator, from, fromLine, fromLineStart)
+		}
+	}
+	return 0
+}
+
+func (t *tokenizer) delimiterAt() string {
+	for _, d := range t.lang.stringDelimiters {
+		if strings.HasPrefix(t.src[t.pos:], d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// strings of the non-python languages, backslash escapes and only backticks may span lines
+func (t *tokenizer) scanDelimitedString(delim string) {
+	from, fromLine, fromLineStart := t.pos, t.line, t.lineStart
+	t.pos += len(delim)
+	for t.pos < len(t.src) {
+		switch {
+		case strings.HasPrefix(t.src[t.pos:], delim):
+			t.pos += len(delim)
+			t.emit(tokenString, from, fromLine, fromLineStart)
+			return
+		case t.src[t.pos] == '\\' && t.pos+1 < len(t.src):
+			t.advance()
+			t.advance()
+		case t.src[t.pos] == '\n' && delim != "`":
+			t.emit(tokenString, from, fromLine, fromLineStart)
+			t.tokens[len(t.tokens)-1].unterminated = true
+			return
+		default:
+			t.advance()
+		}
+	}
+	t.emit(tokenString, from, fromLine, fromLineStart)
+	t.tokens[len(t.tokens)-1].unterminated = true
+}
+
+// content with every comment blanked out (newlines kept so positions still line up)
+func stripComments(content string, lang languageConfig) string {
+	tokens := tokenizeLanguage(content, lang)
+	var b strings.Builder
+	last := 0
+	lineStart := 0
+	line := 0
+	offsetOf := func(l, off int) int {
+		for line < l {
+			next := strings.IndexByte(content[lineStart:], '\n')
+			if next < 0 { break }
+			lineStart += next + 1
+			line++
+		}
+		return lineStart + off
+	}
+	for _, tok := range tokens {
+		if tok.kind != tokenComment { continue }
+		start := offsetOf(tok.line, tok.start)
+		end := offsetOf(tok.endLine, tok.end)
+		b.WriteString(content[last:start])
+		for _, c := range content[start:end] {
+			if c == '\n' {
+				b.WriteRune(c)
+			}else{
+				b.WriteByte(' ')
+			}
+		}
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return isWordChar(r) && !(r >= '0' && r <= '9')
+}
+
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "r", "u", "b", "f", "br", "rb", "fr", "rf", "t", "tr", "rt":
+		return true
+	}
+	return false
+}
+
+// t.pos is at the prefix (or the opening quote when there isn't one)
+func (t *tokenizer) scanString(prefix string) {
+	from, fromLine, fromLineStart := t.pos, t.line, t.lineStart
+	start, startLine, startLineStart := from, fromLine, fromLineStart
+	t.pos += len(prefix)
+
+	quote := t.src[t.pos : t.pos+1]
+	if strings.HasPrefix(t.src[t.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	t.pos += len(quote)
+
+	lower := strings.ToLower(prefix)
+	formatted := strings.ContainsAny(lower, "ft")
+
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		switch {
+		case strings.HasPrefix(t.src[t.pos:], quote):
+			t.pos += len(quote)
+			t.emit(tokenString, from, fromLine, fromLineStart)
+			return
+
+		case c == '\n' && len(quote) == 1: // unterminated, don't let it swallow the rest of the file
+			t.emit(tokenString, from, fromLine, fromLineStart)
+			t.tokens[len(t.tokens)-1].unterminated = true
+			return
+
+		case c == '\\' && t.pos+1 < len(t.src):
+			t.advance()
+			t.advance()
+
+		case formatted && (strings.HasPrefix(t.src[t.pos:], "{{") || strings.HasPrefix(t.src[t.pos:], "}}")):
+			t.pos += 2
+
+		case formatted && c == '{':
+			t.pos++
+			t.emit(tokenString, from, fromLine, fromLineStart)
+			t.scanField(quote)
+			from, fromLine, fromLineStart = t.pos, t.line, t.lineStart
+
+		default:
+			t.advance()
+		}
+	}
+	t.emit(tokenString, from, fromLine, fromLineStart)
+	t.tokens[len(t.tokens)-1].unterminated = true
+	if len(quote) == 3 { // an outer string returns after the ones in its fields, so it's the one kept
+		opening := t.src[start : start+len(prefix)+3]
+		t.openString = &token{kind: tokenString, text: opening, line: startLine, start: start - startLineStart, endLine: startLine, end: start - startLineStart + len(opening)}
+	}
+}
+
+// one replacement field of an f-string, t.pos is just past the opening brace
+func (t *tokenizer) scanField(quote string) {
+	end := t.scanCode(quote)
+
+	if end == '!' { // conversion, !r !s !a
+		t.pos++
+		for t.pos < len(t.src) && t.src[t.pos] != ':' && t.src[t.pos] != '}' && t.src[t.pos] != '\n' && !strings.HasPrefix(t.src[t.pos:], quote) {
+			t.advance()
+		}
+		if t.pos < len(t.src) {
+			end = t.src[t.pos]
+		}
+	}
+
+	if end == ':' { // the format spec is string content but may itself contain replacement fields, `{x:{width}}`
+		from, fromLine, fromLineStart := t.pos, t.line, t.lineStart
+		for t.pos < len(t.src) && t.src[t.pos] != '}' && !strings.HasPrefix(t.src[t.pos:], quote) {
+			if t.src[t.pos] == '\n' && len(quote) == 1 {
+				break
+			}
+			if t.src[t.pos] == '{' {
+				t.pos++
+				t.emit(tokenString, from, fromLine, fromLineStart)
+				t.scanField(quote)
+				from, fromLine, fromLineStart = t.pos, t.line, t.lineStart
+				continue
+			}
+			t.advance()
+		}
+		if t.pos > from {
+			t.emit(tokenString, from, fromLine, fromLineStart)
+		}
+	}
+
+	if t.pos < len(t.src) && t.src[t.pos] == '}' {
+		t.pos++
+	}
+}
+
+// true when the position isn't inside a string literal piece or a comment, expressions in f-strings count as code
+func inCodeContext(tokens []token, line, offset int) bool {
+	for _, tok := range tokens {
+		if tok.line > line { break }
+		if tok.kind != tokenString && tok.kind != tokenComment { continue }
+		if tok.endLine < line { continue }
+
+		afterStart := tok.line < line || offset > tok.start
+		beforeEnd := tok.endLine > line || offset < tok.end
+		if tok.kind == tokenComment || tok.unterminated {
+			beforeEnd = tok.endLine > line || offset <= tok.end
+		}
+		if afterStart && beforeEnd {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// the identifiers of content with their line and column, what the index and completion see as code
+func identifiers(content string) []string {
+	names := make([]string, 0)
+	for _, tok := range tokenize(content) {
+		if tok.kind == tokenIdentifier {
+			names = append(names, fmt.Sprintf("%s@%d:%d", tok.text, tok.line, tok.start))
+		}
+	}
+	return names
+}
+
+func TestTokenizeFStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"plain string", `s = "total {count}"`, []string{"s@0:0"}},
+		{"field", `s = f"total: {count * unit_price}"`, []string{"s@0:0", "count@0:14", "unit_price@0:22"}},
+		{"escaped braces", `s = f"{{literal}} {value}"`, []string{"s@0:0", "value@0:19"}},
+		{"nested f-string", `s = f"a {f'{inner}' + outer} b"`, []string{"s@0:0", "inner@0:12", "outer@0:22"}},
+		{"same quotes nested", `s = f"{row["key"]} {n:>{width}}"`, []string{"s@0:0", "row@0:7", "n@0:20", "width@0:24"}},
+		{"conversion and spec", `s = f"{value!r:>10} {other:%Y-%m}"`, []string{"s@0:0", "value@0:7", "other@0:21"}},
+		{"multi-line", "s = f\"\"\"first {one}\n  second {two:>{pad}}\nlast\"\"\"\nafter = 1", []string{"s@0:0", "one@0:15", "two@1:10", "pad@1:16", "after@3:0"}},
+		{"field across lines", "s = f'''{\n    a +\n    b}'''", []string{"s@0:0", "a@1:4", "b@2:4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifiers(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("identifiers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInCodeContextInFStrings(t *testing.T) {
+	content := "s = f\"\"\"total {count}\nmore {price:>{width}} text\"\"\""
+	tokens := tokenize(content)
+	tests := []struct {
+		line, offset int
+		code         bool
+	}{
+		{0, 10, false}, // in "total"
+		{0, 16, true},  // in count
+		{1, 2, false},  // in "more"
+		{1, 8, true},   // in price
+		{1, 13, false}, // in the format spec
+		{1, 17, true},  // in width
+		{1, 24, false}, // in "text"
+	}
+	for _, tt := range tests {
+		if got := inCodeContext(tokens, tt.line, tt.offset); got != tt.code {
+			t.Errorf("inCodeContext(%d:%d) = %v, want %v", tt.line, tt.offset, got, tt.code)
+		}
+	}
+}
+
+func tokensOfKind(tokens []token, kind tokenKind) []string {
+	texts := make([]string, 0)
+	for _, tok := range tokens {
+		if tok.kind == kind {
+			texts = append(texts, tok.text)
+		}
+	}
+	return texts
+}
+
+// comments and strings of languages that don't use `#`, picked by languageId
+func TestTokenizeOtherLanguages(t *testing.T) {
+	tests := []struct {
+		languageId string
+		content    string
+		comments   []string
+		strings    []string
+	}{
+		{"javascript", "let x = 1 // note # not\n/* block\n still */ let y = \"a // b\" # z", []string{"// note # not", "/* block\n still */"}, []string{`"a // b"`}},
+		{"go", "s := `raw // text`\n// done", []string{"// done"}, []string{"`raw // text`"}},
+		{"lua", "local s = '--not' -- comment\n--[[ long\ncomment ]] x = 1", []string{"-- comment", "--[[ long\ncomment ]]"}, []string{"'--not'"}},
+		{"sql", "select '#id' -- pick\nfrom t /* all */", []string{"-- pick", "/* all */"}, []string{"'#id'"}},
+		{"ruby", "x = \"#{y}\" # interpolated\n=begin\ndoc\n=end", []string{"# interpolated", "=begin\ndoc\n=end"}, []string{`"#{y}"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.languageId, func(t *testing.T) {
+			tokens := tokenizeLanguage(tt.content, languageFor(tt.languageId))
+			if got := tokensOfKind(tokens, tokenComment); !reflect.DeepEqual(got, tt.comments) {
+				t.Errorf("comments = %q, want %q", got, tt.comments)
+			}
+			if got := tokensOfKind(tokens, tokenString); !reflect.DeepEqual(got, tt.strings) {
+				t.Errorf("strings = %q, want %q", got, tt.strings)
+			}
+		})
+	}
+}
+
+// comments go, everything else including the line structure stays where it was
+func TestStripCommentsOtherLanguage(t *testing.T) {
+	content := "const url = \"http://host\"; // endpoint\n/* retries\n */ retry(3)"
+	want := "const url = \"http://host\";            \n          \n    retry(3)"
+	if got := stripComments(content, languageFor("typescript")); got != want {
+		t.Errorf("stripComments = %q, want %q", got, want)
+	}
+	if got := stripComments("x = 1 // 2\n", languageFor("python")); got != "x = 1 // 2\n" {
+		t.Errorf("python has no // comments, got %q", got)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// stdout that reports its first failed write. once the editor is gone every reply and notification would fail
+// the same way, so the server is better off shutting down than writing into a dead pipe
+type transportWriter struct {
+	w      io.Writer
+	once   sync.Once
+	onFail func(error)
+}
+
+func (t *transportWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		t.once.Do(func() { t.onFail(err) })
+	}
+	return n, err
+}
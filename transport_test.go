@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTransportWriterReportsOnce(t *testing.T) {
+	r, w := io.Pipe()
+	r.Close()
+	var failures []error
+	writer := &transportWriter{w: w, onFail: func(err error) { failures = append(failures, err) }}
+	for i := 0; i < 3; i++ {
+		if _, err := writer.Write([]byte("x")); err == nil {
+			t.Fatal("write into a closed pipe succeeded")
+		}
+	}
+	if len(failures) != 1 || !errors.Is(failures[0], io.ErrClosedPipe) {
+		t.Errorf("onFail got %v, want one ErrClosedPipe", failures)
+	}
+}
+
+// the editor closing its end of stdout: the next reply fails and serve returns, even with stdin still open
+func TestClosedPipeEndsTheServer(t *testing.T) {
+	resetServerState()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	defer inW.Close() // lets the read loop still blocked on stdin finish
+	done := make(chan struct{})
+	go func() {
+		serve(inR, outW)
+		close(done)
+	}()
+
+	outR.Close()
+	body := `{"jsonrpc":"2.0","id":1,"method":"pypls/ping"}`
+	if _, err := fmt.Fprintf(inW, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve still running after its output pipe closed")
+	}
+}
+
+func TestClosedInputEndsTheServer(t *testing.T) {
+	resetServerState()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	defer outR.Close()
+	done := make(chan struct{})
+	go func() {
+		serve(inR, outW)
+		close(done)
+	}()
+
+	inW.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve still running after its input closed")
+	}
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// a literal-and-constructor-only guess at what a value is, no flow analysis. empty when it can't tell
+
+var numberLiteralRe = regexp.MustCompile(`^[-+]?(?:0[xob][0-9a-f_]+|[0-9][0-9_]*(\.[0-9_]*)?(e[-+]?[0-9]+)?|\.[0-9][0-9_]*(e[-+]?[0-9]+)?)(j)?$`)
+var stringLiteralRe = regexp.MustCompile(`^([rbfu]{0,2})("|')`)
+var trailingCommentRe = regexp.MustCompile(`\s+#.*$`)
+var identifierRe = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+var constructorCallRe = regexp.MustCompile(`^([\w.]+)\s*\(`)
+
+// builtins whose call returns an instance of a type worth naming
+var builtinConstructors = map[string]string{
+	"int": "int", "float": "float", "complex": "complex", "str": "str", "bytes": "bytes", "bytearray": "bytearray",
+	"bool": "bool", "list": "list", "dict": "dict", "set": "set", "frozenset": "frozenset", "tuple": "tuple",
+	"open": "TextIOWrapper", "range": "range", "object": "object",
+}
+
+// stdlib classes by their full dotted name, imports undone before looking up `Path(...)` or `pathlib.Path(...)`.
+// alternate constructors (`datetime.now()`) count too
+var stdlibConstructors = map[string]string{
+	"pathlib.Path": "Path", "pathlib.PosixPath": "Path", "pathlib.WindowsPath": "Path",
+	"collections.Counter": "Counter", "collections.defaultdict": "defaultdict", "collections.OrderedDict": "OrderedDict",
+	"collections.deque": "deque",
+	"datetime.datetime": "datetime", "datetime.datetime.now": "datetime", "datetime.datetime.today": "datetime",
+	"datetime.datetime.utcnow": "datetime", "datetime.datetime.fromtimestamp": "datetime",
+	"datetime.datetime.fromisoformat": "datetime", "datetime.datetime.strptime": "datetime",
+	"datetime.timedelta": "timedelta",
+	"logging.getLogger": "Logger", "logging.Logger": "Logger",
+	"argparse.ArgumentParser": "ArgumentParser",
+	"flask.Flask": "Flask",
+	"sqlalchemy.orm.Session": "Session",
+}
+
+func inferType(rhs string, content string) string {
+	rhs = strings.TrimSpace(rhs)
+	if rhs == "" {
+		return ""
+	}
+	if !stringLiteralRe.MatchString(strings.ToLower(rhs)) {
+		rhs = trailingCommentRe.ReplaceAllString(rhs, "")
+	}
+	switch rhs {
+	case "True", "False":
+		return "bool"
+	case "None":
+		return "None"
+	}
+
+	lower := strings.ToLower(rhs)
+	if m := numberLiteralRe.FindStringSubmatch(lower); m != nil {
+		switch {
+		case m[4] != "":
+			return "complex"
+		case m[1] != "" || m[2] != "" || m[3] != "" || strings.HasPrefix(lower, "."):
+			return "float"
+		}
+		return "int"
+	}
+	if m := stringLiteralRe.FindStringSubmatch(lower); m != nil {
+		if strings.Contains(m[1], "b") {
+			return "bytes"
+		}
+		return "str"
+	}
+
+	switch rhs[0] {
+	case '[':
+		return "list"
+	case '{':
+		inner := strings.TrimSpace(rhs[1:])
+		if inner == "}" || hasTopLevelColon(inner) {
+			return "dict"
+		}
+		return "set"
+	case '(':
+		inner := strings.TrimSpace(rhs[1:])
+		if inner == ")" || strings.Contains(rhs, ",") {
+			return "tuple"
+		}
+		return inferType(strings.TrimSuffix(inner, ")"), content) // just parentheses
+	}
+
+	if m := constructorCallRe.FindStringSubmatch(rhs); m != nil {
+		if t, ok := builtinConstructors[m[1]]; ok {
+			return t
+		}
+		if t, ok := stdlibConstructors[resolveDotted(content, strings.Split(m[1], "."))]; ok {
+			return t
+		}
+		if _, ok := findClass(splitLines(content), m[1]); ok {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// whether there's a `:` outside any nested brackets and strings, `{k: v}` is a dict where `{a, b}` is a set
+func hasTopLevelColon(s string) bool {
+	depth := 0
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0:
+			return true
+		}
+	}
+	return false
+}
+
+// the type of name going by every simple assignment to it in content, annotations taking precedence.
+// differing types are joined with `|`, one assignment that can't be inferred leaves the whole thing unknown
+func variableType(content string, name string) string {
+	return variableTypeMap(content)[name]
+}
+
+// variableType for every simply assigned name at once, one pass over the file. unknown names are left out
+func variableTypeMap(content string) map[string]string {
+	types := make(map[string][]string)
+	unknown := make(map[string]bool)
+	for _, line := range splitLines(content) {
+		m := simpleAssignRe.FindStringSubmatch(line)
+		if m == nil || unknown[m[2]] { continue }
+		t := strings.TrimSpace(m[3])
+		if t == "" {
+			t = inferType(m[4], content)
+		}else if stdlib, ok := stdlibConstructors[resolveDotted(content, strings.Split(t, "."))]; ok {
+			t = stdlib // `p: pathlib.Path`
+		}
+		if t == "" {
+			unknown[m[2]] = true
+			continue
+		}
+		if !slices.Contains(types[m[2]], t) {
+			types[m[2]] = append(types[m[2]], t)
+		}
+	}
+
+	result := make(map[string]string, len(types))
+	for name, ts := range types {
+		if !unknown[name] {
+			result[name] = strings.Join(ts, " | ")
+		}
+	}
+	return result
+}
+
+// the name that name is a plain alias of (`x = config`), only when every assignment to it is that same one.
+// anything more than a bare name on the right isn't an alias
+func aliasOf(content string, name string) string {
+	base := ""
+	for _, line := range splitLines(content) {
+		m := simpleAssignRe.FindStringSubmatch(line)
+		if m == nil || m[2] != name { continue }
+		rhs := strings.TrimSpace(m[4])
+		if !identifierRe.MatchString(rhs) || rhs == name || (base != "" && rhs != base) {
+			return ""
+		}
+		base = rhs
+	}
+	return base
+}
+
+func typeMethod(name string, signature string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 2, InsertText: name, InsertTextFmt: 1, Detail: name + signature }
+}
+
+func typeMethodDoc(name string, signature string, doc string) CompletionItem {
+	item := typeMethod(name, signature)
+	item.Documentation = doc
+	return item
+}
+
+func typeProperty(name string, typ string) CompletionItem {
+	return CompletionItem{ Label: name, Kind: 10, InsertText: name, InsertTextFmt: 1, Detail: name + ": " + typ }
+}
+
+// members of the builtin types for dot completion on values inferType can name
+var knownTypeAttrs = map[string][]CompletionItem{
+	"str": {
+		typeMethod("split", "(sep=None, maxsplit=-1) -> list[str]"),
+		typeMethod("rsplit", "(sep=None, maxsplit=-1) -> list[str]"),
+		typeMethod("splitlines", "(keepends=False) -> list[str]"),
+		typeMethod("join", "(iterable, /) -> str"),
+		typeMethod("strip", "(chars=None, /) -> str"),
+		typeMethod("lstrip", "(chars=None, /) -> str"),
+		typeMethod("rstrip", "(chars=None, /) -> str"),
+		typeMethod("replace", "(old, new, count=-1, /) -> str"),
+		typeMethod("startswith", "(prefix, start=None, end=None) -> bool"),
+		typeMethod("endswith", "(suffix, start=None, end=None) -> bool"),
+		typeMethod("removeprefix", "(prefix, /) -> str"),
+		typeMethod("removesuffix", "(suffix, /) -> str"),
+		typeMethod("find", "(sub, start=None, end=None) -> int"),
+		typeMethod("rfind", "(sub, start=None, end=None) -> int"),
+		typeMethod("index", "(sub, start=None, end=None) -> int"),
+		typeMethod("rindex", "(sub, start=None, end=None) -> int"),
+		typeMethod("count", "(sub, start=None, end=None) -> int"),
+		typeMethod("format", "(*args, **kwargs) -> str"),
+		typeMethod("format_map", "(mapping, /) -> str"),
+		typeMethod("encode", "(encoding='utf-8', errors='strict') -> bytes"),
+		typeMethod("lower", "() -> str"),
+		typeMethod("upper", "() -> str"),
+		typeMethod("casefold", "() -> str"),
+		typeMethod("capitalize", "() -> str"),
+		typeMethod("title", "() -> str"),
+		typeMethod("swapcase", "() -> str"),
+		typeMethod("center", "(width, fillchar=' ', /) -> str"),
+		typeMethod("ljust", "(width, fillchar=' ', /) -> str"),
+		typeMethod("rjust", "(width, fillchar=' ', /) -> str"),
+		typeMethod("zfill", "(width, /) -> str"),
+		typeMethod("expandtabs", "(tabsize=8) -> str"),
+		typeMethod("partition", "(sep, /) -> tuple[str, str, str]"),
+		typeMethod("rpartition", "(sep, /) -> tuple[str, str, str]"),
+		typeMethod("translate", "(table, /) -> str"),
+		typeMethod("isalnum", "() -> bool"),
+		typeMethod("isalpha", "() -> bool"),
+		typeMethod("isascii", "() -> bool"),
+		typeMethod("isdecimal", "() -> bool"),
+		typeMethod("isdigit", "() -> bool"),
+		typeMethod("isidentifier", "() -> bool"),
+		typeMethod("islower", "() -> bool"),
+		typeMethod("isnumeric", "() -> bool"),
+		typeMethod("isprintable", "() -> bool"),
+		typeMethod("isspace", "() -> bool"),
+		typeMethod("istitle", "() -> bool"),
+		typeMethod("isupper", "() -> bool"),
+	},
+	"bytes": {
+		typeMethod("decode", "(encoding='utf-8', errors='strict') -> str"),
+		typeMethod("hex", "(sep=None, bytes_per_sep=1) -> str"),
+		typeMethod("split", "(sep=None, maxsplit=-1) -> list[bytes]"),
+		typeMethod("splitlines", "(keepends=False) -> list[bytes]"),
+		typeMethod("join", "(iterable_of_bytes, /) -> bytes"),
+		typeMethod("strip", "(bytes=None, /) -> bytes"),
+		typeMethod("lstrip", "(bytes=None, /) -> bytes"),
+		typeMethod("rstrip", "(bytes=None, /) -> bytes"),
+		typeMethod("replace", "(old, new, count=-1, /) -> bytes"),
+		typeMethod("startswith", "(prefix, start=None, end=None) -> bool"),
+		typeMethod("endswith", "(suffix, start=None, end=None) -> bool"),
+		typeMethod("removeprefix", "(prefix, /) -> bytes"),
+		typeMethod("removesuffix", "(suffix, /) -> bytes"),
+		typeMethod("find", "(sub, start=None, end=None) -> int"),
+		typeMethod("index", "(sub, start=None, end=None) -> int"),
+		typeMethod("count", "(sub, start=None, end=None) -> int"),
+		typeMethod("partition", "(sep, /) -> tuple[bytes, bytes, bytes]"),
+		typeMethod("lower", "() -> bytes"),
+		typeMethod("upper", "() -> bytes"),
+	},
+	"list": {
+		typeMethod("append", "(object, /) -> None"),
+		typeMethod("extend", "(iterable, /) -> None"),
+		typeMethod("insert", "(index, object, /) -> None"),
+		typeMethod("pop", "(index=-1, /) -> T"),
+		typeMethod("remove", "(value, /) -> None"),
+		typeMethod("clear", "() -> None"),
+		typeMethod("index", "(value, start=0, stop=sys.maxsize, /) -> int"),
+		typeMethod("count", "(value, /) -> int"),
+		withSnippet(typeMethod("sort", "(*, key=None, reverse=False) -> None"), "sort(key=${1:None})$0"),
+		typeMethod("reverse", "() -> None"),
+		typeMethod("copy", "() -> list[T]"),
+	},
+	"dict": {
+		typeMethod("get", "(key, default=None, /) -> V | None"),
+		typeMethod("items", "() -> dict_items[K, V]"),
+		typeMethod("keys", "() -> dict_keys[K, V]"),
+		typeMethod("values", "() -> dict_values[K, V]"),
+		typeMethod("pop", "(key, default=..., /) -> V"),
+		typeMethod("popitem", "() -> tuple[K, V]"),
+		typeMethod("setdefault", "(key, default=None, /) -> V"),
+		typeMethod("update", "(other=(), /, **kwargs) -> None"),
+		typeMethod("clear", "() -> None"),
+		typeMethod("copy", "() -> dict[K, V]"),
+		typeMethod("fromkeys", "(iterable, value=None, /) -> dict"),
+	},
+	"set": {
+		typeMethod("add", "(element, /) -> None"),
+		typeMethod("discard", "(element, /) -> None"),
+		typeMethod("remove", "(element, /) -> None"),
+		typeMethod("pop", "() -> T"),
+		typeMethod("clear", "() -> None"),
+		typeMethod("copy", "() -> set[T]"),
+		typeMethodDoc("update", "(*others) -> None", "`s |= other` for a single set."),
+		typeMethodDoc("union", "(*others) -> set[T]", "`s | other` for a single set."),
+		typeMethodDoc("intersection", "(*others) -> set[T]", "`s & other` for a single set."),
+		typeMethodDoc("intersection_update", "(*others) -> None", "`s &= other` for a single set."),
+		typeMethodDoc("difference", "(*others) -> set[T]", "`s - other` for a single set."),
+		typeMethodDoc("difference_update", "(*others) -> None", "`s -= other` for a single set."),
+		typeMethodDoc("symmetric_difference", "(other, /) -> set[T]", "`s ^ other`."),
+		typeMethodDoc("symmetric_difference_update", "(other, /) -> None", "`s ^= other`."),
+		typeMethod("isdisjoint", "(other, /) -> bool"),
+		typeMethodDoc("issubset", "(other, /) -> bool", "`s <= other`."),
+		typeMethodDoc("issuperset", "(other, /) -> bool", "`s >= other`."),
+	},
+	// set's methods that don't change it
+	"frozenset": {
+		typeMethod("copy", "() -> frozenset[T]"),
+		typeMethodDoc("union", "(*others) -> frozenset[T]", "`s | other` for a single set."),
+		typeMethodDoc("intersection", "(*others) -> frozenset[T]", "`s & other` for a single set."),
+		typeMethodDoc("difference", "(*others) -> frozenset[T]", "`s - other` for a single set."),
+		typeMethodDoc("symmetric_difference", "(other, /) -> frozenset[T]", "`s ^ other`."),
+		typeMethod("isdisjoint", "(other, /) -> bool"),
+		typeMethodDoc("issubset", "(other, /) -> bool", "`s <= other`."),
+		typeMethodDoc("issuperset", "(other, /) -> bool", "`s >= other`."),
+	},
+	"tuple": {
+		typeMethod("count", "(value, /) -> int"),
+		typeMethod("index", "(value, start=0, stop=sys.maxsize, /) -> int"),
+	},
+	"int": {
+		typeMethod("bit_length", "() -> int"),
+		typeMethod("bit_count", "() -> int"),
+		typeMethod("to_bytes", "(length=1, byteorder='big', *, signed=False) -> bytes"),
+		typeMethod("from_bytes", "(bytes, byteorder='big', *, signed=False) -> int"),
+		typeMethod("as_integer_ratio", "() -> tuple[int, int]"),
+		typeMethod("conjugate", "() -> int"),
+		typeProperty("real", "int"),
+		typeProperty("imag", "int"),
+		typeProperty("numerator", "int"),
+		typeProperty("denominator", "int"),
+	},
+	"float": {
+		typeMethod("is_integer", "() -> bool"),
+		typeMethod("as_integer_ratio", "() -> tuple[int, int]"),
+		typeMethod("hex", "() -> str"),
+		typeMethod("fromhex", "(string, /) -> float"),
+		typeMethod("conjugate", "() -> float"),
+		typeProperty("real", "float"),
+		typeProperty("imag", "float"),
+	},
+	"Path": {
+		typeMethod("read_text", "(encoding=None, errors=None) -> str"),
+		typeMethod("write_text", "(data, encoding=None, errors=None, newline=None) -> int"),
+		typeMethod("read_bytes", "() -> bytes"),
+		typeMethod("write_bytes", "(data) -> int"),
+		typeMethod("exists", "(*, follow_symlinks=True) -> bool"),
+		typeMethod("is_file", "() -> bool"),
+		typeMethod("is_dir", "() -> bool"),
+		typeMethod("mkdir", "(mode=0o777, parents=False, exist_ok=False) -> None"),
+		typeMethod("unlink", "(missing_ok=False) -> None"),
+		typeMethod("rename", "(target) -> Path"),
+		typeMethod("glob", "(pattern) -> Iterator[Path]"),
+		typeMethod("rglob", "(pattern) -> Iterator[Path]"),
+		typeMethod("iterdir", "() -> Iterator[Path]"),
+		typeMethod("joinpath", "(*pathsegments) -> Path"),
+		typeMethod("open", "(mode='r', buffering=-1, encoding=None, errors=None, newline=None) -> IO"),
+		typeMethod("resolve", "(strict=False) -> Path"),
+		typeMethod("with_suffix", "(suffix) -> Path"),
+		typeMethod("with_name", "(name) -> Path"),
+		typeProperty("parent", "Path"),
+		typeProperty("name", "str"),
+		typeProperty("stem", "str"),
+		typeProperty("suffix", "str"),
+		typeProperty("parts", "tuple[str, ...]"),
+	},
+	"deque": {
+		typeMethod("append", "(x, /) -> None"),
+		typeMethod("appendleft", "(x, /) -> None"),
+		typeMethod("pop", "() -> T"),
+		typeMethod("popleft", "() -> T"),
+		typeMethod("extend", "(iterable, /) -> None"),
+		typeMethod("extendleft", "(iterable, /) -> None"),
+		typeMethod("rotate", "(n=1, /) -> None"),
+		typeMethod("clear", "() -> None"),
+		typeMethod("count", "(x, /) -> int"),
+		typeMethod("remove", "(value, /) -> None"),
+		typeProperty("maxlen", "int | None"),
+	},
+	"timedelta": {
+		typeProperty("days", "int"),
+		typeProperty("seconds", "int"),
+		typeProperty("microseconds", "int"),
+		typeMethod("total_seconds", "() -> float"),
+	},
+	"Logger": {
+		typeMethod("debug", "(msg, *args, **kwargs) -> None"),
+		typeMethod("info", "(msg, *args, **kwargs) -> None"),
+		typeMethod("warning", "(msg, *args, **kwargs) -> None"),
+		typeMethod("error", "(msg, *args, **kwargs) -> None"),
+		typeMethod("critical", "(msg, *args, **kwargs) -> None"),
+		typeMethod("exception", "(msg, *args, exc_info=True, **kwargs) -> None"),
+		typeMethod("log", "(level, msg, *args, **kwargs) -> None"),
+		typeMethod("setLevel", "(level) -> None"),
+		typeMethod("getEffectiveLevel", "() -> int"),
+		typeMethod("isEnabledFor", "(level) -> bool"),
+		typeMethod("addHandler", "(hdlr) -> None"),
+		typeMethod("removeHandler", "(hdlr) -> None"),
+		typeMethod("getChild", "(suffix) -> Logger"),
+		typeProperty("name", "str"),
+		typeProperty("level", "int"),
+		typeProperty("handlers", "list[Handler]"),
+		typeProperty("propagate", "bool"),
+	},
+	"ArgumentParser": {
+		withSnippet(typeMethod("add_argument", "(*name_or_flags, action=..., nargs=..., const=..., default=..., type=..., choices=..., required=..., help=..., metavar=..., dest=...) -> Action"), "add_argument($1, type=$2, help=$3)"),
+		typeMethod("parse_args", "(args=None, namespace=None) -> Namespace"),
+		typeMethod("parse_known_args", "(args=None, namespace=None) -> tuple[Namespace, list[str]]"),
+		typeMethod("add_subparsers", "(*, title=..., description=..., prog=..., dest=None, required=False, help=..., metavar=...) -> _SubParsersAction"),
+		typeMethod("set_defaults", "(**kwargs) -> None"),
+		typeMethod("get_default", "(dest) -> Any"),
+		typeMethod("print_help", "(file=None) -> None"),
+		typeMethod("print_usage", "(file=None) -> None"),
+		typeMethod("error", "(message) -> NoReturn"),
+		typeMethod("exit", "(status=0, message=None) -> NoReturn"),
+		typeMethod("format_help", "() -> str"),
+		typeMethod("format_usage", "() -> str"),
+	},
+	"Flask": {
+		withSnippet(typeMethod("route", "(rule, **options) -> Callable"), "route(\"$1\")"),
+		typeMethod("before_request", "(f) -> Callable"),
+		typeMethod("after_request", "(f) -> Callable"),
+		typeMethod("teardown_appcontext", "(f) -> Callable"),
+		typeMethod("errorhandler", "(code_or_exception) -> Callable"),
+		typeMethod("register_blueprint", "(blueprint, **options) -> None"),
+		typeMethod("run", "(host=None, port=None, debug=None, load_dotenv=True, **options) -> None"),
+		typeMethod("app_context", "() -> AppContext"),
+		typeMethod("test_client", "(use_cookies=True, **kwargs) -> FlaskClient"),
+		typeProperty("config", "Config"),
+		typeProperty("url_map", "Map"),
+		typeProperty("template_folder", "str | None"),
+		typeProperty("static_folder", "str | None"),
+		typeProperty("secret_key", "str | bytes | None"),
+		typeProperty("logger", "Logger"),
+		typeProperty("name", "str"),
+	},
+	// sqlalchemy.orm's
+	"Session": {
+		typeMethod("add", "(instance) -> None"),
+		typeMethod("add_all", "(instances) -> None"),
+		typeMethod("delete", "(instance) -> None"),
+		typeMethod("commit", "() -> None"),
+		typeMethod("rollback", "() -> None"),
+		typeMethod("flush", "(objects=None) -> None"),
+		typeMethod("close", "() -> None"),
+		typeMethod("query", "(*entities) -> Query"),
+		typeMethod("merge", "(instance, *, load=True) -> T"),
+		typeMethod("execute", "(statement, params=None) -> Result"),
+		typeMethod("scalars", "(statement, params=None) -> ScalarResult"),
+		typeMethod("scalar", "(statement, params=None) -> Any"),
+		typeMethod("get", "(entity, ident) -> T | None"),
+		typeMethod("refresh", "(instance) -> None"),
+		typeMethod("expunge", "(instance) -> None"),
+		typeMethod("begin", "() -> SessionTransaction"),
+	},
+	"TextIOWrapper": {
+		typeMethod("read", "(size=-1, /) -> str"),
+		typeMethod("readline", "(size=-1, /) -> str"),
+		typeMethod("readlines", "(hint=-1, /) -> list[str]"),
+		typeMethod("write", "(s, /) -> int"),
+		typeMethod("writelines", "(lines, /) -> None"),
+		typeMethod("close", "() -> None"),
+		typeMethod("flush", "() -> None"),
+		typeMethod("seek", "(cookie, whence=0, /) -> int"),
+		typeMethod("tell", "() -> int"),
+		typeMethod("truncate", "(pos=None, /) -> int"),
+		typeMethod("fileno", "() -> int"),
+		typeMethod("readable", "() -> bool"),
+		typeMethod("writable", "() -> bool"),
+		typeMethod("seekable", "() -> bool"),
+		typeProperty("name", "str"),
+		typeProperty("mode", "str"),
+		typeProperty("closed", "bool"),
+		typeProperty("encoding", "str"),
+	},
+}
+
+// the expression a `.` right before the word being typed is applied to, `"a,b".spl` gives `"a,b"` and
+// `open(path).re` gives `open(path)`. only looks at the current line
+func receiverExpression(lineText string, wordStart int) string {
+	dot := wordStart - 1
+	if dot < 0 || lineText[dot] != '.' {
+		return ""
+	}
+	i := dot
+	for i > 0 {
+		c := lineText[i-1]
+		switch {
+		case c == ')' || c == ']' || c == '}':
+			if i = matchingOpen(lineText, i-1); i < 0 {
+				return ""
+			}
+		case c == '"' || c == '\'':
+			if i = strings.LastIndexByte(lineText[:i-1], c); i < 0 {
+				return ""
+			}
+			for i > 0 && strings.IndexByte("rbfuRBFU", lineText[i-1]) >= 0 {
+				i--
+			}
+		case isIdentifierByte(c) || c == '.':
+			i--
+		default:
+			return strings.TrimSpace(lineText[i:dot])
+		}
+	}
+	return strings.TrimSpace(lineText[i:dot])
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// index of the bracket opening the one at close, ignoring quoting
+func matchingOpen(text string, close int) int {
+	depth := 0
+	for i := close; i >= 0; i-- {
+		switch text[i] {
+		case ')', ']', '}':
+			depth++
+		case '(', '[', '{':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// the builtin type of a receiver expression: a literal, a constructor call or a variable only ever assigned one
+func receiverType(content string, variableTypes map[string]string, expr string) string {
+	if expr == "" {
+		return ""
+	}
+	if t := inferType(expr, content); t != "" {
+		return t
+	}
+	if identifierRe.MatchString(expr) {
+		return plainType(variableTypes[expr])
+	}
+	return ""
+}
+
+// the annotated type of the parameter name refers to at line and offset, `def f(p: str)` makes `p.` a str inside f.
+// the innermost scope binding name decides, a local or a parameter of an inner def hides the outer one
+func parameterType(content string, line, offset int, name string) string {
+	for cur := analyzeScopes(content).scopeAt(line, offset); cur != nil; cur = cur.parent {
+		if _, ok := cur.bindings[name]; !ok {
+			continue
+		}
+		if cur.kind != scopeFunction {
+			return ""
+		}
+		for _, p := range cur.params {
+			if p.name != name || p.star != "" || p.annotation == "" {
+				continue
+			}
+			if stdlib, ok := stdlibConstructors[resolveDotted(content, strings.Split(p.annotation, "."))]; ok {
+				return stdlib
+			}
+			return plainType(p.annotation)
+		}
+		return ""
+	}
+	return ""
+}
+
+// typing's capitalised aliases of the builtin containers
+var typingAliases = map[string]string{
+	"Dict": "dict", "List": "list", "Set": "set", "FrozenSet": "frozenset", "Tuple": "tuple",
+	"DefaultDict": "defaultdict", "Deque": "deque", "Counter": "Counter", "OrderedDict": "OrderedDict",
+}
+
+// the class an annotation names, for looking up its members: `Dict[str, int]`, `dict[str, int]` and `"dict"`
+// are all dict. unions are left alone
+func plainType(annotation string) string {
+	t := strings.Trim(annotation, `"'`)
+	if i := strings.Index(t, "["); i >= 0 {
+		t = t[:i]
+	}
+	if strings.HasPrefix(t, "typing.") {
+		t = strings.TrimPrefix(t, "typing.")
+	}
+	if alias, ok := typingAliases[t]; ok {
+		return alias
+	}
+	return t
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestAliasOf(t *testing.T) {
+	tests := []struct {
+		text, name, want string
+	}{
+		{"x = config\n", "x", "config"},
+		{"    x = self\n", "x", "self"},
+		{"x = config\nx = config\n", "x", "config"},
+		{"x = config\nx = other\n", "x", ""}, // two different bases
+		{"x = config.section\n", "x", ""},    // not a bare name
+		{"x = make_config()\n", "x", ""},
+		{"x = x\n", "x", ""},
+		{"y = config\n", "x", ""},
+	}
+	for _, tt := range tests {
+		if got := aliasOf(tt.text, tt.name); got != tt.want {
+			t.Errorf("aliasOf(%q, %q) = %q, want %q", tt.text, tt.name, got, tt.want)
+		}
+	}
+}
+
+// x = self inside a method, x. offers the class members self. would and not what other receivers were followed by
+func TestSelfAliasMembers(t *testing.T) {
+	text := "class Server:\n    def __init__(self):\n        self.port = 80\n        self.host = 'localhost'\n        log.flush()\n\n    def start(self):\n        x = self\n        x.\n"
+	c := newTestServer(t, nil, nil)
+	uri := "file:///alias.py"
+	c.open(uri, text)
+	items := c.completion(uri, 8, 10).Items
+	for _, attr := range []string{"port", "host", "start"} {
+		if _, ok := findItem(items, attr); !ok {
+			t.Errorf("x. is missing %s: %v", attr, labels(items))
+		}
+	}
+	for _, other := range []string{"flush", "Server"} {
+		if _, ok := findItem(items, other); ok {
+			t.Errorf("x. offered %s: %v", other, labels(items))
+		}
+	}
+}
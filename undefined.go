@@ -0,0 +1,310 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// names that are used but bound nowhere the scope analyzer can see, each with the closest names that are in scope
+// as "did you mean" suggestions and a quick fix per suggestion. it errs on the side of saying nothing: a file with
+// a star import is never checked, and names bound by things the analyzer doesn't model (lambda parameters, match
+// captures, type parameters) count as bound anywhere in the file
+
+// everything in the builtins module (3.13, and WindowsError from windows), plus the globals python gives every
+// module and class body
+var pythonBuiltins = map[string]bool{
+	"ArithmeticError": true, "AssertionError": true, "AttributeError": true, "BaseException": true, "BaseExceptionGroup": true,
+	"BlockingIOError": true, "BrokenPipeError": true, "BufferError": true, "BytesWarning": true, "ChildProcessError": true,
+	"ConnectionAbortedError": true, "ConnectionError": true, "ConnectionRefusedError": true, "ConnectionResetError": true,
+	"DeprecationWarning": true, "EOFError": true, "Ellipsis": true, "EncodingWarning": true, "EnvironmentError": true,
+	"Exception": true, "ExceptionGroup": true, "FileExistsError": true, "FileNotFoundError": true, "FloatingPointError": true,
+	"FutureWarning": true, "GeneratorExit": true, "IOError": true, "ImportError": true, "ImportWarning": true,
+	"IndentationError": true, "IndexError": true, "InterruptedError": true, "IsADirectoryError": true, "KeyError": true,
+	"KeyboardInterrupt": true, "LookupError": true, "MemoryError": true, "ModuleNotFoundError": true, "NameError": true,
+	"NotADirectoryError": true, "NotImplemented": true, "NotImplementedError": true, "OSError": true, "OverflowError": true,
+	"PendingDeprecationWarning": true, "PermissionError": true, "ProcessLookupError": true, "PythonFinalizationError": true,
+	"RecursionError": true, "ReferenceError": true, "ResourceWarning": true, "RuntimeError": true, "RuntimeWarning": true,
+	"StopAsyncIteration": true, "StopIteration": true, "SyntaxError": true, "SyntaxWarning": true, "SystemError": true,
+	"SystemExit": true, "TabError": true, "TimeoutError": true, "TypeError": true, "UnboundLocalError": true,
+	"UnicodeDecodeError": true, "UnicodeEncodeError": true, "UnicodeError": true, "UnicodeTranslateError": true,
+	"UnicodeWarning": true, "UserWarning": true, "ValueError": true, "Warning": true, "WindowsError": true, "ZeroDivisionError": true,
+	"abs": true, "aiter": true, "all": true, "anext": true, "any": true, "ascii": true, "bin": true, "bool": true,
+	"breakpoint": true, "bytearray": true, "bytes": true, "callable": true, "chr": true, "classmethod": true, "compile": true,
+	"complex": true, "copyright": true, "credits": true, "delattr": true, "dict": true, "dir": true, "divmod": true,
+	"enumerate": true, "eval": true, "exec": true, "exit": true, "filter": true, "float": true, "format": true,
+	"frozenset": true, "getattr": true, "globals": true, "hasattr": true, "hash": true, "help": true, "hex": true, "id": true,
+	"input": true, "int": true, "isinstance": true, "issubclass": true, "iter": true, "len": true, "license": true,
+	"list": true, "locals": true, "map": true, "max": true, "memoryview": true, "min": true, "next": true, "object": true,
+	"oct": true, "open": true, "ord": true, "pow": true, "print": true, "property": true, "quit": true, "range": true,
+	"repr": true, "reversed": true, "round": true, "set": true, "setattr": true, "slice": true, "sorted": true,
+	"staticmethod": true, "str": true, "sum": true, "super": true, "tuple": true, "type": true, "vars": true, "zip": true,
+	"__build_class__": true, "__debug__": true, "__import__": true,
+	"__name__": true, "__doc__": true, "__file__": true, "__package__": true, "__spec__": true, "__loader__": true,
+	"__builtins__": true, "__path__": true, "__cached__": true, "__annotations__": true,
+	"__module__": true, "__qualname__": true, "__class__": true,
+}
+
+var starImportRe = regexp.MustCompile(`(?m)^\s*from\s+\S+\s+import\s+\*`)
+
+func undefinedNames(file OpenFile, lines []string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	if starImportRe.MatchString(file.content) {
+		return diagnostics // anything could have come from it
+	}
+	root := analyzeScopes(file.content)
+	extras := getExtraBuiltins()
+	logical := logicalLines(lines, tokenize(file.content))
+	loose := looselyBound(logical)
+
+	for _, ll := range logical {
+		tokens := ll.tokens
+		first := tokens[0]
+		if isKeyword(first, "import") || isKeyword(first, "from") || isKeyword(first, "global") || isKeyword(first, "nonlocal") {
+			continue
+		}
+		// parameter defaults and annotations are evaluated where the def is, the parameter names belong to the def
+		var outer *scope
+		header := tokens
+		if isKeyword(header[0], "async") && len(header) > 1 {
+			header = header[1:]
+		}
+		if isKeyword(header[0], "def") || isKeyword(header[0], "class") {
+			outer = root.scopeAt(header[0].line, header[0].start)
+		}
+		softKeyword := (first.text == "match" || first.text == "case") && isOp(tokens[len(tokens)-1], ":") ||
+			first.text == "type" && len(tokens) > 1 && tokens[1].kind == tokenIdentifier
+
+		brackets := make([]string, 0)
+		for i, tok := range tokens {
+			if tok.kind == tokenOperator {
+				switch tok.text {
+				case "(", "[", "{":
+					brackets = append(brackets, tok.text)
+				case ")", "]", "}":
+					if len(brackets) > 0 { brackets = brackets[:len(brackets)-1] }
+				}
+				continue
+			}
+			if tok.kind != tokenIdentifier || pythonKeywords[tok.text] || afterDot(tokens, i) { continue }
+			if i == 0 && softKeyword || loose[tok.text] || pythonBuiltins[tok.text] { continue }
+			if _, ok := extras[tok.text]; ok { continue }
+			if i+1 < len(tokens) && isOp(tokens[i+1], "=") && len(brackets) > 0 && brackets[len(brackets)-1] == "(" {
+				continue // a keyword argument
+			}
+			at := root.scopeAt(tok.line, tok.start)
+			if _, ok := at.lookup(tok.text); ok { continue }
+			if outer != nil {
+				if _, ok := outer.lookup(tok.text); ok { continue }
+			}
+
+			message := tok.text + " is not defined"
+			if suggestions := didYouMean(tok.text, at); len(suggestions) > 0 {
+				message += ", did you mean '" + strings.Join(suggestions, "' or '") + "'?"
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Range: rangeOnLine(lines, tok.line, tok.start, tok.end), Severity: severityWarning, Code: "pypls.undefined-name", Source: "pypls",
+				Message: message,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// names bound by what the scope analyzer leaves out, taken as bound everywhere: `as` targets (the analyzer misses
+// some, parenthesized withs and match patterns), lambda parameters, match captures, global and nonlocal
+// declarations, and type parameters and aliases
+func looselyBound(logical []logicalLine) map[string]bool {
+	loose := make(map[string]bool)
+	for _, ll := range logical {
+		tokens := ll.tokens
+		first := tokens[0]
+		if isKeyword(first, "global") || isKeyword(first, "nonlocal") {
+			for _, tok := range tokens[1:] {
+				if tok.kind == tokenIdentifier {
+					loose[tok.text] = true
+				}
+			}
+			continue
+		}
+
+		header := tokens
+		if isKeyword(header[0], "async") && len(header) > 1 {
+			header = header[1:]
+		}
+		isDef := isKeyword(header[0], "def") || isKeyword(header[0], "class")
+		if first.text == "type" && len(tokens) > 2 && tokens[1].kind == tokenIdentifier {
+			loose[tokens[1].text] = true
+			isDef = true
+			header = tokens
+		}
+		if isDef && len(header) > 2 && isOp(header[2], "[") { // def f[T](x: T), class Box[T]:, type Pair[T] = ...
+			for _, tok := range header[3:] {
+				if isOp(tok, "]") { break }
+				if tok.kind == tokenIdentifier {
+					loose[tok.text] = true
+				}
+			}
+		}
+
+		if first.text == "case" && isOp(tokens[len(tokens)-1], ":") {
+			for i := 1; i < len(tokens); i++ {
+				tok := tokens[i]
+				if isKeyword(tok, "if") || isOp(tok, ":") && i == len(tokens)-1 { break }
+				if tok.kind != tokenIdentifier || pythonKeywords[tok.text] || afterDot(tokens, i) { continue }
+				if i+1 < len(tokens) && (isOp(tokens[i+1], "(") || isOp(tokens[i+1], ".") || isOp(tokens[i+1], "=")) { continue }
+				loose[tok.text] = true
+			}
+		}
+
+		for i, tok := range tokens {
+			if isKeyword(tok, "as") && i+1 < len(tokens) && tokens[i+1].kind == tokenIdentifier {
+				loose[tokens[i+1].text] = true
+			}
+			if !isKeyword(tok, "lambda") { continue }
+			depth := 0
+			for j := i + 1; j < len(tokens); j++ {
+				param := tokens[j]
+				if param.kind == tokenOperator {
+					switch param.text {
+					case "(", "[", "{":
+						depth++
+					case ")", "]", "}":
+						depth--
+					}
+				}
+				if depth < 0 || depth == 0 && isOp(param, ":") { break }
+				if depth == 0 && param.kind == tokenIdentifier {
+					previous := tokens[j-1]
+					if j == i+1 || isOp(previous, ",") || isOp(previous, "*") || isOp(previous, "**") {
+						loose[param.text] = true
+					}
+				}
+			}
+		}
+	}
+	return loose
+}
+
+// up to three names visible from s (builtins included) within two edits of name, closest first. a name under six
+// characters only gets the ones a single edit away, two edits turn it into nearly anything that short. True, False and None
+// are the only keywords ever suggested, they're the only ones that can stand where a name does
+func didYouMean(name string, s *scope) []string {
+	maxDistance := 2
+	if len(name) < 6 {
+		maxDistance = 1
+	}
+	distances := make(map[string]int)
+	consider := func(candidate string) {
+		if candidate == name { return }
+		if _, seen := distances[candidate]; seen { return }
+		if strings.HasPrefix(candidate, "__") && !strings.HasPrefix(name, "_") { return }
+		if d := editDistance(name, candidate, maxDistance); d <= maxDistance {
+			distances[candidate] = d
+		}
+	}
+
+	for cur := s; cur != nil; cur = cur.parent {
+		if cur.kind == scopeClass && cur != s { continue }
+		for candidate := range cur.bindings {
+			consider(candidate)
+		}
+	}
+	for candidate := range pythonBuiltins {
+		consider(candidate)
+	}
+	for candidate := range getExtraBuiltins() {
+		consider(candidate)
+	}
+	for _, candidate := range []string{"True", "False", "None"} {
+		consider(candidate)
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for candidate := range distances {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if distances[a] != distances[b] {
+			return distances[a] < distances[b]
+		}
+		return a < b
+	})
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+	return suggestions
+}
+
+// the restricted damerau-levenshtein distance (optimal string alignment): insertions, deletions, substitutions
+// and swaps of two neighbouring characters each cost one. gives up with max+1 as soon as the answer can't be max
+// or less, most candidates are thrown out by their length alone
+func editDistance(a, b string, max int) int {
+	if len(a)-len(b) > max || len(b)-len(a) > max {
+		return max + 1
+	}
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		best := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+			best = min(best, current[j])
+		}
+		if best > max {
+			return max + 1
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return min(previous[len(b)], max+1)
+}
+
+// LSP CodeAction, only ever a quick fix with its edit filled in
+type CodeAction struct {
+	Title       string        `json:"title"`
+	Kind        string        `json:"kind"`
+	Diagnostics []Diagnostic  `json:"diagnostics,omitempty"`
+	IsPreferred bool          `json:"isPreferred,omitempty"`
+	Edit        WorkspaceEdit `json:"edit"`
+}
+
+// a quick fix per suggestion for each of our undefined-name diagnostics the client passes back, the closest one
+// preferred. the name is looked up again so a diagnostic that went stale after an edit offers nothing
+func undefinedNameFixes(file OpenFile, diagnostics []Diagnostic) []CodeAction {
+	actions := make([]CodeAction, 0)
+	lines := splitLines(file.content)
+	var root *scope
+	for _, d := range diagnostics {
+		if d.Code != "pypls.undefined-name" { continue }
+		word, start, end, inCode := wordAtPosition(file.content, d.Range.Start.Line, d.Range.Start.Character)
+		if !inCode || word == "" {
+			continue
+		}
+		if root == nil {
+			root = analyzeScopes(file.content)
+		}
+		at := root.scopeAt(d.Range.Start.Line, start)
+		if _, ok := at.lookup(word); ok { continue }
+		for i, suggestion := range didYouMean(word, at) {
+			edit := TextEdit{rangeOnLine(lines, d.Range.Start.Line, start, end), suggestion}
+			actions = append(actions, CodeAction{
+				Title: "Change to '" + suggestion + "'", Kind: "quickfix", Diagnostics: []Diagnostic{d}, IsPreferred: i == 0,
+				Edit: WorkspaceEdit{map[string][]TextEdit{file.uri: {edit}}},
+			})
+		}
+	}
+	return actions
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// terms from the user's extraWordlistPath, replaced wholesale on reload so readers can hold on to the map
+var extraWords = map[string]int64{}
+var extraWordsMu sync.RWMutex
+
+func getExtraWords() map[string]int64 {
+	extraWordsMu.RLock()
+	defer extraWordsMu.RUnlock()
+	return extraWords
+}
+
+// a missing or unreadable file only costs the extra words, it's not worth failing initialize over
+func loadExtraWordlist(ctx context.Context, conn *jsonrpc2.Conn) {
+	opts := getOptions()
+	words := make(map[string]int64)
+
+	if opts.ExtraWordlistPath != "" {
+		data, err := os.ReadFile(opts.ExtraWordlistPath)
+		if err != nil {
+			warn(ctx, conn, "could not read extraWordlistPath: " + err.Error())
+		}else{
+			for _, line := range strings.Split(string(data), "\n") {
+				if word := strings.TrimSpace(line); word != "" {
+					words[word] = opts.ExtraWordlistPriority
+				}
+			}
+		}
+	}
+
+	extraWordsMu.Lock()
+	extraWords = words
+	extraWordsMu.Unlock()
+	invalidateCompletions()
+}
+
+// prose in comments and docstrings fills the index with words nobody wants completed. keywords and builtins
+// never get in anyway, and words that make common identifiers (a, other, before, ...) are left off
+var englishStopwords = map[string]bool{
+	"the": true, "an": true, "of": true, "to": true, "at": true, "by": true, "on": true, "it": true, "its": true,
+	"that": true, "this": true, "these": true, "those": true, "be": true, "been": true, "being": true, "am": true,
+	"are": true, "was": true, "were": true, "has": true, "have": true, "had": true, "do": true, "does": true,
+	"did": true, "doing": true, "but": true, "than": true, "then": true, "so": true, "such": true, "also": true,
+	"very": true, "just": true, "only": true, "too": true, "can": true, "could": true, "would": true, "should": true,
+	"will": true, "shall": true, "may": true, "might": true, "must": true, "we": true, "you": true, "he": true,
+	"she": true, "they": true, "them": true, "their": true, "there": true, "here": true, "our": true, "your": true,
+	"my": true, "me": true, "us": true, "which": true, "what": true, "when": true, "where": true, "who": true,
+	"whom": true, "why": true, "how": true, "into": true, "about": true, "because": true, "though": true,
+	"although": true, "either": true, "neither": true, "nor": true, "both": true, "some": true, "no": true,
+	"yes": true, "more": true, "most": true, "much": true, "many": true, "don": true, "doesn": true, "isn": true,
+	"aren": true, "wasn": true, "weren": true, "won": true, "wouldn": true, "shouldn": true, "couldn": true,
+	"didn": true, "hasn": true, "haven": true, "otherwise": true, "whether": true, "unless": true,
+}
+
+// the stopwords as written or capitalised at the start of a sentence, `THE` could be a constant
+func removeStopwords(words map[string]int64, opts Options) {
+	extra := make(map[string]bool, len(opts.ExtraStopwords))
+	for _, w := range opts.ExtraStopwords {
+		extra[strings.ToLower(w)] = true
+	}
+	if !opts.Stopwords && len(extra) == 0 {
+		return
+	}
+	for word := range words {
+		lower := strings.ToLower(word)
+		if word[1:] != lower[1:] { continue }
+		if opts.Stopwords && englishStopwords[lower] || extra[lower] {
+			delete(words, word)
+		}
+	}
+}
+
+// globals a dialect injects (MicroPython's machine, an application's app and ctx) complete and hover like builtins.
+// they come from the extraBuiltins setting and from extraBuiltinsFile, which can give each a signature and a doc.
+// an entry for a standard builtin replaces what's shown for it
+type builtinInfo struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"` // `(pin, mode=IN)` for a callable, empty for anything else
+	Doc       string `json:"doc"`
+}
+
+var extraBuiltins = map[string]builtinInfo{}
+var extraBuiltinsMu sync.RWMutex
+
+func getExtraBuiltins() map[string]builtinInfo {
+	extraBuiltinsMu.RLock()
+	defer extraBuiltinsMu.RUnlock()
+	return extraBuiltins
+}
+
+func (b builtinInfo) completionItem() CompletionItem {
+	item := CompletionItem{ Label: b.Name, Kind: 6, InsertText: b.Name, InsertTextFmt: 1, Documentation: b.Doc }
+	if b.Signature != "" {
+		item.Kind, item.Detail = 3, b.Name + b.Signature
+	}
+	return item
+}
+
+// the file is a JSON array of {"name", "signature", "doc"} objects, a bare string is a name on its own. like the
+// wordlist, a file that can't be read or parsed is warned about and skipped
+func loadExtraBuiltins(ctx context.Context, conn *jsonrpc2.Conn) {
+	opts := getOptions()
+	builtins := make(map[string]builtinInfo)
+	for _, name := range opts.ExtraBuiltins {
+		if name = strings.TrimSpace(name); name != "" {
+			builtins[name] = builtinInfo{Name: name}
+		}
+	}
+
+	if opts.ExtraBuiltinsFile != "" {
+		var entries []json.RawMessage
+		data, err := os.ReadFile(opts.ExtraBuiltinsFile)
+		if err == nil {
+			err = json.Unmarshal(data, &entries)
+		}
+		if err != nil {
+			warn(ctx, conn, "could not load extraBuiltinsFile: " + err.Error())
+		}
+		for _, raw := range entries {
+			var info builtinInfo
+			if json.Unmarshal(raw, &info.Name) != nil && json.Unmarshal(raw, &info) != nil || info.Name == "" {
+				warn(ctx, conn, "extraBuiltinsFile: skipping entry " + string(raw))
+				continue
+			}
+			builtins[info.Name] = info
+		}
+	}
+
+	extraBuiltinsMu.Lock()
+	extraBuiltins = builtins
+	extraBuiltinsMu.Unlock()
+	invalidateCompletions()
+}
+
+func extraBuiltinHover(word string) *Hover {
+	info, ok := getExtraBuiltins()[word]
+	if !ok {
+		return nil
+	}
+	value := codeBlock(info.Name + info.Signature)
+	if info.Doc != "" {
+		value += "\n\n" + info.Doc
+	}
+	return markdownHover(value)
+}
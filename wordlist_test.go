@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtraWordlist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "glossary.txt")
+	if err := os.WriteFile(path, []byte("kubernetes\n  kustomize  \n\nterraform\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestServer(t, map[string]any{"extraWordlistPath": path}, nil)
+	uri := "file:///deploy.py"
+	c.open(uri, "ku")
+	list := c.completion(uri, 0, 2)
+	for _, word := range []string{"kubernetes", "kustomize"} {
+		if _, ok := findItem(list.Items, word); !ok {
+			t.Errorf("%s missing from %v", word, labels(list.Items))
+		}
+	}
+
+	// a changed setting reloads it, a file that's gone leaves a warning and no extra words
+	c.notify("workspace/didChangeConfiguration", map[string]any{"settings": map[string]any{"extraWordlistPath": filepath.Join(dir, "missing.txt")}})
+	var message LogMessageParams
+	for message.Type != 2 || !strings.Contains(message.Message, "extraWordlistPath") { // other log lines may come first
+		decodeNotification(t, c.waitFor("window/logMessage", 2*time.Second), &message)
+	}
+	if _, ok := findItem(c.completion(uri, 0, 2).Items, "kubernetes"); ok {
+		t.Error("the old wordlist's words are still offered")
+	}
+}
+
+// prose words go, identifiers made of them and the same word in capitals stay
+func TestStopwords(t *testing.T) {
+	text := "# This is the place where the parser would fail\nthe_parser = THE = 1\nshould_retry = there_count = other = 2\n"
+	removed := []string{"This", "the", "where", "would"}
+	kept := []string{"place", "parser", "fail", "the_parser", "THE", "should_retry", "there_count", "other"}
+
+	words := getWords(&text)
+	removeStopwords(words, defaultOptions())
+	for _, w := range removed {
+		if _, ok := words[w]; ok {
+			t.Errorf("%s kept", w)
+		}
+	}
+	for _, w := range kept {
+		if _, ok := words[w]; !ok {
+			t.Errorf("%s removed", w)
+		}
+	}
+
+	opts := defaultOptions()
+	opts.Stopwords = false
+	words = getWords(&text)
+	removeStopwords(words, opts)
+	if _, ok := words["where"]; !ok {
+		t.Error("where removed with stopwords off")
+	}
+
+	opts.ExtraStopwords = []string{"Place"}
+	words = getWords(&text)
+	removeStopwords(words, opts)
+	if _, ok := words["place"]; ok {
+		t.Error("an extra stopword kept")
+	}
+	if _, ok := words["where"]; !ok {
+		t.Error("extraStopwords brought the default set back")
+	}
+}
+
+// the same through an open document's index
+func TestStopwordsNotCompleted(t *testing.T) {
+	c := newTestServer(t, nil, nil)
+	uri := "file:///prose.py"
+	c.open(uri, "# where the whereabouts are\nwhereabouts = 1\nwh\n")
+	items := c.completion(uri, 2, 2).Items
+	if _, ok := findItem(items, "where"); ok {
+		t.Errorf("a stopword offered: %v", labels(items))
+	}
+	if _, ok := findItem(items, "whereabouts"); !ok {
+		t.Errorf("whereabouts missing: %v", labels(items))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// the folder the client opened, empty when it didn't say (a single loose file for instance)
+var workspaceRoot string
+var workspaceRootMu sync.RWMutex
+
+func getWorkspaceRoot() string {
+	workspaceRootMu.RLock()
+	defer workspaceRootMu.RUnlock()
+	return workspaceRoot
+}
+
+// rootUri wins over the deprecated rootPath
+func setWorkspaceRoot(rootURI string, rootPath string) {
+	root := rootPath
+	if rootURI != "" {
+		root = uriToPath(rootURI)
+	}
+	workspaceRootMu.Lock()
+	workspaceRoot = root
+	workspaceRootMu.Unlock()
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' { // file:///c:/project on windows
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+func pathToURI(p string) string {
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") { // c:/project
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// relative settings paths are relative to the workspace
+func workspacePath(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	if root := getWorkspaceRoot(); root != "" {
+		return filepath.Join(root, p)
+	}
+	return p
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// the pypls.lintWorkspace command: the document checks run over every python file under the workspace root, open
+// or not, each file's diagnostics published as soon as it's done. open documents are left to their own publishes.
+// a file whose content and diagnostics settings are the same as last run reuses last run's result
+
+type lintResult struct {
+	hash        [sha256.Size]byte
+	settings    string // the diagnostics settings it was run with, printed
+	diagnostics []Diagnostic
+	todos       []Todo              // for pypls/todos, whatever the settings
+	symbols     []SymbolInformation // for go to definition when the file isn't open
+}
+
+var lintCache = make(map[string]lintResult) // by path
+var lintCacheMu sync.Mutex
+
+type LintSummary struct {
+	Files    int `json:"files"`    // python files found, open ones included
+	Linted   int `json:"linted"`   // checked this run
+	Cached   int `json:"cached"`   // unchanged since the last run, its result reused
+	Skipped  int `json:"skipped"`  // unreadable or over maxDocumentBytes
+	Problems int `json:"problems"` // diagnostics published, over every file not open
+}
+
+// the .py files under root, sorted so a run goes through them in the same order each time. directories named in
+// exclude and hidden ones (.git, .venv, .tox) aren't looked in, whatever they have isn't the project's own code
+func workspacePythonFiles(ctx context.Context, root string, exclude []string) []string {
+	skip := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		skip[name] = true
+	}
+	var paths []string
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && (skip[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".py") {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths
+}
+
+// the diagnostics for the file at path and whether they came from the cache, ok is false for a file that was
+// skipped
+func lintFile(path string, opts Options) (diagnostics []Diagnostic, cached bool, ok bool) {
+	info, err := os.Stat(path)
+	if err != nil || opts.MaxDocumentBytes > 0 && info.Size() > int64(opts.MaxDocumentBytes) {
+		return nil, false, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, false
+	}
+	hash := sha256.Sum256(content)
+
+	lintCacheMu.Lock()
+	previous, found := lintCache[path]
+	lintCacheMu.Unlock()
+	settings := fmt.Sprint(opts.Diagnostics)
+	if found && previous.hash == hash && previous.settings == settings {
+		return previous.diagnostics, true, true
+	}
+
+	file := OpenFile{ uri: pathToURI(path), content: string(content), languageId: "python" }
+	comments := make([]token, 0)
+	for _, tok := range tokenize(file.content) {
+		if tok.kind == tokenComment {
+			comments = append(comments, tok)
+		}
+	}
+	file.todos = todosFrom(file.uri, pythonLanguage, splitLines(file.content), comments)
+	diagnostics = diagnose(file, opts)
+	lintCacheMu.Lock()
+	lintCache[path] = lintResult{hash, settings, diagnostics, file.todos, documentSymbols(file.uri, file)}
+	lintCacheMu.Unlock()
+	return diagnostics, false, true
+}
+
+// runs on the request's own goroutine so $/cancelRequest stops it, the files are checked `workers` at a time
+func lintWorkspace(ctx context.Context, conn *jsonrpc2.Conn) (LintSummary, error) {
+	var summary LintSummary
+	root := getWorkspaceRoot()
+	if root == "" {
+		return summary, &jsonrpc2.Error{Code: codeRequestFailed, Message: "no workspace folder to lint"}
+	}
+	opts := getOptions()
+	paths := workspacePythonFiles(ctx, root, opts.Diagnostics.WorkspaceExclude)
+	summary.Files = len(paths)
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	next := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range next {
+				uri := pathToURI(path)
+				if _, open := getFile(uri); open {
+					continue
+				}
+				diagnostics, cached, ok := lintFile(path, opts)
+				mu.Lock()
+				switch {
+				case !ok:
+					summary.Skipped++
+				case cached:
+					summary.Cached++
+				default:
+					summary.Linted++
+				}
+				summary.Problems += len(diagnostics)
+				mu.Unlock()
+				if !ok {
+					continue
+				}
+				if _, open := getFile(uri); !open && ctx.Err() == nil { // opened meanwhile, its own publish wins
+					sendDiagnostics(ctx, conn, uri, diagnostics)
+				}
+			}
+		}()
+	}
+feed:
+	for _, path := range paths {
+		select {
+		case next <- path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return summary, ErrCancelled
+	}
+	pruneLintCache(ctx, conn, paths)
+	return summary, nil
+}
+
+// results of files a complete run didn't find, deleted or now excluded, are dropped and so are their
+// diagnostics. their todos go from pypls/todos with them
+func pruneLintCache(ctx context.Context, conn *jsonrpc2.Conn, paths []string) {
+	found := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		found[path] = true
+	}
+	gone := make([]string, 0)
+	lintCacheMu.Lock()
+	for path := range lintCache {
+		if !found[path] {
+			delete(lintCache, path)
+			gone = append(gone, path)
+		}
+	}
+	lintCacheMu.Unlock()
+	for _, path := range gone {
+		if _, open := getFile(pathToURI(path)); !open {
+			sendDiagnostics(ctx, conn, pathToURI(path), []Diagnostic{})
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lintWorkspaceCommand(c *testClient) LintSummary {
+	c.t.Helper()
+	var summary LintSummary
+	c.call("workspace/executeCommand", map[string]any{"command": "pypls.lintWorkspace", "arguments": []any{}}, &summary)
+	return summary
+}
+
+func lintCached(path string) bool {
+	lintCacheMu.Lock()
+	defer lintCacheMu.Unlock()
+	_, ok := lintCache[path]
+	return ok
+}
+
+// a second run reuses the result of every file that didn't change, a run after a file is deleted forgets it
+func TestLintWorkspaceCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.py"), "def a():\n    return 1\n")
+	writeFile(t, filepath.Join(dir, "b.py"), "def b():\n    return 1\n\ndef b():\n    return 2\n")
+	c := newTestServer(t, map[string]any{"diagnostics": map[string]any{"workspace": true}}, nil)
+	setWorkspaceRoot(pathToURI(dir), "")
+
+	if got := lintWorkspaceCommand(c); got.Files != 2 || got.Linted != 2 || got.Cached != 0 || got.Problems != 1 {
+		t.Errorf("first run = %+v, want 2 files linted and 1 problem", got)
+	}
+	writeFile(t, filepath.Join(dir, "b.py"), "def b():\n    return 2\n")
+	if got := lintWorkspaceCommand(c); got.Linted != 1 || got.Cached != 1 || got.Problems != 0 {
+		t.Errorf("run after changing b.py = %+v, want 1 linted and 1 cached", got)
+	}
+	if got := lintWorkspaceCommand(c); got.Linted != 0 || got.Cached != 2 {
+		t.Errorf("run with nothing changed = %+v, want everything cached", got)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.py")); err != nil {
+		t.Fatal(err)
+	}
+	if got := lintWorkspaceCommand(c); got.Files != 1 {
+		t.Errorf("run after deleting a.py = %+v, want 1 file", got)
+	}
+	if lintCached(filepath.Join(dir, "a.py")) {
+		t.Error("a.py is still in the lint cache after it was deleted")
+	}
+	if !lintCached(filepath.Join(dir, "b.py")) {
+		t.Error("b.py dropped from the lint cache")
+	}
+}
+
+func TestLintWorkspaceExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.py"), "x = 1\n")
+	writeFile(t, filepath.Join(dir, "venv", "lib.py"), "x = 1\n")
+	writeFile(t, filepath.Join(dir, ".tox", "lib.py"), "x = 1\n")
+	writeFile(t, filepath.Join(dir, "src", "generated", "models.py"), "x = 1\n")
+
+	c := newTestServer(t, map[string]any{"diagnostics": map[string]any{"workspace": true}}, nil)
+	setWorkspaceRoot(pathToURI(dir), "")
+	if got := lintWorkspaceCommand(c); got.Files != 2 {
+		t.Errorf("default exclusions: %d files, want app.py and models.py", got.Files)
+	}
+
+	c.notify("workspace/didChangeConfiguration", map[string]any{"settings": map[string]any{"diagnostics": map[string]any{"workspace": true, "workspaceExclude": []string{"generated"}}}})
+	if got := lintWorkspaceCommand(c); got.Files != 2 {
+		t.Errorf("workspaceExclude [generated]: %d files, want app.py and venv/lib.py", got.Files)
+	}
+	if lintCached(filepath.Join(dir, "src", "generated", "models.py")) {
+		t.Error("a file in a newly excluded directory is still in the lint cache")
+	}
+}